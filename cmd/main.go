@@ -1,12 +1,19 @@
 package main
 
 import (
+	"os"
+	"time"
+	"flag"
 	"context"
+	"syscall"
+	"os/signal"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/lambda-go-autentication/pkg/handler/apigw"
+	"github.com/lambda-go-autentication/pkg/handler/router"
+	"github.com/lambda-go-autentication/pkg/handler/httpserver"
 
 	"github.com/lambda-go-autentication/internal/usecase/jwt"
 	adapter_jwt"github.com/lambda-go-autentication/internal/usecase/jwt/adapter"
@@ -15,17 +22,24 @@ import (
 	adapter_credential "github.com/lambda-go-autentication/internal/usecase/credential/adapter"
 	"github.com/lambda-go-autentication/internal/usecase/credential/repository"
 
+	"github.com/lambda-go-autentication/internal/usecase/audit"
+	"github.com/lambda-go-autentication/internal/usecase/audit/sink"
+	adapter_audit "github.com/lambda-go-autentication/internal/usecase/audit/adapter"
+
 	"github.com/lambda-go-autentication/configs"
 	"github.com/lambda-go-autentication/internal/model"
 
-	"github.com/lambda-go-autentication/pkg/util"
 	"github.com/lambda-go-autentication/pkg/observability"
 	"github.com/lambda-go-autentication/pkg/aws_secret_manager"
 	"github.com/lambda-go-autentication/pkg/aws_bucket_s3"
+	"github.com/lambda-go-autentication/pkg/aws_ssm"
+	"github.com/lambda-go-autentication/pkg/aws_kms"
 
 	database "github.com/lambda-go-autentication/pkg/database/dynamo"
+	"github.com/lambda-go-autentication/pkg/database/sqldb"
 
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
@@ -38,70 +52,195 @@ var (
 	logLevel = zerolog.DebugLevel // InfoLevel DebugLevel
 	appServer	model.AppServer
 	tracer 		trace.Tracer
+	runMode		string
+	startTime	= time.Now()
 )
 
 func init(){
 	log.Info().Msg("init")
 	zerolog.SetGlobalLevel(logLevel)
 
-	infoApp := util.GetAppInfo()
-	configOTEL := util.GetOtelEnv()
+	// defaults, CONFIG_FILE, CONFIG_SSM_PARAMETER, CONFIG_APPCONFIG and the variables, a wrong value stops the start
+	loaded, err := configs.Load(context.Background())
+	if err != nil {
+		panic("Error configs.Load, " + err.Error())
+	}
+	if err := configs.Validate(loaded); err != nil {
+		panic("Error configs.Validate, " + err.Error())
+	}
+	appServer = *loaded
 
-	appServer.InfoApp = &infoApp
-	appServer.ConfigOTEL = &configOTEL
+	// lambda (default) or http, the standalone server used in ECS and locally
+	runMode = "lambda"
+	if os.Getenv("RUN_MODE") != "" {
+		runMode = os.Getenv("RUN_MODE")
+	}
 
-	log.Info().Interface("appServer : ", appServer).Msg("")
+	log.Info().Interface("appServer : ", configs.Redacted(&appServer)).Msg("")
 }
 
 func main(){
 	log.Info().Msg("main")
 
+	flag.StringVar(&runMode, "mode", runMode, "run mode: lambda or http")
+	flag.Parse()
+	if runMode != "http" {
+		appServer.ConfigHttpServer = nil
+	}
+
 	ctx := context.Background()
 	configAWS, err := configs.GetAWSConfig(ctx, appServer.InfoApp.AWSRegion)
 	if err != nil {
 		panic("configuration error create new aws session " + err.Error())
 	}
 
+	keyring := jwt.NewKeyring()
+
 	//Load rsa key
 	clientS3 := aws_bucket_s3.NewClientS3Bucket(*configAWS)
-	key_rsa_priv_pem, err := clientS3.GetObject(	ctx, 
-										appServer.InfoApp.BucketNameRSAKey,
-										appServer.InfoApp.FilePathRSA,
-										appServer.InfoApp.FileNameRSAPrivKey)
-	if err != nil {
-		log.Error().Err(err).Msg("Erro GetObject")
+	clientSecret := aws_secret_manager.NewClientSecretManager(configAWS)
+	if appServer.InfoApp.KeyringPrefix != "" {
+		// the kid folders are reloaded while running, a state changed in key.json moves the key (ex: pending to active)
+		s3KeySource := jwt.NewS3KeySource(	keyring,
+											clientS3,
+											appServer.InfoApp.BucketNameRSAKey,
+											appServer.InfoApp.KeyringPrefix,
+											time.Duration(appServer.InfoApp.KeyringTTL) * time.Second)
+		if err := s3KeySource.Load(ctx); err != nil {
+			panic("Error s3KeySource.Load, " + err.Error())
+		}
+		s3KeySource.Start(ctx)
+	} else if appServer.InfoApp.FileNameRSAPrivKey != "" || appServer.InfoApp.FileNameRSAPubKey != "" {
+		keyProvider := newKeyProvider(clientS3, clientSecret, configAWS)
+
+		// a key missing, invalid or not matching stops the start (instead of failing on the first /loginRSA)
+		key, err := jwt.LoadKeyPair(ctx, keyProvider, appServer.InfoApp.FileNameRSAPrivKey, appServer.InfoApp.FileNameRSAPubKey)
+		if err != nil {
+			panic("Error LoadKeyPair, " + err.Error())
+		}
+		if err := keyring.Add(key); err != nil {
+			panic("Error keyring.Add, " + err.Error())
+		}
 	}
-	key_rsa_pub_pem, err := clientS3.GetObject(	ctx, 
-										appServer.InfoApp.BucketNameRSAKey,
-										appServer.InfoApp.FilePathRSA,
-										appServer.InfoApp.FileNameRSAPubKey)
-	if err != nil {
-		log.Error().Err(err).Msg("Erro GetObject")
+
+	// the KMS key signs its alg (RS256 or ES256) without the private key leaving KMS
+	if appServer.InfoApp.KMSKeyId != "" {
+		clientKMS := aws_kms.NewClientKMS(configAWS, appServer.InfoApp.KMSEndpoint)
+		key, err := jwt.NewKMSKey(ctx, clientKMS, appServer.InfoApp.KMSKeyId)
+		if err != nil {
+			panic("Error NewKMSKey, " + err.Error())
+		}
+		if err := keyring.Add(key); err != nil {
+			panic("Error keyring.Add, " + err.Error())
+		}
 	}
 
-	//Load symetric key
-	clientSecret := aws_secret_manager.NewClientSecretManager(configAWS)
-	jwtKey, err := clientSecret.GetSecret(ctx, appServer.InfoApp.SecretJwtKey)
-	if err != nil {
-		panic("Error GetParameter, " + err.Error())
+	if len(keyring.Keys()) == 0 {
+		log.Warn().Msg("no asymetric key configured (RSA_PRIV_FILE_KEY/RSA_PUB_FILE_KEY, KEYRING_PREFIX or KMS_KEY_ID), the RSA routes are disabled")
 	}
 
-	// Create client database repository
-	database, err := database.NewDatabase(ctx, configAWS)
+	// the service key of the JWE tokens (RSA-OAEP-256), published in the JWKS with use enc
+	if appServer.InfoApp.FileNameJwePrivKey != "" || appServer.InfoApp.FileNameJwePubKey != "" {
+		keyProvider := newKeyProvider(clientS3, clientSecret, configAWS)
+		key, err := jwt.LoadKeyPair(ctx, keyProvider, appServer.InfoApp.FileNameJwePrivKey, appServer.InfoApp.FileNameJwePubKey)
+		if err != nil {
+			panic("Error LoadKeyPair jwe, " + err.Error())
+		}
+		encryptionKey, err := jwt.EncryptionKey(key)
+		if err != nil {
+			panic("Error EncryptionKey, " + err.Error())
+		}
+		if err := keyring.Add(encryptionKey); err != nil {
+			panic("Error keyring.Add, " + err.Error())
+		}
+	}
+
+	//Load symetric key, the versions are reloaded while running (rotation without redeploy)
+	secretKeySource := jwt.NewSecretKeySource(	keyring,
+												clientSecret,
+												appServer.InfoApp.SecretJwtKey,
+												appServer.InfoApp.SecretJwtKeyVersions,
+												time.Duration(appServer.InfoApp.SecretJwtKeyTTL) * time.Second)
+	if err := secretKeySource.Load(ctx); err != nil {
+		panic("Error secretKeySource.Load, " + err.Error())
+	}
+	secretKeySource.Start(ctx)
+
+	// Create the audit log, the events go to each sink of AUDIT_SINKS
+	auditSinks, err := sink.NewSinks(ctx, appServer.InfoApp, configAWS)
 	if err != nil {
-		panic("Erro repository.NewAuthRepository, " + err.Error())
+		panic("Error sink.NewSinks, " + err.Error())
 	}
+	useCaseAudit := audit.NewUseCaseAudit(auditSinks...)
+	adapterAudit := adapter_audit.NewAdapterAudit(useCaseAudit)
 
 	// Create a usecase jwt
-	useCaseJwt := jwt.NewUseCaseJwt(jwtKey, key_rsa_priv_pem, key_rsa_pub_pem)
-	adapterJwt := adapter_jwt.NewAdapterJwt(useCaseJwt)
+	useCaseJwt := jwt.NewUseCaseJwt(keyring)
+	useCaseJwt.SetAudit(useCaseAudit)
+	useCaseJwt.SetAudiences(appServer.InfoApp.ServiceAudience, appServer.InfoApp.AccessTokenAudiences)
+	adapterJwt := adapter_jwt.NewAdapterJwt(&appServer, useCaseJwt)
+
+	// Create the repository of the configured backend
+	var repoCredential repository.Repository
+	switch appServer.InfoApp.DatabaseBackend {
+	case "dynamo":
+		database, err := database.NewDatabase(ctx, configAWS)
+		if err != nil {
+			panic("Erro repository.NewAuthRepository, " + err.Error())
+		}
+		repoCredential = repository.NewRepoCredential(database, &appServer.InfoApp.TableName)
+	case sqldb.DriverPostgres, sqldb.DriverSQLite:
+		dsn := appServer.InfoApp.DatabaseDSN
+		if appServer.InfoApp.DatabaseDSNSecret != "" {
+			secret_dsn, err := clientSecret.GetSecret(ctx, appServer.InfoApp.DatabaseDSNSecret)
+			if err != nil {
+				panic("Error GetSecret database dsn, " + err.Error())
+			}
+			dsn = *secret_dsn
+		}
+		database, err := sqldb.NewDatabase(ctx, appServer.InfoApp.DatabaseBackend, dsn)
+		if err != nil {
+			panic("Error sqldb.NewDatabase, " + err.Error())
+		}
+		if err := database.Migrate(ctx); err != nil {
+			panic("Error database.Migrate, " + err.Error())
+		}
+		repoCredential = repository.NewRepoSQL(database)
+	case "memory":
+		repoCredential = repository.NewRepoMemory()
+	default:
+		panic("Error DATABASE_BACKEND not supported: " + appServer.InfoApp.DatabaseBackend)
+	}
+
+	// the revoked tokens are refused by the validation, the refresh, the authorizer and the routes with a bearer token
+	useCaseJwt.SetRevocation(repoCredential)
 
 	// Create a usecase credentials
-	repoCredential:= repository.NewRepoCredential(database, &appServer.InfoApp.TableName)
-	useCaseCredential := credential.NewUseCaseCredential(repoCredential, useCaseJwt.OAUTHToken, useCaseJwt.OAUTHTokenRSA)
+	useCaseCredential := credential.NewUseCaseCredential(repoCredential, useCaseJwt.OAUTHToken, useCaseJwt.OAUTHTokenRSA, useCaseJwt.ParseAccessToken, useCaseAudit)
+	// the credential is locked for LOGIN_LOCKOUT_SECONDS after LOGIN_MAX_FAILURES failed logins
+	useCaseCredential.SetLockout(appServer.InfoApp.LoginMaxFailures, time.Duration(appServer.InfoApp.LoginLockoutSeconds) * time.Second)
 	adapterCredential := adapter_credential.NewAdapterCredential(&appServer, useCaseCredential)
 
-	handler := apigw.InitializeLambdaHandler(adapterCredential, adapterJwt)
+	// Create the first admin, the password is the BOOTSTRAP_ADMIN_SECRET secret value
+	if appServer.InfoApp.BootstrapAdminUser != "" {
+		admin_password, err := clientSecret.GetSecret(ctx, appServer.InfoApp.BootstrapAdminSecret)
+		if err != nil {
+			panic("Error GetSecret bootstrap admin, " + err.Error())
+		}
+		err = useCaseCredential.BootstrapAdmin(ctx, appServer.InfoApp.BootstrapAdminUser, *admin_password)
+		if err != nil {
+			panic("Error BootstrapAdmin, " + err.Error())
+		}
+	}
+
+	// routes and middlewares shared by the lambda and http modes
+	routerApp := router.NewRouter()
+	routerApp.Use(	router.Recovery(),
+					router.Tracing(),
+					router.Logging(),
+					router.AuditContext(),
+					router.CORS(appServer.InfoApp.CorsAllowedOrigins))
+	routerApp.RegisterRoutes(adapterCredential, adapterJwt, adapterAudit, useCaseCredential.ParseAccessToken)
 
 	tp := observability.NewTracerProvider(ctx, appServer.ConfigOTEL, appServer.InfoApp)
 	defer func(ctx context.Context) {
@@ -111,10 +250,55 @@ func main(){
 			}
 	}(ctx)
 	
+	mp := observability.NewMeterProvider(ctx, appServer.ConfigOTEL, appServer.InfoApp)
+	defer func(ctx context.Context) {
+			err := mp.Shutdown(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("Error shutting down meter provider")
+			}
+	}(ctx)
+
 	otel.SetTextMapPropagator(xray.Propagator{})
 	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
 	tracer = tp.Tracer("lambda-go-authorizer-cert")
 
-	lambda.Start(otellambda.InstrumentHandler(handler.LambdaHandlerRequest, xrayconfig.WithRecommendedOptions(tp)... ))
-	//lambda.Start(handler.LambdaHandlerRequest)
-}	
\ No newline at end of file
+	observability.RecordColdStart(ctx, time.Since(startTime))
+
+	switch runMode {
+		case "http":
+			ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+
+			httpServer := httpserver.NewHttpServer(routerApp, appServer.ConfigHttpServer)
+			if err := httpServer.StartHttpServer(ctx); err != nil {
+				log.Error().Err(err).Msg("Error StartHttpServer")
+			}
+		case "lambda":
+			handler := apigw.InitializeLambdaHandler(routerApp, adapterJwt)
+			lambda.Start(otellambda.InstrumentHandler(handler.LambdaHandlerEvent, append(xrayconfig.WithRecommendedOptions(tp), otellambda.WithFlusher(observability.Flushers(tp, mp)))... ))
+			//lambda.Start(handler.LambdaHandlerRequest)
+		default:
+			log.Error().Str("mode", runMode).Msg("Error run mode not supported")
+	}
+}
+
+// newKeyProvider returns the source (KEY_PROVIDER) of the pem keys
+func newKeyProvider(clientS3 *aws_bucket_s3.AwsClientBucketS3,
+					clientSecret *aws_secret_manager.AwsClientSecretManager,
+					configAWS *aws.Config) jwt.KeyProvider {
+	switch appServer.InfoApp.KeyProvider {
+	case "s3":
+		return jwt.NewS3KeyProvider(clientS3, appServer.InfoApp.BucketNameRSAKey, appServer.InfoApp.FilePathRSA)
+	case "secretsmanager":
+		return jwt.NewSecretKeyProvider(clientSecret)
+	case "ssm":
+		return jwt.NewSSMKeyProvider(aws_ssm.NewClientSSM(configAWS))
+	case "file":
+		return jwt.NewFileKeyProvider(appServer.InfoApp.FilePathRSA)
+	case "env":
+		return jwt.NewEnvKeyProvider()
+	default:
+		panic("Error KEY_PROVIDER not supported: " + appServer.InfoApp.KeyProvider)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lambda-go-autentication/configs"
+	"github.com/lambda-go-autentication/internal/usecase/rotation"
+	"github.com/lambda-go-autentication/internal/usecase/audit"
+	"github.com/lambda-go-autentication/internal/usecase/audit/sink"
+
+	"github.com/lambda-go-autentication/pkg/observability"
+	"github.com/lambda-go-autentication/pkg/aws_secret_manager"
+
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda/xrayconfig"
+)
+
+// rotation is the Secrets Manager rotation Lambda of the HS256 key (SECRET_JWT_KEY), deployed as a second function
+// with the same variables of the service: REGION, SECRET_JWT_KEY, AUDIT_SINKS and the OTEL ones
+func main(){
+	log.Info().Msg("main rotation")
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	ctx := context.Background()
+	appServer, err := configs.Load(ctx)
+	if err != nil {
+		panic("Error configs.Load, " + err.Error())
+	}
+	if err := configs.Validate(appServer); err != nil {
+		panic("Error configs.Validate, " + err.Error())
+	}
+	infoApp := appServer.InfoApp
+
+	configAWS, err := configs.GetAWSConfig(ctx, infoApp.AWSRegion)
+	if err != nil {
+		panic("configuration error create new aws session " + err.Error())
+	}
+
+	// the key rotations go to the audit sinks of the service (AUDIT_SINKS)
+	auditSinks, err := sink.NewSinks(ctx, infoApp, configAWS)
+	if err != nil {
+		panic("Error sink.NewSinks, " + err.Error())
+	}
+
+	clientSecret := aws_secret_manager.NewClientSecretManager(configAWS)
+	useCaseRotation := rotation.NewUseCaseRotation(clientSecret, infoApp.SecretJwtKey, audit.NewUseCaseAudit(auditSinks...))
+
+	tp := observability.NewTracerProvider(ctx, appServer.ConfigOTEL, infoApp)
+	defer func(ctx context.Context) {
+			err := tp.Shutdown(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("Error shutting down tracer provider")
+			}
+	}(ctx)
+
+	otel.SetTextMapPropagator(xray.Propagator{})
+	otel.SetTracerProvider(tp)
+
+	lambda.Start(otellambda.InstrumentHandler(useCaseRotation.Rotate, xrayconfig.WithRecommendedOptions(tp)... ))
+}
@@ -0,0 +1,315 @@
+package configs
+
+import (
+	"os"
+	"io"
+	"time"
+	"errors"
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"net/url"
+	"net/http"
+	"encoding/json"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/pkg/util"
+	"github.com/lambda-go-autentication/pkg/aws_ssm"
+)
+
+// variables that select the configuration sources, read only from the environment
+const (
+	envConfigFile		= "CONFIG_FILE"				// json file with the AppServer layout (info_app, otel_config, http_server_config)
+	envConfigSSM		= "CONFIG_SSM_PARAMETER"	// SSM parameter with the same json
+	envConfigAppConfig	= "CONFIG_APPCONFIG"		// application/environment/profile read by the AppConfig Lambda extension
+	envAppConfigPort	= "AWS_APPCONFIG_EXTENSION_HTTP_PORT"
+)
+
+const redactedValue = "***"
+
+// Load builds the configuration, each source overrides the previous one:
+// default tags, CONFIG_FILE, CONFIG_SSM_PARAMETER, CONFIG_APPCONFIG and the env tag variables.
+// A value that does not parse (ex: SECRET_JWT_KEY_TTL=abc) or an unknown field in a json source is an error
+func Load(ctx context.Context) (*model.AppServer, error) {
+	childLogger.Debug().Msg("Load")
+
+	appServer := model.AppServer{	InfoApp: &model.InfoApp{},
+									ConfigOTEL: &model.ConfigOTEL{},
+									ConfigHttpServer: &model.ConfigHttpServer{} }
+	sections := []interface{}{appServer.InfoApp, appServer.ConfigOTEL, appServer.ConfigHttpServer}
+
+	for _, section := range sections {
+		if err := setFields(section, "default", func(tag string) (string, bool) { return tag, tag != "" }); err != nil {
+			return nil, err
+		}
+	}
+
+	if os.Getenv(envConfigFile) != "" {
+		data, err := os.ReadFile(os.Getenv(envConfigFile))
+		if err != nil {
+			return nil, err
+		}
+		if err := decodeSource(envConfigFile, data, &appServer); err != nil {
+			return nil, err
+		}
+	}
+
+	// the region and the remote sources may come from the env, so it is applied before and after them
+	if err := loadEnv(sections); err != nil {
+		return nil, err
+	}
+	if os.Getenv(envConfigSSM) == "" && os.Getenv(envConfigAppConfig) == "" {
+		return &appServer, nil
+	}
+
+	if os.Getenv(envConfigSSM) != "" {
+		configAWS, err := GetAWSConfig(ctx, appServer.InfoApp.AWSRegion)
+		if err != nil {
+			return nil, err
+		}
+		data, err := aws_ssm.NewClientSSM(configAWS).GetParameter(ctx, os.Getenv(envConfigSSM))
+		if err != nil {
+			return nil, err
+		}
+		if err := decodeSource(envConfigSSM, []byte(*data), &appServer); err != nil {
+			return nil, err
+		}
+	}
+
+	if os.Getenv(envConfigAppConfig) != "" {
+		data, err := getAppConfig(ctx, os.Getenv(envConfigAppConfig))
+		if err != nil {
+			return nil, err
+		}
+		if err := decodeSource(envConfigAppConfig, data, &appServer); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := loadEnv(sections); err != nil {
+		return nil, err
+	}
+	return &appServer, nil
+}
+
+func loadEnv(sections []interface{}) error {
+	for _, section := range sections {
+		if err := setFields(section, "env", func(tag string) (string, bool) {
+			if tag == "" || os.Getenv(tag) == "" {
+				return "", false
+			}
+			return os.Getenv(tag), true
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeSource applies a json source over the current values, only the informed fields change
+func decodeSource(source string, data []byte, appServer *model.AppServer) error {
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(appServer); err != nil {
+		return errors.New(source + ": " + err.Error())
+	}
+	return nil
+}
+
+// getAppConfig reads the configuration profile from the AppConfig Lambda extension (it caches and polls AppConfig)
+func getAppConfig(ctx context.Context, profile string) ([]byte, error) {
+	parts := strings.Split(profile, "/")
+	if len(parts) != 3 {
+		return nil, errors.New(envConfigAppConfig + " must be application/environment/profile: " + profile)
+	}
+	port := "2772"
+	if os.Getenv(envAppConfigPort) != "" {
+		port = os.Getenv(envAppConfigPort)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5 * time.Second)
+	defer cancel()
+
+	url := "http://localhost:" + port + "/applications/" + parts[0] + "/environments/" + parts[1] + "/configurations/" + parts[2]
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.New(envConfigAppConfig + ": " + err.Error())
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(envConfigAppConfig + ": status " + strconv.Itoa(res.StatusCode) + " " + strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// setFields sets each field whose tag has a value, the errors name the tag value (the variable)
+func setFields(section interface{}, tagName string, lookup func(tag string) (string, bool)) error {
+	value := reflect.ValueOf(section).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		raw, ok := lookup(field.Tag.Get(tagName))
+		if !ok {
+			continue
+		}
+		if err := setField(value.Field(i), raw); err != nil {
+			name := field.Tag.Get("env")
+			if name == "" {
+				name = field.Name
+			}
+			return errors.New(name + ": invalid value " + strconv.Quote(raw) + ", " + err.Error())
+		}
+	}
+	return nil
+}
+
+// setField parses the text of a variable: []string is comma separated and the maps are json
+func setField(field reflect.Value, raw string) error {
+	switch field.Kind() {
+		case reflect.String:
+			field.SetString(raw)
+		case reflect.Bool:
+			parsed, err := strconv.ParseBool(raw)
+			if err != nil {
+				return errors.New("expected true or false")
+			}
+			field.SetBool(parsed)
+		case reflect.Int, reflect.Int64:
+			parsed, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return errors.New("expected an integer")
+			}
+			field.SetInt(parsed)
+		case reflect.Slice:
+			items := []string{}
+			for _, item := range strings.Split(raw, ",") {
+				if strings.TrimSpace(item) != "" {
+					items = append(items, strings.TrimSpace(item))
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+		case reflect.Map:
+			parsed := reflect.New(field.Type())
+			if err := json.Unmarshal([]byte(raw), parsed.Interface()); err != nil {
+				return err
+			}
+			field.Set(parsed.Elem())
+		default:
+			return errors.New("unsupported type " + field.Kind().String())
+	}
+	return nil
+}
+
+// Validate checks the validate tags of InfoApp and the settings that depend on each other, all the problems are returned at once
+func Validate(appServer *model.AppServer) error {
+	childLogger.Debug().Msg("Validate")
+
+	problems := []string{}
+
+	if err := util.Validate(appServer.InfoApp); err != nil {
+		for _, field := range erro.As(err).Fields {
+			problems = append(problems, envName(field.Field) + " " + field.Message)
+		}
+	}
+
+	infoApp := appServer.InfoApp
+	required := func(condition bool, name string, reason string) {
+		if condition {
+			problems = append(problems, name + " is required " + reason)
+		}
+	}
+	required(infoApp.DatabaseBackend == "dynamo" && infoApp.TableName == "", "TABLE_NAME", "by DATABASE_BACKEND=dynamo")
+	required((infoApp.DatabaseBackend == "postgres" || infoApp.DatabaseBackend == "sqlite") && infoApp.DatabaseDSN == "" && infoApp.DatabaseDSNSecret == "",
+			"DATABASE_DSN or DATABASE_DSN_SECRET", "by DATABASE_BACKEND=" + infoApp.DatabaseBackend)
+	required(infoApp.BootstrapAdminUser != "" && infoApp.BootstrapAdminSecret == "", "BOOTSTRAP_ADMIN_SECRET", "by BOOTSTRAP_ADMIN_USER")
+	required(infoApp.KeyringPrefix != "" && infoApp.BucketNameRSAKey == "", "RSA_BUCKET_NAME_KEY", "by KEYRING_PREFIX")
+	required(infoApp.KeyringPrefix == "" && infoApp.KeyProvider == "s3" && infoApp.BucketNameRSAKey == "" &&
+			(infoApp.FileNameRSAPrivKey != "" || infoApp.FileNameJwePrivKey != ""), "RSA_BUCKET_NAME_KEY", "by KEY_PROVIDER=s3")
+
+	if infoApp.IssuerURL != "" {
+		issuer, err := url.Parse(infoApp.IssuerURL)
+		local := err == nil && issuer.Scheme == "http" && (issuer.Hostname() == "localhost" || issuer.Hostname() == "127.0.0.1")
+		if err != nil || (issuer.Scheme != "https" && !local) || issuer.Host == "" || issuer.RawQuery != "" || issuer.Fragment != "" {
+			problems = append(problems, "ISSUER_URL must be a https url without query or fragment (http only for localhost)")
+		}
+	}
+	if (infoApp.FileNameRSAPrivKey == "") != (infoApp.FileNameRSAPubKey == "") {
+		problems = append(problems, "RSA_PRIV_FILE_KEY and RSA_PUB_FILE_KEY must be informed together")
+	}
+	if (infoApp.FileNameJwePrivKey == "") != (infoApp.FileNameJwePubKey == "") {
+		problems = append(problems, "JWE_PRIV_FILE_KEY and JWE_PUB_FILE_KEY must be informed together")
+	}
+	for _, sink := range infoApp.AuditSinks {
+		if sink != "stdout" && sink != "dynamo" && sink != "stream" && sink != "memory" {
+			problems = append(problems, "AUDIT_SINKS must be stdout, dynamo, stream or memory: " + sink)
+		}
+		required(sink == "dynamo" && infoApp.AuditTableName == "", "AUDIT_TABLE_NAME", "by AUDIT_SINKS=dynamo")
+		required(sink == "stream" && infoApp.AuditStreamName == "", "AUDIT_STREAM_NAME", "by AUDIT_SINKS=stream")
+	}
+	if infoApp.AuditRetentionDays < 1 {
+		problems = append(problems, "AUDIT_RETENTION_DAYS must be 1 or more")
+	}
+	if infoApp.LoginMaxFailures < 0 {
+		problems = append(problems, "LOGIN_MAX_FAILURES must be 0 (no lockout) or more")
+	}
+	if infoApp.LoginMaxFailures > 0 && infoApp.LoginLockoutSeconds < 1 {
+		problems = append(problems, "LOGIN_LOCKOUT_SECONDS must be 1 or more")
+	}
+	if infoApp.KeyringTTL < 0 {
+		problems = append(problems, "KEYRING_TTL must be 0 or more")
+	}
+	if infoApp.SecretJwtKeyTTL < 0 {
+		problems = append(problems, "SECRET_JWT_KEY_TTL must be 0 or more")
+	}
+	if appServer.ConfigOTEL != nil && appServer.ConfigOTEL.MetricsExporter != "otel" && appServer.ConfigOTEL.MetricsExporter != "emf" {
+		problems = append(problems, "METRICS_EXPORTER must be otel or emf")
+	}
+	if appServer.ConfigHttpServer != nil && (appServer.ConfigHttpServer.Port < 1 || appServer.ConfigHttpServer.Port > 65535) {
+		problems = append(problems, "HTTP_PORT must be between 1 and 65535")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// envName returns the variable of the InfoApp json field
+func envName(jsonName string) string {
+	fields := reflect.TypeOf(model.InfoApp{})
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		if strings.Split(field.Tag.Get("json"), ",")[0] == jsonName && field.Tag.Get("env") != "" {
+			return field.Tag.Get("env")
+		}
+	}
+	return jsonName
+}
+
+// Redacted returns a copy safe to expose (GetInfo and the logs), the redact fields informed are replaced by ***
+func Redacted(appServer *model.AppServer) *model.AppServer {
+	redacted := *appServer
+	if appServer.InfoApp == nil {
+		return &redacted
+	}
+
+	infoApp := *appServer.InfoApp
+	value := reflect.ValueOf(&infoApp).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if value.Type().Field(i).Tag.Get("redact") == "true" && value.Field(i).String() != "" {
+			value.Field(i).SetString(redactedValue)
+		}
+	}
+	redacted.InfoApp = &infoApp
+	return &redacted
+}
@@ -0,0 +1,219 @@
+package configs
+
+import (
+	"os"
+	"strings"
+	"context"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+// clearEnv unsets (for the test) the variables read by Load, the values of the machine do not change the result
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	for _, name := range []string{envConfigFile, envConfigSSM, envConfigAppConfig, envAppConfigPort,
+								"KEY_PROVIDER", "TABLE_NAME", "SECRET_JWT_KEY", "SECRET_JWT_KEY_TTL", "HTTP_PORT",
+								"AUDIT_SINKS", "CORS_ALLOWED_ORIGINS", "AUTHORIZER_SCOPE_ROUTES", "METRICS_EXPORTER"} {
+		t.Setenv(name, "")
+	}
+}
+
+// appConfigServer answers the profile as the AppConfig Lambda extension
+func appConfigServer(t *testing.T, profile string) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/applications/auth/environments/prod/configurations/main" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(profile))
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv(envConfigAppConfig, "auth/prod/main")
+	t.Setenv(envAppConfigPort, server.URL[strings.LastIndex(server.URL, ":")+1:])
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	cases := []struct {
+		name		string
+		file		string
+		appConfig	string
+		env			map[string]string
+		check		func(t *testing.T, appServer *model.AppServer)
+	}{
+		{	name: "defaults",
+			check: func(t *testing.T, appServer *model.AppServer) {
+				if appServer.InfoApp.KeyProvider != "s3" || appServer.InfoApp.SecretJwtKeyTTL != 300 || appServer.ConfigHttpServer.Port != 8080 {
+					t.Errorf("defaults = %s %d %d", appServer.InfoApp.KeyProvider, appServer.InfoApp.SecretJwtKeyTTL, appServer.ConfigHttpServer.Port)
+				}
+				if len(appServer.InfoApp.AuditSinks) != 1 || appServer.InfoApp.AuditSinks[0] != "stdout" {
+					t.Errorf("AUDIT_SINKS default = %v", appServer.InfoApp.AuditSinks)
+				}
+			} },
+		{	name: "file over defaults",
+			file: `{"info_app":{"key_provider":"file","table_name":"file-table"},"http_server_config":{"port":9090}}`,
+			check: func(t *testing.T, appServer *model.AppServer) {
+				if appServer.InfoApp.KeyProvider != "file" || appServer.InfoApp.TableName != "file-table" || appServer.ConfigHttpServer.Port != 9090 {
+					t.Errorf("file = %s %s %d", appServer.InfoApp.KeyProvider, appServer.InfoApp.TableName, appServer.ConfigHttpServer.Port)
+				}
+				if appServer.InfoApp.SecretJwtKeyTTL != 300 {
+					t.Errorf("the default not in the file = %d, want 300", appServer.InfoApp.SecretJwtKeyTTL)
+				}
+			} },
+		{	name: "appconfig over file",
+			file: `{"info_app":{"key_provider":"file","table_name":"file-table"}}`,
+			appConfig: `{"info_app":{"table_name":"appconfig-table","secret_jwt_key_ttl":120}}`,
+			check: func(t *testing.T, appServer *model.AppServer) {
+				if appServer.InfoApp.KeyProvider != "file" || appServer.InfoApp.TableName != "appconfig-table" || appServer.InfoApp.SecretJwtKeyTTL != 120 {
+					t.Errorf("appconfig = %s %s %d", appServer.InfoApp.KeyProvider, appServer.InfoApp.TableName, appServer.InfoApp.SecretJwtKeyTTL)
+				}
+			} },
+		{	name: "env over every source",
+			file: `{"info_app":{"key_provider":"file","table_name":"file-table"}}`,
+			appConfig: `{"info_app":{"table_name":"appconfig-table","secret_jwt_key_ttl":120}}`,
+			env: map[string]string{ "TABLE_NAME": "env-table", "SECRET_JWT_KEY_TTL": "30", "CORS_ALLOWED_ORIGINS": "https://a.com, https://b.com",
+									"AUTHORIZER_SCOPE_ROUTES": `{"payment.read":["GET/payment/*"]}` },
+			check: func(t *testing.T, appServer *model.AppServer) {
+				if appServer.InfoApp.KeyProvider != "file" || appServer.InfoApp.TableName != "env-table" || appServer.InfoApp.SecretJwtKeyTTL != 30 {
+					t.Errorf("env = %s %s %d", appServer.InfoApp.KeyProvider, appServer.InfoApp.TableName, appServer.InfoApp.SecretJwtKeyTTL)
+				}
+				if origins := appServer.InfoApp.CorsAllowedOrigins; len(origins) != 2 || origins[1] != "https://b.com" {
+					t.Errorf("CORS_ALLOWED_ORIGINS = %v", origins)
+				}
+				if routes := appServer.InfoApp.AuthorizerScopeRoutes["payment.read"]; len(routes) != 1 || routes[0] != "GET/payment/*" {
+					t.Errorf("AUTHORIZER_SCOPE_ROUTES = %v", appServer.InfoApp.AuthorizerScopeRoutes)
+				}
+			} },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			clearEnv(t)
+			if c.file != "" {
+				file := filepath.Join(t.TempDir(), "config.json")
+				if err := os.WriteFile(file, []byte(c.file), 0600); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv(envConfigFile, file)
+			}
+			if c.appConfig != "" {
+				appConfigServer(t, c.appConfig)
+			}
+			for name, value := range c.env {
+				t.Setenv(name, value)
+			}
+
+			appServer, err := Load(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.check(t, appServer)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := []struct {
+		name	string
+		file	string
+		env		map[string]string
+		want	string
+	}{
+		{ name: "integer that does not parse", env: map[string]string{ "SECRET_JWT_KEY_TTL": "abc" }, want: "SECRET_JWT_KEY_TTL" },
+		{ name: "unknown field in the file", file: `{"info_app":{"table":"x"}}`, want: envConfigFile },
+		{ name: "missing file", env: map[string]string{ envConfigFile: "/does/not/exist.json" }, want: "exist.json" },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			clearEnv(t)
+			if c.file != "" {
+				file := filepath.Join(t.TempDir(), "config.json")
+				if err := os.WriteFile(file, []byte(c.file), 0600); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv(envConfigFile, file)
+			}
+			for name, value := range c.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := Load(context.Background())
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("Load error = %v, want it to name %s", err, c.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// valid returns a valid configuration (the defaults and the required values), changed by each case
+	valid := func() *model.AppServer {
+		return &model.AppServer{
+			InfoApp: &model.InfoApp{	SecretJwtKey: "key-secret",
+										IssuerURL: "https://auth.domain.com",
+										TableName: "user_login_2",
+										KeyProvider: "s3",
+										DatabaseBackend: "dynamo",
+										AuditSinks: []string{"stdout"},
+										AuditRetentionDays: 90,
+										SecretJwtKeyTTL: 300,
+										KeyringTTL: 300 },
+			ConfigOTEL: &model.ConfigOTEL{ MetricsExporter: "otel" },
+			ConfigHttpServer: &model.ConfigHttpServer{ Port: 8080 },
+		}
+	}
+
+	cases := []struct {
+		name	string
+		change	func(appServer *model.AppServer)
+		want	[]string
+	}{
+		{ name: "valid", change: func(appServer *model.AppServer) {} },
+		{ name: "required tag", change: func(appServer *model.AppServer) { appServer.InfoApp.SecretJwtKey = "" }, want: []string{"SECRET_JWT_KEY"} },
+		{ name: "oneof tag", change: func(appServer *model.AppServer) { appServer.InfoApp.KeyProvider = "vault" }, want: []string{"KEY_PROVIDER"} },
+		{ name: "table of the dynamo backend", change: func(appServer *model.AppServer) { appServer.InfoApp.TableName = "" }, want: []string{"TABLE_NAME"} },
+		{ name: "dsn of the sql backend", change: func(appServer *model.AppServer) { appServer.InfoApp.DatabaseBackend = "postgres" }, want: []string{"DATABASE_DSN"} },
+		{ name: "key pair informed together", change: func(appServer *model.AppServer) { appServer.InfoApp.FileNameRSAPrivKey = "private_key.pem"; appServer.InfoApp.BucketNameRSAKey = "bucket" }, want: []string{"RSA_PUB_FILE_KEY"} },
+		{ name: "audit sink", change: func(appServer *model.AppServer) { appServer.InfoApp.AuditSinks = []string{"dynamo", "kafka"} }, want: []string{"AUDIT_TABLE_NAME", "kafka"} },
+		{ name: "issuer required", change: func(appServer *model.AppServer) { appServer.InfoApp.IssuerURL = "" }, want: []string{"ISSUER_URL"} },
+		{ name: "issuer over http", change: func(appServer *model.AppServer) { appServer.InfoApp.IssuerURL = "http://auth.domain.com" }, want: []string{"ISSUER_URL"} },
+		{ name: "issuer with query", change: func(appServer *model.AppServer) { appServer.InfoApp.IssuerURL = "https://auth.domain.com/?a=b" }, want: []string{"ISSUER_URL"} },
+		{ name: "issuer of the local server", change: func(appServer *model.AppServer) { appServer.InfoApp.IssuerURL = "http://localhost:8080" } },
+		{ name: "negative login failures", change: func(appServer *model.AppServer) { appServer.InfoApp.LoginMaxFailures = -1 }, want: []string{"LOGIN_MAX_FAILURES"} },
+		{ name: "lockout without duration", change: func(appServer *model.AppServer) { appServer.InfoApp.LoginMaxFailures = 5 }, want: []string{"LOGIN_LOCKOUT_SECONDS"} },
+		{ name: "negative ttl", change: func(appServer *model.AppServer) { appServer.InfoApp.KeyringTTL = -1 }, want: []string{"KEYRING_TTL"} },
+		{ name: "metrics exporter", change: func(appServer *model.AppServer) { appServer.ConfigOTEL.MetricsExporter = "prometheus" }, want: []string{"METRICS_EXPORTER"} },
+		{ name: "every problem at once", change: func(appServer *model.AppServer) { appServer.InfoApp.SecretJwtKey = ""; appServer.ConfigHttpServer.Port = 0 }, want: []string{"SECRET_JWT_KEY", "HTTP_PORT"} },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			appServer := valid()
+			c.change(appServer)
+
+			err := Validate(appServer)
+			if len(c.want) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate must fail naming %v", c.want)
+			}
+			for _, want := range c.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate error = %v, want it to name %s", err, want)
+				}
+			}
+		})
+	}
+}
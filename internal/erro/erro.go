@@ -2,24 +2,117 @@ package erro
 
 import (
 	"errors"
+	"net/http"
+
+	"github.com/lambda-go-autentication/internal/model"
 )
 
+// Error is an error with the http status, a stable code (used by the clients) and if the request may be retried
+type Error struct {
+	Code		string
+	Status		int
+	Message		string
+	Retryable	bool
+	Fields		[]model.FieldError
+	base		*Error
+	cause		error
+}
+
+func New(code string, status int, message string, retryable bool) *Error {
+	return &Error{ Code: code, Status: status, Message: message, Retryable: retryable }
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is matches the variable the error was derived from, errors.Is(err, erro.ErrNotFound) works after Wrap or WithMessage
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && (t == e || t == e.base)
+}
+
+func (e *Error) derive() *Error {
+	derived := *e
+	if derived.base == nil {
+		derived.base = e
+	}
+	return &derived
+}
+
+// Wrap keeps the cause, it is only logged and never sent to the client
+func (e *Error) Wrap(cause error) *Error {
+	wrapped := e.derive()
+	wrapped.cause = cause
+	return wrapped
+}
+
+// WithMessage replaces the message sent to the client, only for messages safe to expose (ex: json decode)
+func (e *Error) WithMessage(message string) *Error {
+	wrapped := e.derive()
+	wrapped.Message = message
+	return wrapped
+}
+
+// WithFields adds the field level errors of the validation
+func (e *Error) WithFields(fields []model.FieldError) *Error {
+	wrapped := e.derive()
+	wrapped.Fields = fields
+	return wrapped
+}
+
+// As returns the typed error, any other error becomes an internal error (its text is not exposed)
+func As(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return ErrInternal.Wrap(err)
+}
+
 var (
-	ErrCertRevoked = errors.New("unauthorized cert revoked")
-	ErrParseCert = errors.New("unable to parse x509 cert")
-	ErrDecodeCert = errors.New("failed to decode pem-encoded cert")
-	ErrDecodeKey = errors.New("error decode rsa key")
-	ErrTokenExpired	= errors.New("token expired")
-	ErrStatusUnauthorized = errors.New("invalid Token")
-	ErrArnMalFormad = errors.New("unauthorized arn scoped malformed")
-	ErrBearTokenFormad = errors.New("unauthorized token not informed")
-	ErrUnmarshal = errors.New("erro unmarshall")
-	ErrInsert 	= errors.New("insert error")
-	ErrPreparedQuery = errors.New("prepare dynamo query erro")
-	ErrQuery = errors.New("query table error")
-	ErrNotFound = errors.New("data not found")
-	ErrList	= errors.New("list query error")
-	ErrMethodNotAllowed	= errors.New("method not allowed")
-	ErrQueryEmpty	= errors.New("query parameters missing")
-	ErrTokenStillValid = errors.New("token is still valid")
-)
\ No newline at end of file
+	ErrCertRevoked = New("cert_revoked", http.StatusUnauthorized, "unauthorized cert revoked", false)
+	ErrParseCert = New("cert_invalid", http.StatusBadRequest, "unable to parse x509 cert", false)
+	ErrDecodeCert = New("cert_invalid", http.StatusBadRequest, "failed to decode pem-encoded cert", false)
+	ErrDecodeKey = New("key_invalid", http.StatusInternalServerError, "error decode rsa key", false)
+	ErrTokenExpired	= New("token_expired", http.StatusUnauthorized, "token expired", false)
+	ErrStatusUnauthorized = New("token_invalid", http.StatusUnauthorized, "invalid Token", false)
+	ErrArnMalFormad = New("arn_invalid", http.StatusBadRequest, "unauthorized arn scoped malformed", false)
+	ErrBearTokenFormad = New("token_missing", http.StatusUnauthorized, "unauthorized token not informed", false)
+	ErrUnmarshal = New("serialization_error", http.StatusInternalServerError, "erro unmarshall", false)
+	ErrInsert 	= New("storage_unavailable", http.StatusServiceUnavailable, "insert error", true)
+	ErrPreparedQuery = New("storage_query_invalid", http.StatusInternalServerError, "prepare dynamo query erro", false)
+	ErrQuery = New("storage_unavailable", http.StatusServiceUnavailable, "query table error", true)
+	ErrNotFound = New("not_found", http.StatusNotFound, "data not found", false)
+	ErrList	= New("storage_unavailable", http.StatusServiceUnavailable, "list query error", true)
+	ErrMethodNotAllowed	= New("method_not_allowed", http.StatusMethodNotAllowed, "method not allowed", false)
+	ErrRouteNotFound	= New("route_not_found", http.StatusNotFound, "route not found", false)
+	ErrInternal	= New("internal_error", http.StatusInternalServerError, "internal server error", false)
+	ErrBadRequest	= New("invalid_request", http.StatusBadRequest, "invalid request body", false)
+	ErrValidation	= New("validation_failed", http.StatusBadRequest, "request validation failed", false)
+	ErrPayloadTooLarge	= New("payload_too_large", http.StatusRequestEntityTooLarge, "request body too large", false)
+	ErrTimeout	= New("timeout", http.StatusServiceUnavailable, "request timeout", true)
+	ErrQueryEmpty	= New("parameter_missing", http.StatusBadRequest, "query parameters missing", false)
+	ErrTokenStillValid = New("token_still_valid", http.StatusBadRequest, "token is still valid", false)
+	ErrAudienceUnknown = New("audience_unknown", http.StatusNotFound, "audience not registered", false)
+	ErrAudienceMismatch = New("audience_mismatch", http.StatusUnauthorized, "token audience mismatch", false)
+	ErrScopeNotAllowed = New("scope_not_allowed", http.StatusForbidden, "no scope granted for the audience", false)
+	ErrSigningAlg = New("signing_alg_unsupported", http.StatusBadRequest, "signing algorithm not supported", false)
+	ErrScopeOpenID = New("insufficient_scope", http.StatusForbidden, "access token without openid scope", false)
+	ErrOpenIDAsymmetric = New("openid_asymmetric_only", http.StatusBadRequest, "the openid scope is only accepted by /loginRSA, the id token is signed with an asymmetric key", false)
+	ErrScopeRequired = New("insufficient_scope", http.StatusForbidden, "access token without the required scope", false)
+	ErrInvalidCredential = New("invalid_credential", http.StatusUnauthorized, "invalid user or password", false)
+	ErrPasswordTooLong = New("password_too_long", http.StatusBadRequest, "password must have at most 72 bytes", false)
+	ErrCredentialExists = New("credential_exists", http.StatusConflict, "credential already exists", false)
+	ErrEncryptionKeyInvalid = New("encryption_key_invalid", http.StatusBadRequest, "encryption key must be a RSA public key pem of 2048 bits or more", false)
+	ErrEncryptionKeyMissing = New("encryption_key_missing", http.StatusBadRequest, "no encryption key registered for the client", false)
+	ErrTokenRevoked = New("token_revoked", http.StatusUnauthorized, "token revoked", false)
+	ErrKeyNotFound = New("signing_key_not_found", http.StatusInternalServerError, "signing key not found", false)
+	ErrKeyState = New("key_state_invalid", http.StatusInternalServerError, "invalid key state transition", false)
+	ErrKeyInvalid = New("key_invalid", http.StatusInternalServerError, "key without material or algorithm", false)
+	ErrAuditQueryUnavailable = New("audit_query_unavailable", http.StatusNotImplemented, "no audit sink supports the query (AUDIT_SINKS dynamo or memory)", false)
+)
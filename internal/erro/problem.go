@@ -0,0 +1,74 @@
+package erro
+
+import (
+	"context"
+	"errors"
+	"encoding/json"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+const ContentTypeProblem = "application/problem+json"
+
+var childLogger = log.With().Str("erro", "problem").Logger()
+
+// Problem converts the error to a RFC 7807 body, the detail of an untyped error is never exposed
+func Problem(ctx context.Context, err error) model.Problem {
+	e := As(err)
+
+	// the title is the one of the error variable, a specific message goes in the detail
+	title := e.Message
+	if e.base != nil {
+		title = e.base.Message
+	}
+
+	problem := model.Problem{
+		Type: "urn:problem-type:" + e.Code,
+		Title: title,
+		Status: e.Status,
+		Code: e.Code,
+		Retryable: e.Retryable,
+		Errors: e.Fields,
+	}
+	if e.Message != title {
+		problem.Detail = e.Message
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		problem.TraceID = spanContext.TraceID().String()
+	}
+
+	return problem
+}
+
+// ProblemResponse is the application/problem+json response of the error, the server errors are logged with the cause
+func ProblemResponse(ctx context.Context, err error) *model.HttpResponse {
+	problem := Problem(ctx, err)
+
+	// the error is recorded on the span of the adapter (or the router) that answers it
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err, trace.WithAttributes(attribute.String("error.code", problem.Code)))
+	span.SetStatus(codes.Error, problem.Code)
+
+	if problem.Status >= 500 {
+		childLogger.Error().Err(err).AnErr("cause", errors.Unwrap(err)).Str("code", problem.Code).Str("trace_id", problem.TraceID).Msg("server error")
+	}
+
+	body, _ := json.Marshal(problem)
+	response := &model.HttpResponse{
+		StatusCode: problem.Status,
+		Headers: map[string]string{
+			"Content-Type": ContentTypeProblem,
+		},
+		Body: string(body),
+	}
+	if problem.Retryable && problem.Status == 503 {
+		response.Headers["Retry-After"] = "1"
+	}
+
+	return response
+}
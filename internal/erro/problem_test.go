@@ -0,0 +1,115 @@
+package erro
+
+import (
+	"fmt"
+	"errors"
+	"context"
+	"testing"
+	"net/http"
+	"encoding/json"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+func TestProblem(t *testing.T) {
+	cases := []struct {
+		name		string
+		err			error
+		want		model.Problem
+	}{
+		{	name: "typed error",
+			err: ErrTokenExpired,
+			want: model.Problem{ Type: "urn:problem-type:token_expired", Title: "token expired", Status: http.StatusUnauthorized, Code: "token_expired" } },
+		{	name: "specific message in the detail",
+			err: ErrBadRequest.WithMessage("request body is empty"),
+			want: model.Problem{ Type: "urn:problem-type:invalid_request", Title: "invalid request body", Status: http.StatusBadRequest, Detail: "request body is empty", Code: "invalid_request" } },
+		{	name: "wrapped cause never exposed",
+			err: ErrQuery.Wrap(errors.New("dial tcp 10.0.0.1:443: i/o timeout")),
+			want: model.Problem{ Type: "urn:problem-type:storage_unavailable", Title: "query table error", Status: http.StatusServiceUnavailable, Code: "storage_unavailable", Retryable: true } },
+		{	name: "typed error through fmt.Errorf",
+			err: fmt.Errorf("load keys: %w", ErrKeyNotFound),
+			want: model.Problem{ Type: "urn:problem-type:signing_key_not_found", Title: ErrKeyNotFound.Message, Status: http.StatusInternalServerError, Code: "signing_key_not_found" } },
+		{	name: "untyped error is internal",
+			err: errors.New("secret value of the database"),
+			want: model.Problem{ Type: "urn:problem-type:internal_error", Title: "internal server error", Status: http.StatusInternalServerError, Code: "internal_error" } },
+		{	name: "validation fields",
+			err: ErrValidation.WithFields([]model.FieldError{{ Field: "user", Message: "is required" }}),
+			want: model.Problem{ Type: "urn:problem-type:validation_failed", Title: "request validation failed", Status: http.StatusBadRequest, Code: "validation_failed",
+								Errors: []model.FieldError{{ Field: "user", Message: "is required" }} } },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := Problem(context.Background(), c.err)
+			gotJson, _ := json.Marshal(got)
+			wantJson, _ := json.Marshal(c.want)
+			if string(gotJson) != string(wantJson) {
+				t.Errorf("Problem = %s, want %s", gotJson, wantJson)
+			}
+		})
+	}
+}
+
+func TestProblemTraceID(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("6720f1c27a8f3c1e5d1b9a2b3c4d5e6f")
+	spanID, _ := trace.SpanIDFromHex("1a2b3c4d5e6f7a8b")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{ TraceID: traceID, SpanID: spanID }))
+
+	if got := Problem(ctx, ErrNotFound).TraceID; got != traceID.String() {
+		t.Errorf("trace_id = %s, want %s", got, traceID.String())
+	}
+	if got := Problem(context.Background(), ErrNotFound).TraceID; got != "" {
+		t.Errorf("trace_id without span = %s, want empty", got)
+	}
+}
+
+func TestProblemResponse(t *testing.T) {
+	cases := []struct {
+		name			string
+		err				error
+		wantStatus		int
+		wantRetryAfter	string
+	}{
+		{ name: "client error", err: ErrInvalidCredential, wantStatus: http.StatusUnauthorized },
+		{ name: "retryable 503 has Retry-After", err: ErrInsert.Wrap(errors.New("throttled")), wantStatus: http.StatusServiceUnavailable, wantRetryAfter: "1" },
+		{ name: "server error without Retry-After", err: ErrInternal, wantStatus: http.StatusInternalServerError },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			response := ProblemResponse(context.Background(), c.err)
+			if response.StatusCode != c.wantStatus {
+				t.Errorf("status = %d, want %d", response.StatusCode, c.wantStatus)
+			}
+			if response.Headers["Content-Type"] != ContentTypeProblem {
+				t.Errorf("content type = %s, want %s", response.Headers["Content-Type"], ContentTypeProblem)
+			}
+			if response.Headers["Retry-After"] != c.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", response.Headers["Retry-After"], c.wantRetryAfter)
+			}
+
+			var problem model.Problem
+			if err := json.Unmarshal([]byte(response.Body), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Status != c.wantStatus {
+				t.Errorf("body status = %d, want %d", problem.Status, c.wantStatus)
+			}
+		})
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	derived := ErrBadRequest.WithMessage("request body is empty").Wrap(errors.New("eof"))
+	if !errors.Is(derived, ErrBadRequest) {
+		t.Error("a derived error must match its variable")
+	}
+	if errors.Is(derived, ErrValidation) {
+		t.Error("a derived error must not match an other variable")
+	}
+	if !errors.Is(fmt.Errorf("decode: %w", derived), ErrBadRequest) {
+		t.Error("the variable must match through fmt.Errorf")
+	}
+}
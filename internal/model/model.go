@@ -10,24 +10,129 @@ import (
 type AppServer struct {
 	InfoApp 		*InfoApp 		`json:"info_app"`
 	ConfigOTEL		*ConfigOTEL		`json:"otel_config"`
+	ConfigHttpServer	*ConfigHttpServer	`json:"http_server_config,omitempty"`
 }
 
+// InfoApp is built by configs.Load: default tag, config file (json names), SSM parameter or AppConfig (json names) and
+// the env tag variables, in this order. The validate tags are checked by configs.Validate, the redact fields are hidden by GetInfo
 type InfoApp struct {
-	AppName				string `json:"app_name,omitempty"`
-	AWSRegion			string `json:"aws_region,omitempty"`
-	ApiVersion			string `json:"version,omitempty"`
-	TableName			string `json:"table_name,omitempty"`
+	AppName				string `json:"app_name,omitempty" env:"APP_NAME"`
+	AWSRegion			string `json:"aws_region,omitempty" env:"REGION"`
+	ApiVersion			string `json:"version,omitempty" env:"VERSION"`
+	TableName			string `json:"table_name,omitempty" env:"TABLE_NAME"`
 	Env					string `json:"env,omitempty"`
-	SecretJwtKey		string `json:"secret_jwt_key,omitempty"`
+	SecretJwtKey		string `json:"secret_jwt_key,omitempty" env:"SECRET_JWT_KEY" validate:"required" redact:"true"`
 	AccountID			string `json:"account,omitempty"`
-	BucketNameRSAKey	string `json:"bucket_rsa_key,omitempty"`
-	FilePathRSA			string `json:"path_rsa_key,omitempty"`
-	FileNameRSAPrivKey	string `json:"file_name_rsa_private_key,omitempty"`
-	FileNameRSAPubKey	string `json:"file_name_rsa_public_key,omitempty"`
+	BucketNameRSAKey	string `json:"bucket_rsa_key,omitempty" env:"RSA_BUCKET_NAME_KEY"`
+	FilePathRSA			string `json:"path_rsa_key,omitempty" env:"RSA_FILE_PATH"`
+	FileNameRSAPrivKey	string `json:"file_name_rsa_private_key,omitempty" env:"RSA_PRIV_FILE_KEY"`
+	FileNameRSAPubKey	string `json:"file_name_rsa_public_key,omitempty" env:"RSA_PUB_FILE_KEY"`
+	IssuerURL			string `json:"issuer_url,omitempty" env:"ISSUER_URL" validate:"required"`
+	ServiceAudience		string `json:"service_audience,omitempty" env:"SERVICE_AUDIENCE" default:"lambda-go-autentication"`
+	AccessTokenAudiences	[]string `json:"access_token_audiences,omitempty" env:"ACCESS_TOKEN_AUDIENCES"`
+	KeyringPrefix		string `json:"keyring_prefix,omitempty" env:"KEYRING_PREFIX"`
+	KeyringTTL			int `json:"keyring_ttl,omitempty" env:"KEYRING_TTL" default:"300"`
+	KeyProvider			string `json:"key_provider,omitempty" env:"KEY_PROVIDER" default:"s3" validate:"required,oneof=s3 secretsmanager ssm file env"`
+	KMSKeyId			string `json:"kms_key_id,omitempty" env:"KMS_KEY_ID" redact:"true"`
+	KMSEndpoint			string `json:"kms_endpoint,omitempty" env:"KMS_ENDPOINT"`
+	FileNameJwePrivKey	string `json:"file_name_jwe_private_key,omitempty" env:"JWE_PRIV_FILE_KEY"`
+	FileNameJwePubKey	string `json:"file_name_jwe_public_key,omitempty" env:"JWE_PUB_FILE_KEY"`
+	SecretJwtKeyVersions	bool `json:"secret_jwt_key_versions,omitempty" env:"SECRET_JWT_KEY_VERSIONS"`
+	SecretJwtKeyTTL		int `json:"secret_jwt_key_ttl,omitempty" env:"SECRET_JWT_KEY_TTL" default:"300"`
+	AuthorizerScopeRoutes	map[string][]string `json:"authorizer_scope_routes,omitempty" env:"AUTHORIZER_SCOPE_ROUTES"`
+	CorsAllowedOrigins	[]string `json:"cors_allowed_origins,omitempty" env:"CORS_ALLOWED_ORIGINS"`
+	BootstrapAdminUser	string `json:"bootstrap_admin_user,omitempty" env:"BOOTSTRAP_ADMIN_USER"`
+	BootstrapAdminSecret	string `json:"bootstrap_admin_secret,omitempty" env:"BOOTSTRAP_ADMIN_SECRET" redact:"true"`
+	DatabaseBackend		string `json:"database_backend,omitempty" env:"DATABASE_BACKEND" default:"dynamo" validate:"required,oneof=dynamo postgres sqlite memory"`
+	DatabaseDSN			string `json:"-" env:"DATABASE_DSN" redact:"true"`
+	DatabaseDSNSecret	string `json:"database_dsn_secret,omitempty" env:"DATABASE_DSN_SECRET" redact:"true"`
+	AuditSinks			[]string `json:"audit_sinks,omitempty" env:"AUDIT_SINKS" default:"stdout"`
+	AuditTableName		string `json:"audit_table_name,omitempty" env:"AUDIT_TABLE_NAME"`
+	AuditStreamName		string `json:"audit_stream_name,omitempty" env:"AUDIT_STREAM_NAME"`
+	AuditRetentionDays	int `json:"audit_retention_days,omitempty" env:"AUDIT_RETENTION_DAYS" default:"90"`
+	LoginMaxFailures	int `json:"login_max_failures,omitempty" env:"LOGIN_MAX_FAILURES" default:"5"`
+	LoginLockoutSeconds	int `json:"login_lockout_seconds,omitempty" env:"LOGIN_LOCKOUT_SECONDS" default:"900"`
+}
+
+// HttpRequest is the request shared by every event type (APIGW REST and HTTP APIs, ALB, Function URL)
+type HttpRequest struct {
+	Method			string
+	Path			string
+	Resource		string				// route pattern, ex: /credentialScope/{id}
+	PathParameters	map[string]string
+	QueryParameters	map[string]string
+	Headers			map[string]string	// lower case names
+	Body			string				// already base64 decoded
+	DomainName		string
+	Stage			string
+	SourceIP		string
+	UserAgent		string
+	RequestID		string
+}
+
+type HttpResponse struct {
+	StatusCode		int
+	Headers			map[string]string
+	Body			string
+}
+
+// Problem is the RFC 7807 error body (application/problem+json)
+type Problem struct {
+	Type			string	`json:"type"`
+	Title			string	`json:"title"`
+	Status			int		`json:"status"`
+	Detail			string	`json:"detail,omitempty"`
+	Code			string	`json:"code"`
+	Retryable		bool	`json:"retryable"`
+	TraceID			string	`json:"trace_id,omitempty"`
+	Errors			[]FieldError	`json:"errors,omitempty"`
+}
+
+// FieldError is a validation error of a request field (json name)
+type FieldError struct {
+	Field			string	`json:"field"`
+	Message			string	`json:"message"`
+}
+
+// Request DTOs, decoded with unknown fields rejected and validated by the validate tags (pkg/util/validate.go).
+// The storage fields (ID, SK, Updated_at) are never accepted from the client
+
+type LoginRequest struct {
+	User			string		`json:"user" validate:"required,min=3,max=64,username"`
+	Password		string		`json:"password" validate:"required,max=128"`
+	Audience		string		`json:"audience,omitempty" validate:"max=256,audience"`
+	Scope			[]string	`json:"scope,omitempty" validate:"max=50,scope"`
+	Nonce			string		`json:"nonce,omitempty" validate:"max=256"`
+	Encrypt			bool		`json:"encrypt,omitempty"`
+}
+
+type SignInRequest struct {
+	User			string	`json:"user" validate:"required,min=3,max=64,username"`
+	Password		string	`json:"password" validate:"required,min=8,max=72"`
+	UsagePlan		string	`json:"usage_plan,omitempty" validate:"max=64"`
+	ApiKey			string	`json:"apikey,omitempty" validate:"max=128"`
+	SigningAlg		string	`json:"signing_alg,omitempty" validate:"oneof=RS256 ES256 ES384 EdDSA"`
+	EncryptionKey	string	`json:"encryption_key,omitempty" validate:"max=4096"`
+}
+
+type AddScopeRequest struct {
+	User			string		`json:"user" validate:"required,min=3,max=64,username"`
+	Scope			[]string	`json:"scope" validate:"required,max=50,scope"`
+}
+
+type ResourceServerRequest struct {
+	Audience		string		`json:"audience" validate:"required,max=256,audience"`
+	Scope			[]string	`json:"scope" validate:"required,max=50,scope"`
+}
+
+type TokenRequest struct {
+	Token			string	`json:"token" validate:"required,max=8192"`
+	Audience		string	`json:"audience,omitempty" validate:"max=256,audience"`
 }
 
 type Authentication struct {
 	Token			string	`json:"token,omitempty"`
+	IDToken			string	`json:"id_token,omitempty"`
 	TokenEncrypted	string	`json:"token_encrypted,omitempty"`
 	ExpirationTime	time.Time `json:"expiration_time,omitempty"`
 	ApiKey			string	`json:"api_key,omitempty"`
@@ -41,6 +146,13 @@ type Credential struct {
 	Token			string 	`json:"token,omitempty"`
 	UsagePlan		string 	`json:"usage_plan,omitempty"`
 	ApiKey			string 	`json:"apikey,omitempty"`
+	SigningAlg		string 	`json:"signing_alg,omitempty"`
+	EncryptionKey	string 	`json:"encryption_key,omitempty"`	// recipient public key (pem) of the encrypted tokens
+	Encrypt			bool 	`json:"-" dynamodbav:"-"`
+	Audience		string 	`json:"audience,omitempty" dynamodbav:"-"`
+	Scope			[]string	`json:"scope,omitempty" dynamodbav:"-"`
+	Nonce			string 	`json:"nonce,omitempty" dynamodbav:"-"`
+	Issuer			string 	`json:"-" dynamodbav:"-"`
 	Updated_at  	time.Time 	`json:"updated_at,omitempty"`
 }
 
@@ -52,6 +164,79 @@ type CredentialScope struct {
 	Updated_at  	time.Time 	`json:"updated_at,omitempty"`
 }
 
+// CredentialRole is a ROLE-<role> item of the USER- partition
+type CredentialRole struct {
+	ID				string		`json:"ID"`
+	SK				string		`json:"SK"`
+	User			string		`json:"user,omitempty"`
+	Role			string		`json:"role,omitempty"`
+	Updated_at  	time.Time 	`json:"updated_at,omitempty"`
+}
+
+// CredentialMFA is a MFA-<device> item of the USER- partition
+type CredentialMFA struct {
+	ID				string		`json:"ID"`
+	SK				string		`json:"SK"`
+	User			string		`json:"user,omitempty"`
+	Type			string		`json:"type,omitempty"`
+	Updated_at  	time.Time 	`json:"updated_at,omitempty"`
+}
+
+// LoginFailures is the LOCKOUT item of the USER- partition, the failed logins counted until expires_at
+type LoginFailures struct {
+	ID				string		`json:"ID"`
+	SK				string		`json:"SK"`
+	User			string		`json:"user,omitempty"`
+	Failures		int			`json:"failures"`
+	LockedUntil		int64		`json:"locked_until,omitempty" dynamodbav:"locked_until,omitempty"`	// unix seconds, 0 when not locked
+	ExpiresAt		int64		`json:"-" dynamodbav:"expires_at,omitempty"`	// unix seconds, the table TTL attribute
+	Updated_at  	time.Time 	`json:"updated_at,omitempty"`
+}
+
+// CredentialPartition is the USER- partition (credential, scopes, roles, mfa and failed logins) loaded by a single query
+type CredentialPartition struct {
+	Credential		Credential
+	CredentialScope	CredentialScope
+	Roles			[]CredentialRole
+	MFA				[]CredentialMFA
+	LoginFailures	LoginFailures
+}
+
+type ResourceServer struct {
+	ID				string		`json:"ID"`
+	SK				string		`json:"SK"`
+	Audience		string		`json:"audience,omitempty"`
+	Scope			[]string	`json:"scope,omitempty"`
+	Updated_at  	time.Time 	`json:"updated_at,omitempty"`
+}
+
+type RevokedToken struct {
+	ID				string		`json:"ID"`
+	SK				string		`json:"SK"`
+	JwtId			string		`json:"jwt_id"`
+	ExpiresAt		int64		`json:"expires_at" dynamodbav:"expires_at"`	// unix seconds, the table TTL attribute
+	Updated_at  	time.Time 	`json:"updated_at,omitempty"`
+}
+
+// AuditEvent is a security event (login, scope grant, revocation, key rotation, admin action) written to the audit sinks,
+// in the DynamoDB audit table the partition is AUDIT-<subject> and the SK sorts the events by time
+type AuditEvent struct {
+	ID				string				`json:"ID,omitempty"`
+	SK				string				`json:"SK,omitempty"`
+	EventId			string				`json:"event_id"`
+	EventType		string				`json:"event_type"`
+	Outcome			string				`json:"outcome"`
+	Actor			string				`json:"actor,omitempty"`
+	Subject			string				`json:"subject,omitempty"`
+	SourceIP		string				`json:"source_ip,omitempty"`
+	UserAgent		string				`json:"user_agent,omitempty"`
+	RequestID		string				`json:"request_id,omitempty"`
+	TraceID			string				`json:"trace_id,omitempty"`
+	Detail			map[string]string	`json:"detail,omitempty"`
+	Timestamp		time.Time			`json:"timestamp"`
+	ExpiresAt		int64				`json:"-" dynamodbav:"expires_at,omitempty"`	// unix seconds, the table TTL attribute
+}
+
 type JwtData struct {
 	TokenUse	string 	`json:"token_use"`
 	ISS			string 	`json:"iss"`
@@ -62,14 +247,65 @@ type JwtData struct {
 	jwt.RegisteredClaims
 }
 
+type IDTokenData struct {
+	Nonce				string	`json:"nonce,omitempty"`
+	AuthTime			int64	`json:"auth_time"`
+	AtHash				string	`json:"at_hash"`
+	PreferredUsername	string	`json:"preferred_username,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type UserInfo struct {
+	Sub					string	`json:"sub"`
+	PreferredUsername	string	`json:"preferred_username,omitempty"`
+	UsagePlan			string	`json:"usage_plan,omitempty"`
+	UpdatedAt			int64	`json:"updated_at,omitempty"`
+}
+
+type Jwk struct {
+	Kty		string	`json:"kty"`
+	Kid		string	`json:"kid"`
+	Use		string	`json:"use"`
+	Alg		string	`json:"alg"`
+	N		string	`json:"n,omitempty"`
+	E		string	`json:"e,omitempty"`
+	Crv		string	`json:"crv,omitempty"`
+	X		string	`json:"x,omitempty"`
+	Y		string	`json:"y,omitempty"`
+}
+
+type Jwks struct {
+	Keys	[]Jwk	`json:"keys"`
+}
+
+type OpenIDConfiguration struct {
+	Issuer								string		`json:"issuer"`
+	JwksURI								string		`json:"jwks_uri"`
+	UserinfoEndpoint					string		`json:"userinfo_endpoint"`
+	ScopesSupported						[]string	`json:"scopes_supported,omitempty"`
+	SubjectTypesSupported				[]string	`json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported	[]string	`json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported						[]string	`json:"claims_supported,omitempty"`
+}
+
+// ConfigHttpServer is used only by the standalone http server (RUN_MODE=http), the timeouts are in seconds
+type ConfigHttpServer struct {
+	Port				int		`json:"port" env:"HTTP_PORT" default:"8080"`
+	ReadHeaderTimeout	int		`json:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" default:"5"`
+	ReadTimeout			int		`json:"read_timeout" env:"HTTP_READ_TIMEOUT" default:"15"`
+	WriteTimeout		int		`json:"write_timeout" env:"HTTP_WRITE_TIMEOUT" default:"30"`
+	IdleTimeout			int		`json:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" default:"60"`
+	RequestTimeout		int		`json:"request_timeout" env:"HTTP_REQUEST_TIMEOUT" default:"25"`
+	ShutdownTimeout		int		`json:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT" default:"20"`
+	MaxBodyBytes		int64	`json:"max_body_bytes" env:"HTTP_MAX_BODY_BYTES" default:"1048576"`
+	TLSCertFile			string	`json:"tls_cert_file,omitempty" env:"TLS_CERT_FILE"`
+	TLSKeyFile			string	`json:"tls_key_file,omitempty" env:"TLS_KEY_FILE"`
+}
+
 type ConfigOTEL struct {
-	OtelExportEndpoint		string
-	TimeInterval            int64    `mapstructure:"TimeInterval"`
-	TimeAliveIncrementer    int64    `mapstructure:"RandomTimeAliveIncrementer"`
-	TotalHeapSizeUpperBound int64    `mapstructure:"RandomTotalHeapSizeUpperBound"`
-	ThreadsActiveUpperBound int64    `mapstructure:"RandomThreadsActiveUpperBound"`
-	CpuUsageUpperBound      int64    `mapstructure:"RandomCpuUsageUpperBound"`
-	SampleAppPorts          []string `mapstructure:"SampleAppPorts"`
+	OtelExportEndpoint		string	`json:"otel_export_endpoint,omitempty" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	MetricsExporter			string	`json:"metrics_exporter,omitempty" env:"METRICS_EXPORTER" default:"otel"`
+	MetricsNamespace		string	`json:"metrics_namespace,omitempty" env:"METRICS_NAMESPACE"`
 }
 
 type RSA_Key struct{
@@ -0,0 +1,93 @@
+package adapter
+
+import(
+	"context"
+	"strconv"
+	"net/http"
+	"encoding/json"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lambda-go-autentication/internal/usecase/audit"
+
+	"github.com/lambda-go-autentication/pkg/observability"
+	"github.com/lambda-go-autentication/pkg/util"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/erro"
+)
+
+var childLogger = log.With().Str("adapter", "AdapterAudit").Logger()
+
+// the events returned by QueryEvents without the limit parameter, and the maximum accepted
+const (
+	defaultQueryLimit	= 20
+	maxQueryLimit		= 100
+)
+
+type AdapterAudit struct{
+	useCaseAudit	*audit.UseCaseAudit
+}
+
+func NewAdapterAudit(useCaseAudit *audit.UseCaseAudit) *AdapterAudit{
+	childLogger.Debug().Msg("NewAdapterAudit")
+
+	return &AdapterAudit{
+		useCaseAudit: useCaseAudit,
+	}
+}
+
+// ApiErrorResponse is the RFC 7807 (application/problem+json) response of the error, the status comes from the erro type
+func ApiErrorResponse(ctx context.Context, err error) (*model.HttpResponse, error){
+	return erro.ProblemResponse(ctx, err), nil
+}
+
+func ApiHandlerResponse(statusCode int, body interface{}) (*model.HttpResponse, error){
+	stringBody, err := json.Marshal(&body)
+	if err != nil {
+		return nil, erro.ErrUnmarshal
+	}
+
+	return &model.HttpResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: string(stringBody),
+	}, nil
+}
+
+// QueryEvents returns the recent audit events of the user (/audit/{id}?limit=20), the newest first
+func (h *AdapterAudit) QueryEvents(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
+	childLogger.Debug().Msg("QueryEvents")
+
+	ctx, span := observability.Span(ctx, "adapter.QueryEvents")
+	defer span.End()
+
+	id := req.PathParameters["id"]
+	if len(id) == 0 {
+		return ApiErrorResponse(ctx, erro.ErrQueryEmpty)
+	}
+	if err := util.ValidateVar("id", id, "max=64,username"); err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	limit := defaultQueryLimit
+	if req.QueryParameters["limit"] != "" {
+		parsed, err := strconv.Atoi(req.QueryParameters["limit"])
+		if err != nil || parsed < 1 || parsed > maxQueryLimit {
+			return ApiErrorResponse(ctx, erro.ErrBadRequest.WithMessage("limit must be between 1 and " + strconv.Itoa(maxQueryLimit)))
+		}
+		limit = parsed
+	}
+
+	response, err := h.useCaseAudit.QueryEvents(ctx, id, limit)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+	return handlerResponse, nil
+}
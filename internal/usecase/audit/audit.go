@@ -0,0 +1,125 @@
+package audit
+
+import(
+	"time"
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lambda-go-autentication/pkg/observability"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/usecase/audit/sink"
+)
+
+var childLogger = log.With().Str("usecase", "audit").Logger()
+
+// event types of the audit log
+const (
+	EventLoginSuccess	= "login.success"
+	EventLoginFailure	= "login.failure"
+	EventLoginLockout	= "login.lockout"
+	EventSignIn			= "credential.sign_in"
+	EventScopeGrant		= "scope.grant"
+	EventScopeRevoke	= "scope.revoke"
+	EventTokenRefresh	= "token.refresh"
+	EventTokenRevoke	= "token.revoke"
+	EventKeyRotation	= "key.rotation"
+	EventAdminAction	= "admin.action"
+)
+
+const (
+	OutcomeSuccess	= "success"
+	OutcomeFailure	= "failure"
+)
+
+type requestKey struct{}
+type actorKey struct{}
+
+type request struct {
+	sourceIP	string
+	userAgent	string
+	requestID	string
+}
+
+// WithRequest keeps the source ip, the user agent and the request id of the request (APIGW request context) for the events recorded below
+func WithRequest(ctx context.Context, httpRequest model.HttpRequest) context.Context {
+	return context.WithValue(ctx, requestKey{}, request{	sourceIP: httpRequest.SourceIP,
+															userAgent: httpRequest.UserAgent,
+															requestID: httpRequest.RequestID })
+}
+
+// WithActor keeps the authenticated user (bearer token) as the actor of the events recorded below
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// UseCaseAudit writes each event to all the sinks, the first sink with a query (dynamo or memory) answers QueryEvents
+type UseCaseAudit struct{
+	sinks	[]sink.Sink
+	querier	sink.Querier
+}
+
+func NewUseCaseAudit(sinks ...sink.Sink) *UseCaseAudit{
+	childLogger.Debug().Msg("NewUseCaseAudit")
+
+	useCaseAudit := UseCaseAudit{ sinks: sinks }
+	for _, s := range sinks {
+		if querier, ok := s.(sink.Querier); ok {
+			useCaseAudit.querier = querier
+			break
+		}
+	}
+	return &useCaseAudit
+}
+
+// Record completes the event (id, time, outcome, actor, request and trace) and writes it, the error of the operation
+// audited sets the failure outcome and its code. A sink failure is logged and never fails the operation
+func (u *UseCaseAudit) Record(ctx context.Context, event model.AuditEvent, err error) {
+	if u == nil {
+		return
+	}
+
+	event.EventId = uuid.New().String()
+	event.Timestamp = time.Now().UTC()
+	event.Outcome = OutcomeSuccess
+	if err != nil {
+		event.Outcome = OutcomeFailure
+		if event.Detail == nil {
+			event.Detail = map[string]string{}
+		}
+		event.Detail["error"] = erro.As(err).Code
+	}
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && event.Actor == "" {
+		event.Actor = actor
+	}
+	if request, ok := ctx.Value(requestKey{}).(request); ok {
+		event.SourceIP = request.sourceIP
+		event.UserAgent = request.userAgent
+		event.RequestID = request.requestID
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		event.TraceID = spanContext.TraceID().String()
+	}
+
+	for _, s := range u.sinks {
+		if err := s.Write(ctx, event); err != nil {
+			childLogger.Error().Err(err).Str("event_type", event.EventType).Str("event_id", event.EventId).Msg("error audit sink Write")
+		}
+	}
+}
+
+// QueryEvents returns the recent events of the subject, the newest first
+func (u *UseCaseAudit) QueryEvents(ctx context.Context, subject string, limit int) ([]model.AuditEvent, error){
+	childLogger.Debug().Msg("QueryEvents")
+
+	ctx, span := observability.Span(ctx, "usecase.QueryEvents")
+	defer span.End()
+
+	if u.querier == nil {
+		return nil, erro.ErrAuditQueryUnavailable
+	}
+	return u.querier.QueryEvents(ctx, subject, limit)
+}
@@ -0,0 +1,114 @@
+package sink
+
+import(
+	"time"
+	"context"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/pkg/observability"
+	database "github.com/lambda-go-autentication/pkg/database/dynamo"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// sortKeyLayout is fixed width (UTC, 9 fraction digits): RFC3339Nano drops the trailing zeros of the fraction
+// and "10:00:05Z" sorts after "10:00:05.5Z", the newest first query would return the events out of order
+const sortKeyLayout = "2006-01-02T15:04:05.000000000Z"
+
+// sortKey is the SK of an event, the lexical order of the keys is the order of the events
+func sortKey(event model.AuditEvent) string {
+	return event.Timestamp.UTC().Format(sortKeyLayout) + "#" + event.EventId
+}
+
+// DynamoSink writes the events to the audit table (AUDIT_TABLE_NAME): partition AUDIT-<subject>,
+// SK <timestamp>#<event id> and expires_at (the table TTL attribute) after AUDIT_RETENTION_DAYS
+type DynamoSink struct{
+	TableName	*string
+	Repository	*database.Database
+	retention	time.Duration
+}
+
+func NewDynamoSink(	repository *database.Database,
+					tableName *string,
+					retention time.Duration) *DynamoSink{
+	childLogger.Debug().Msg("NewDynamoSink")
+
+	return &DynamoSink{
+		Repository: repository,
+		TableName: tableName,
+		retention: retention,
+	}
+}
+
+func (s *DynamoSink) Write(ctx context.Context, event model.AuditEvent) error{
+	childLogger.Debug().Msg("Write")
+
+	ctx, span := observability.Span(ctx, "repo.WriteAuditEvent")
+	defer span.End()
+
+	event.ID = "AUDIT-" + event.Subject
+	event.SK = sortKey(event)
+	event.ExpiresAt = event.Timestamp.Add(s.retention).Unix()
+
+	item, err := attributevalue.MarshalMap(event)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error MarshalMap")
+		return erro.ErrUnmarshal
+	}
+
+	_, err = s.Repository.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: s.TableName,
+		Item: item,
+	})
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error PutItem")
+		return erro.ErrInsert
+	}
+
+	return nil
+}
+
+func (s *DynamoSink) QueryEvents(ctx context.Context, subject string, limit int) ([]model.AuditEvent, error){
+	childLogger.Debug().Msg("QueryEvents")
+
+	ctx, span := observability.Span(ctx, "repo.QueryAuditEvents")
+	defer span.End()
+
+	expr, err := expression.NewBuilder().
+							WithKeyCondition(expression.Key("ID").Equal(expression.Value("AUDIT-" + subject))).
+							Build()
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error NewBuilder")
+		return nil, erro.ErrPreparedQuery
+	}
+
+	// the SK starts with the timestamp, the newest events come first
+	key := &dynamodb.QueryInput{	TableName:                 s.TableName,
+									ExpressionAttributeNames:  expr.Names(),
+									ExpressionAttributeValues: expr.Values(),
+									KeyConditionExpression:    expr.KeyCondition(),
+									ScanIndexForward:		   aws.Bool(false),
+									Limit:					   aws.Int32(int32(limit)),
+	}
+
+	result, err := s.Repository.Client.Query(ctx, key)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error Query")
+		return nil, erro.ErrQuery
+	}
+
+	events := []model.AuditEvent{}
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &events); err != nil {
+		childLogger.Error().Err(err).Msg("error UnmarshalListOfMaps")
+		return nil, erro.ErrUnmarshal
+	}
+	for i := range events {
+		events[i].ID, events[i].SK = "", ""
+	}
+
+	return events, nil
+}
@@ -0,0 +1,70 @@
+package sink
+
+import(
+	"sync"
+	"context"
+
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+// MemorySink keeps the last events of each subject in memory (local runs, DATABASE_BACKEND=memory).
+// The subjects are bounded too, the one written least recently is dropped, the subjects come from the
+// requests (failed logins of unknown users) and must not grow the memory
+type MemorySink struct{
+	mutex		sync.RWMutex
+	size		int
+	maxSubjects	int
+	events		map[string][]model.AuditEvent
+	subjects	[]string	// the least recently written first
+}
+
+func NewMemorySink(size int, maxSubjects int) *MemorySink{
+	childLogger.Debug().Msg("NewMemorySink")
+
+	return &MemorySink{
+		size: size,
+		maxSubjects: maxSubjects,
+		events: map[string][]model.AuditEvent{},
+	}
+}
+
+func (s *MemorySink) Write(ctx context.Context, event model.AuditEvent) error{
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	events := append(s.events[event.Subject], event)
+	if len(events) > s.size {
+		events = events[len(events) - s.size:]
+	}
+	s.events[event.Subject] = events
+
+	s.touch(event.Subject)
+	if len(s.subjects) > s.maxSubjects {
+		delete(s.events, s.subjects[0])
+		s.subjects = s.subjects[1:]
+	}
+	return nil
+}
+
+// touch moves the subject to the end of the written order
+func (s *MemorySink) touch(subject string) {
+	for i, written := range s.subjects {
+		if written == subject {
+			s.subjects = append(s.subjects[:i], s.subjects[i+1:]...)
+			break
+		}
+	}
+	s.subjects = append(s.subjects, subject)
+}
+
+func (s *MemorySink) QueryEvents(ctx context.Context, subject string, limit int) ([]model.AuditEvent, error){
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	stored := s.events[subject]
+	events := []model.AuditEvent{}
+	for i := len(stored) - 1; i >= 0 && len(events) < limit; i-- {
+		events = append(events, stored[i])
+	}
+	return events, nil
+}
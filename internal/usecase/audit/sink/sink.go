@@ -0,0 +1,69 @@
+package sink
+
+import(
+	"time"
+	"errors"
+	"context"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/lambda-go-autentication/internal/model"
+	database "github.com/lambda-go-autentication/pkg/database/dynamo"
+)
+
+var childLogger = log.With().Str("sink", "audit").Logger()
+
+// Sink writes the audit events, implemented by StdoutSink, DynamoSink, StreamSink and MemorySink
+type Sink interface {
+	Write(ctx context.Context, event model.AuditEvent) error
+}
+
+// Querier is a sink able to return the recent events of a subject, the newest first
+type Querier interface {
+	QueryEvents(ctx context.Context, subject string, limit int) ([]model.AuditEvent, error)
+}
+
+var (
+	_ Sink = (*StdoutSink)(nil)
+	_ Sink = (*DynamoSink)(nil)
+	_ Sink = (*StreamSink)(nil)
+	_ Sink = (*MemorySink)(nil)
+	_ Querier = (*DynamoSink)(nil)
+	_ Querier = (*MemorySink)(nil)
+)
+
+// the events kept by subject and the subjects kept in the memory sink
+const (
+	memoryEventsBySubject = 100
+	memorySubjects = 1000
+)
+
+// NewSinks creates the sinks of AUDIT_SINKS (stdout, dynamo, stream or memory)
+func NewSinks(ctx context.Context, infoApp *model.InfoApp, configAWS *aws.Config) ([]Sink, error) {
+	childLogger.Debug().Msg("NewSinks")
+
+	sinks := []Sink{}
+	for _, name := range infoApp.AuditSinks {
+		switch name {
+			case "stdout":
+				sinks = append(sinks, NewStdoutSink(os.Stdout))
+			case "dynamo":
+				database, err := database.NewDatabase(ctx, configAWS)
+				if err != nil {
+					return nil, err
+				}
+				retention := time.Duration(infoApp.AuditRetentionDays) * 24 * time.Hour
+				sinks = append(sinks, NewDynamoSink(database, &infoApp.AuditTableName, retention))
+			case "stream":
+				// stand-in of the Firehose client, the records are written to stdout
+				sinks = append(sinks, NewStreamSink(NewStreamStandIn(os.Stdout), infoApp.AuditStreamName))
+			case "memory":
+				sinks = append(sinks, NewMemorySink(memoryEventsBySubject, memorySubjects))
+			default:
+				return nil, errors.New("audit sink not supported: " + name)
+		}
+	}
+	return sinks, nil
+}
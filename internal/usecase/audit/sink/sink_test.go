@@ -0,0 +1,89 @@
+package sink
+
+import (
+	"sort"
+	"time"
+	"context"
+	"testing"
+
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+func TestSortKeyOrder(t *testing.T) {
+	base := time.Date(2024, 5, 1, 10, 0, 5, 0, time.UTC)
+	sao_paulo := time.FixedZone("BRT", -3*3600)
+
+	// the timestamps in the order of the events, whatever the zone and the digits of the fraction
+	timestamps := []time.Time{
+		base,
+		base.Add(500 * time.Millisecond),
+		base.Add(510 * time.Millisecond),
+		base.Add(time.Second).In(sao_paulo),
+		base.Add(time.Second + time.Nanosecond),
+		base.Add(time.Hour).In(sao_paulo),
+	}
+
+	keys := []string{}
+	for i, timestamp := range timestamps {
+		keys = append(keys, sortKey(model.AuditEvent{ EventId: string(rune('a' + i)), Timestamp: timestamp }))
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Errorf("the keys do not sort as the events: %v", keys)
+	}
+
+	if got, want := sortKey(model.AuditEvent{ EventId: "e1", Timestamp: base.In(sao_paulo) }), "2024-05-01T10:00:05.000000000Z#e1"; got != want {
+		t.Errorf("sortKey = %s, want %s", got, want)
+	}
+}
+
+func TestMemorySink(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name		string
+		writes		[]string	// the subject of each event, in order
+		subject		string
+		limit		int
+		want		[]string	// the event ids returned, the newest first
+	}{
+		{ name: "newest first", writes: []string{"u1", "u1", "u1"}, subject: "u1", limit: 10, want: []string{"2", "1", "0"} },
+		{ name: "limit", writes: []string{"u1", "u1", "u1"}, subject: "u1", limit: 2, want: []string{"2", "1"} },
+		{ name: "events by subject capped", writes: []string{"u1", "u1", "u1", "u1"}, subject: "u1", limit: 10, want: []string{"3", "2", "1"} },
+		{ name: "unknown subject", writes: []string{"u1"}, subject: "u9", limit: 10, want: []string{} },
+		{ name: "least recently written subject dropped", writes: []string{"u1", "u2", "u3"}, subject: "u1", limit: 10, want: []string{} },
+		{ name: "written subject kept", writes: []string{"u1", "u2", "u1", "u3"}, subject: "u1", limit: 10, want: []string{"2", "0"} },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			memorySink := NewMemorySink(3, 2)
+			for i, subject := range c.writes {
+				event := model.AuditEvent{ EventId: string(rune('0' + i)), Subject: subject, Timestamp: base.Add(time.Duration(i) * time.Second) }
+				if err := memorySink.Write(ctx, event); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			events, err := memorySink.QueryEvents(ctx, c.subject, c.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, event := range events {
+				got = append(got, event.EventId)
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("events = %v, want %v", got, c.want)
+			}
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Errorf("events = %v, want %v", got, c.want)
+				}
+			}
+			if len(memorySink.events) > 2 {
+				t.Errorf("subjects kept = %d, want at most 2", len(memorySink.events))
+			}
+		})
+	}
+}
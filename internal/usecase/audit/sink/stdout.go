@@ -0,0 +1,42 @@
+package sink
+
+import(
+	"io"
+	"sync"
+	"context"
+	"encoding/json"
+
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+// StdoutSink writes one json line by event, log_type audit separates them from the application logs (ex: a subscription filter)
+type StdoutSink struct{
+	mutex	sync.Mutex
+	writer	io.Writer
+}
+
+type stdoutLine struct {
+	LogType		string	`json:"log_type"`
+	model.AuditEvent
+}
+
+func NewStdoutSink(writer io.Writer) *StdoutSink{
+	childLogger.Debug().Msg("NewStdoutSink")
+
+	return &StdoutSink{
+		writer: writer,
+	}
+}
+
+func (s *StdoutSink) Write(ctx context.Context, event model.AuditEvent) error{
+	data, err := json.Marshal(stdoutLine{ LogType: "audit", AuditEvent: event })
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, err = s.writer.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,74 @@
+package sink
+
+import(
+	"io"
+	"sync"
+	"context"
+	"encoding/json"
+
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+// StreamPublisher sends the records to a delivery stream, the interface of a Kinesis Firehose (PutRecordBatch) or
+// Kinesis Data Streams (PutRecords) client
+type StreamPublisher interface {
+	PutRecordBatch(ctx context.Context, streamName string, records [][]byte) error
+}
+
+// StreamSink sends each event as a json record to the stream (AUDIT_STREAM_NAME)
+type StreamSink struct{
+	publisher	StreamPublisher
+	streamName	string
+}
+
+func NewStreamSink(publisher StreamPublisher, streamName string) *StreamSink{
+	childLogger.Debug().Msg("NewStreamSink")
+
+	return &StreamSink{
+		publisher: publisher,
+		streamName: streamName,
+	}
+}
+
+func (s *StreamSink) Write(ctx context.Context, event model.AuditEvent) error{
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	// the delivery stream separates the records by the new line (ex: Firehose to S3)
+	return s.publisher.PutRecordBatch(ctx, s.streamName, [][]byte{append(data, '\n')})
+}
+
+// StreamStandIn is the publisher used while the Firehose client is not part of the build, each record becomes a line
+// with the stream name, so the delivery can be checked in the logs
+type StreamStandIn struct{
+	mutex	sync.Mutex
+	writer	io.Writer
+}
+
+type standInLine struct {
+	DeliveryStream	string			`json:"delivery_stream"`
+	Record			json.RawMessage	`json:"record"`
+}
+
+func NewStreamStandIn(writer io.Writer) *StreamStandIn{
+	return &StreamStandIn{
+		writer: writer,
+	}
+}
+
+func (p *StreamStandIn) PutRecordBatch(ctx context.Context, streamName string, records [][]byte) error{
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, record := range records {
+		data, err := json.Marshal(standInLine{ DeliveryStream: streamName, Record: json.RawMessage(record) })
+		if err != nil {
+			return err
+		}
+		if _, err := p.writer.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
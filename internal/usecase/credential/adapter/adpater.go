@@ -2,19 +2,19 @@ package adapter
 
 import(	
 	"context"
+	"strings"
 	"net/http"
 	"encoding/json"
 
 	"github.com/rs/zerolog/log"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	
 	"github.com/lambda-go-autentication/internal/usecase/credential"
 
+	"github.com/lambda-go-autentication/configs"
 	"github.com/lambda-go-autentication/pkg/observability"
+	"github.com/lambda-go-autentication/pkg/util"
 	"github.com/lambda-go-autentication/internal/model"
 	"github.com/lambda-go-autentication/internal/erro"
-
-	"github.com/aws/aws-lambda-go/events"
 )
 
 var childLogger = log.With().Str("adapter", "AdapterCredential").Logger()
@@ -34,22 +34,18 @@ func NewAdapterCredential(	appServer	*model.AppServer,
 	}
 }
 
-func (h *AdapterCredential) UnhandledMethod() (*events.APIGatewayProxyResponse, error){
-	return ApiHandlerResponse(http.StatusMethodNotAllowed, MessageBody{ErrorMsg: aws.String(erro.ErrMethodNotAllowed.Error())})
-}
-
-type MessageBody struct {
-	ErrorMsg 	*string `json:"error,omitempty"`
-	Msg 		*string `json:"message,omitempty"`
+// ApiErrorResponse is the RFC 7807 (application/problem+json) response of the error, the status comes from the erro type
+func ApiErrorResponse(ctx context.Context, err error) (*model.HttpResponse, error){
+	return erro.ProblemResponse(ctx, err), nil
 }
 
-func ApiHandlerResponse(statusCode int, body interface{}) (*events.APIGatewayProxyResponse, error){
+func ApiHandlerResponse(statusCode int, body interface{}) (*model.HttpResponse, error){
 	stringBody, err := json.Marshal(&body)
 	if err != nil {
 		return nil, erro.ErrUnmarshal
 	}
 
-	return &events.APIGatewayProxyResponse{
+	return &model.HttpResponse{
 		StatusCode: statusCode,
 		Headers: map[string]string{
 			"Content-Type": "application/json",
@@ -58,134 +54,267 @@ func ApiHandlerResponse(statusCode int, body interface{}) (*events.APIGatewayPro
 	}, nil
 }
 
-func (h *AdapterCredential) SignIn(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+func (h *AdapterCredential) SignIn(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
 	childLogger.Debug().Msg("SignIn")
 
-	span := observability.Span(ctx, "adapter.SignIn")	
+	ctx, span := observability.Span(ctx, "adapter.SignIn")	
     defer span.End()
 
-	var credential model.Credential
-    if err := json.Unmarshal([]byte(req.Body), &credential); err != nil {
-        return ApiHandlerResponse(http.StatusBadRequest, MessageBody{ErrorMsg: aws.String(err.Error())})
-    }
+	var request model.SignInRequest
+	if err := util.DecodeRequest(req.Body, &request); err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	credential := model.Credential{	User: request.User,
+									Password: request.Password,
+									UsagePlan: request.UsagePlan,
+									ApiKey: request.ApiKey,
+									SigningAlg: request.SigningAlg,
+									EncryptionKey: request.EncryptionKey }
 
 	response, err := h.useCaseCredential.SignIn(ctx, credential)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusBadRequest, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
 	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusInternalServerError, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 	return handlerResponse, nil
 }
 
-func (h *AdapterCredential) Login(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+func (h *AdapterCredential) Login(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
 	childLogger.Debug().Msg("Login")
 
-	span := observability.Span(ctx, "adapter.login")	
+	ctx, span := observability.Span(ctx, "adapter.login")	
     defer span.End()
 
-	var credential model.Credential
-    if err := json.Unmarshal([]byte(req.Body), &credential); err != nil {
-        return ApiHandlerResponse(http.StatusBadRequest, MessageBody{ErrorMsg: aws.String(err.Error())})
-    }
+	var request model.LoginRequest
+	if err := util.DecodeRequest(req.Body, &request); err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	credential := model.Credential{	User: request.User,
+									Password: request.Password,
+									Audience: request.Audience,
+									Scope: request.Scope,
+									Nonce: request.Nonce,
+									Encrypt: request.Encrypt,
+									Issuer: util.GetIssuerURL(h.appServer.InfoApp) }
 
 	response, err := h.useCaseCredential.Login(ctx, credential)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusNotFound, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
 	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusInternalServerError, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 	return handlerResponse, nil
 }
 
-func (h *AdapterCredential) LoginRSA(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+func (h *AdapterCredential) LoginRSA(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
 	childLogger.Debug().Msg("LoginRSA")
 
-	span := observability.Span(ctx, "adapter.loginRSA")	
+	ctx, span := observability.Span(ctx, "adapter.loginRSA")	
     defer span.End()
 
-	var credential model.Credential
-    if err := json.Unmarshal([]byte(req.Body), &credential); err != nil {
-        return ApiHandlerResponse(http.StatusBadRequest, MessageBody{ErrorMsg: aws.String(err.Error())})
-    }
+	var request model.LoginRequest
+	if err := util.DecodeRequest(req.Body, &request); err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	credential := model.Credential{	User: request.User,
+									Password: request.Password,
+									Audience: request.Audience,
+									Scope: request.Scope,
+									Nonce: request.Nonce,
+									Encrypt: request.Encrypt,
+									Issuer: util.GetIssuerURL(h.appServer.InfoApp) }
 
 	response, err := h.useCaseCredential.LoginRSA(ctx, credential)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusNotFound, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
 	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusInternalServerError, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 	return handlerResponse, nil
 }
 
-func (h *AdapterCredential) AddScope(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+func (h *AdapterCredential) AddScope(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
 	childLogger.Debug().Msg("AddScope")
 
-	span := observability.Span(ctx, "adapter.addScope")	
+	ctx, span := observability.Span(ctx, "adapter.addScope")	
     defer span.End()
 
-	var credential_scope model.CredentialScope
-    if err := json.Unmarshal([]byte(req.Body), &credential_scope); err != nil {
-        return ApiHandlerResponse(http.StatusBadRequest, MessageBody{ErrorMsg: aws.String(err.Error())})
-    }
+	var request model.AddScopeRequest
+	if err := util.DecodeRequest(req.Body, &request); err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	credential_scope := model.CredentialScope{ User: request.User, Scope: request.Scope }
 
 	response, err := h.useCaseCredential.AddScope(ctx, credential_scope)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusBadRequest, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
 	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusInternalServerError, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 	return handlerResponse, nil
 }
 
-func (h *AdapterCredential) QueryCredentialScope(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+func (h *AdapterCredential) QueryCredentialScope(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
 	childLogger.Debug().Msg("QueryCredentialScope")
 	
-	span := observability.Span(ctx, "adapter.QueryCredentialScope")	
+	ctx, span := observability.Span(ctx, "adapter.QueryCredentialScope")	
     defer span.End()
 
 	id := req.PathParameters["id"]
 	if len(id) == 0 {
-		return ApiHandlerResponse(http.StatusBadRequest, MessageBody{ErrorMsg: aws.String(erro.ErrQueryEmpty.Error())})
+		return ApiErrorResponse(ctx, erro.ErrQueryEmpty)
+	}
+	if err := util.ValidateVar("id", id, "max=64,username"); err != nil {
+		return ApiErrorResponse(ctx, err)
 	}
 
 	credential := model.Credential{User: id}
 
 	response, err := h.useCaseCredential.QueryCredentialScope(ctx, credential)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusNotFound, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
-	childLogger.Debug().Msg("QueryCredentialScope....4")
+	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+	return handlerResponse, nil
+}
+
+func (h *AdapterCredential) AddResourceServer(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
+	childLogger.Debug().Msg("AddResourceServer")
+
+	ctx, span := observability.Span(ctx, "adapter.AddResourceServer")	
+    defer span.End()
+
+	var request model.ResourceServerRequest
+	if err := util.DecodeRequest(req.Body, &request); err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	resource_server := model.ResourceServer{ Audience: request.Audience, Scope: request.Scope }
+
+	response, err := h.useCaseCredential.AddResourceServer(ctx, resource_server)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
 
 	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusInternalServerError, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 	return handlerResponse, nil
 }
 
-func (h *AdapterCredential) GetInfo(ctx context.Context) (*events.APIGatewayProxyResponse, error) {
+func (h *AdapterCredential) QueryResourceServer(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
+	childLogger.Debug().Msg("QueryResourceServer")
+	
+	ctx, span := observability.Span(ctx, "adapter.QueryResourceServer")	
+    defer span.End()
+
+	id := req.PathParameters["id"]
+	if len(id) == 0 {
+		return ApiErrorResponse(ctx, erro.ErrQueryEmpty)
+	}
+	if err := util.ValidateVar("id", id, "max=256,audience"); err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	response, err := h.useCaseCredential.QueryResourceServer(ctx, id)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+	return handlerResponse, nil
+}
+
+// bearerToken reads the token of the Authorization header
+func bearerToken(req model.HttpRequest) (string, error) {
+	token, found := strings.CutPrefix(req.Headers["authorization"], "Bearer ")
+	if !found || token == "" {
+		return "", erro.ErrBearTokenFormad
+	}
+	return token, nil
+}
+
+func (h *AdapterCredential) UserInfo(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
+	childLogger.Debug().Msg("UserInfo")
+	
+	ctx, span := observability.Span(ctx, "adapter.UserInfo")	
+    defer span.End()
+
+	token, err := bearerToken(req)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	response, err := h.useCaseCredential.UserInfo(ctx, token)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+	return handlerResponse, nil
+}
+
+// RevokeToken revokes the bearer access token (logout), the token is refused until its expiration
+func (h *AdapterCredential) RevokeToken(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
+	childLogger.Debug().Msg("RevokeToken")
+	
+	ctx, span := observability.Span(ctx, "adapter.RevokeToken")	
+    defer span.End()
+
+	token, err := bearerToken(req)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	err = h.useCaseCredential.RevokeToken(ctx, token)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	return &model.HttpResponse{
+		StatusCode: http.StatusNoContent,
+		Headers: map[string]string{},
+	}, nil
+}
+
+func (h *AdapterCredential) GetInfo(ctx context.Context) (*model.HttpResponse, error) {
 	childLogger.Debug().Msg("GetInfo")
 	
-	span := observability.Span(ctx, "adapter.GetInfo")		
+	ctx, span := observability.Span(ctx, "adapter.GetInfo")		
     defer span.End()
 
-	handlerResponse, err := ApiHandlerResponse(http.StatusOK, h.appServer)
+	// the secret names and the dsn are not exposed
+	handlerResponse, err := ApiHandlerResponse(http.StatusOK, configs.Redacted(h.appServer))
 	if err != nil {
-		return ApiHandlerResponse(http.StatusInternalServerError, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
 	return handlerResponse, nil
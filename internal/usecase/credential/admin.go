@@ -0,0 +1,128 @@
+package credential
+
+import(
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/lambda-go-autentication/pkg/observability"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/usecase/audit"
+)
+
+// Scopes required by the administrative routes, ScopeAdmin is accepted on all of them
+const (
+	ScopeAdmin			= "auth.admin"
+	ScopeUserWrite		= "auth.user.write"
+	ScopeScopeRead		= "auth.scope.read"
+	ScopeScopeWrite		= "auth.scope.write"
+	ScopeResourceRead	= "auth.resource.read"
+	ScopeResourceWrite	= "auth.resource.write"
+	ScopeInfoRead		= "auth.info.read"
+	ScopeAuditRead		= "auth.audit.read"
+)
+
+// scopePrefix is the prefix of the scopes of this service, only auth.admin grants or revokes them
+const scopePrefix = "auth."
+
+type claimsKey struct{}
+
+// WithClaims keeps the claims of the bearer token validated by the Auth middleware, the usecase checks the scopes of the caller with them
+func WithClaims(ctx context.Context, claims *model.JwtData) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims kept by WithClaims
+func ClaimsFromContext(ctx context.Context) (*model.JwtData, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*model.JwtData)
+	return claims, ok && claims != nil
+}
+
+// checkAdminScopes requires auth.admin from the caller when the scopes changed include a scope of the service,
+// auth.scope.write only manages the other scopes (otherwise it could grant itself auth.admin)
+func checkAdminScopes(ctx context.Context, changed []string) error {
+	service_scopes := []string{}
+	for _, scope := range changed {
+		if strings.HasPrefix(scope, scopePrefix) {
+			service_scopes = append(service_scopes, scope)
+		}
+	}
+	if len(service_scopes) == 0 {
+		return nil
+	}
+
+	claims, ok := ClaimsFromContext(ctx)
+	if ok {
+		for _, scope := range claims.Scope {
+			if scope == ScopeAdmin {
+				return nil
+			}
+		}
+	}
+	return erro.ErrScopeRequired.WithMessage(ScopeAdmin + " is required to grant or revoke " + strings.Join(service_scopes, " "))
+}
+
+// BootstrapAdmin creates the first admin credential (with the auth.admin scope) when it does not exist yet.
+// The credential and the scope are two writes, when the credential exists with the bootstrap password
+// (a previous start failed between them) the missing auth.admin scope is added, any other credential is never changed
+func (u *UseCaseCredential) BootstrapAdmin(ctx context.Context, user string, password string) error {
+	childLogger.Debug().Msg("BootstrapAdmin")
+
+	ctx, span := observability.Span(ctx, "usecase.BootstrapAdmin")
+    defer span.End()
+
+	if user == "" || password == "" {
+		return erro.ErrQueryEmpty
+	}
+
+	password_hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = u.repository.CreateCredential(ctx, model.Credential{User: user, Password: password_hash})
+	if errors.Is(err, erro.ErrCredentialExists) {
+		user_credential, err := u.repository.Login(ctx, model.Credential{User: user})
+		if err != nil {
+			return err
+		}
+		if err := checkPassword(user_credential.Password, password); err != nil {
+			childLogger.Info().Str("user", user).Msg("bootstrap admin already exists with an other password, not changed")
+			return nil
+		}
+		return u.bootstrapAdminScope(ctx, user)
+	}
+	if err != nil {
+		return err
+	}
+
+	return u.bootstrapAdminScope(ctx, user)
+}
+
+// bootstrapAdminScope adds auth.admin to the scopes of the bootstrap admin, nothing is written when it is already granted
+func (u *UseCaseCredential) bootstrapAdminScope(ctx context.Context, user string) error {
+	credential_scope, err := u.repository.QueryCredentialScope(ctx, model.Credential{User: user})
+	if err != nil {
+		return err
+	}
+	for _, scope := range credential_scope.Scope {
+		if scope == ScopeAdmin {
+			childLogger.Info().Str("user", user).Msg("bootstrap admin already exists")
+			return nil
+		}
+	}
+
+	_, err = u.repository.AddScope(ctx, model.CredentialScope{User: user, Scope: append(credential_scope.Scope, ScopeAdmin)})
+	if err != nil {
+		return err
+	}
+
+	u.audit.Record(ctx, model.AuditEvent{	EventType: audit.EventAdminAction,
+											Actor: "bootstrap",
+											Subject: user,
+											Detail: map[string]string{"action": "bootstrap_admin", "scope": ScopeAdmin} }, nil)
+
+	childLogger.Info().Str("user", user).Msg("bootstrap admin created")
+	return nil
+}
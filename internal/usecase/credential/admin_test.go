@@ -0,0 +1,143 @@
+package credential
+
+import (
+	"errors"
+	"context"
+	"testing"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/usecase/credential/repository"
+)
+
+func TestAddScopeServiceScopes(t *testing.T) {
+	scopeWriter := &model.JwtData{ Username: "writer-01", Scope: []string{ScopeScopeWrite} }
+	admin := &model.JwtData{ Username: "admin-01", Scope: []string{ScopeAdmin} }
+
+	cases := []struct {
+		name		string
+		claims		*model.JwtData
+		previous	[]string
+		scope		[]string
+		wantErr		error
+	}{
+		{ name: "scope.write grants a downstream scope", claims: scopeWriter, scope: []string{"payment.read"} },
+		{ name: "scope.write grants auth.admin to itself", claims: &model.JwtData{ Username: "007", Scope: []string{ScopeScopeWrite} }, scope: []string{ScopeAdmin}, wantErr: erro.ErrScopeRequired },
+		{ name: "scope.write grants auth.admin", claims: scopeWriter, scope: []string{"payment.read", ScopeAdmin}, wantErr: erro.ErrScopeRequired },
+		{ name: "scope.write grants an other auth scope", claims: scopeWriter, scope: []string{ScopeUserWrite}, wantErr: erro.ErrScopeRequired },
+		{ name: "scope.write revokes auth.admin", claims: scopeWriter, previous: []string{ScopeAdmin, "payment.read"}, scope: []string{"payment.read"}, wantErr: erro.ErrScopeRequired },
+		{ name: "scope.write keeps the auth scopes already granted", claims: scopeWriter, previous: []string{ScopeAuditRead}, scope: []string{ScopeAuditRead, "payment.read"} },
+		{ name: "admin grants auth.admin", claims: admin, scope: []string{ScopeAdmin} },
+		{ name: "admin revokes auth.admin", claims: admin, previous: []string{ScopeAdmin}, scope: []string{"payment.read"} },
+		{ name: "without claims", scope: []string{ScopeAdmin}, wantErr: erro.ErrScopeRequired },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := repository.NewRepoMemory()
+			if c.previous != nil {
+				if _, err := repo.AddScope(ctx, model.CredentialScope{ User: "007", Scope: c.previous }); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if c.claims != nil {
+				ctx = WithClaims(ctx, c.claims)
+			}
+			useCaseCredential := NewUseCaseCredential(repo, nil, nil, nil, nil)
+
+			_, err := useCaseCredential.AddScope(ctx, model.CredentialScope{ User: "007", Scope: c.scope })
+			if c.wantErr != nil {
+				if !errors.Is(err, c.wantErr) {
+					t.Fatalf("AddScope error = %v, want %v", err, c.wantErr)
+				}
+				// the scopes are not changed
+				stored, _ := repo.QueryCredentialScope(context.Background(), model.Credential{ User: "007" })
+				if len(stored.Scope) != len(c.previous) {
+					t.Errorf("scopes = %v, want %v", stored.Scope, c.previous)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// failingScopeRepo fails the AddScope calls while fail is set
+type failingScopeRepo struct {
+	*repository.RepoMemory
+	fail	bool
+}
+
+func (r *failingScopeRepo) AddScope(ctx context.Context, credential_scope model.CredentialScope) (*model.CredentialScope, error) {
+	if r.fail {
+		return nil, erro.ErrInsert
+	}
+	return r.RepoMemory.AddScope(ctx, credential_scope)
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	cases := []struct {
+		name		string
+		existing	*model.Credential
+		scope		[]string
+		failFirst	bool
+		wantAdmin	bool
+	}{
+		{ name: "new admin", wantAdmin: true },
+		{ name: "scope write failed on the previous start", failFirst: true, wantAdmin: true },
+		{ name: "admin already bootstrapped", existing: &model.Credential{ User: "admin", Password: "admin-secret" }, scope: []string{ScopeAdmin, "payment.read"}, wantAdmin: true },
+		{ name: "existing credential keeps its scopes", existing: &model.Credential{ User: "admin", Password: "admin-secret" }, scope: []string{"payment.read"}, wantAdmin: true },
+		{ name: "credential of an other password is not changed", existing: &model.Credential{ User: "admin", Password: "other-secret" }, scope: []string{"payment.read"} },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := &failingScopeRepo{ RepoMemory: repository.NewRepoMemory() }
+			if c.existing != nil {
+				password_hash, err := hashPassword(c.existing.Password)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := repo.SignIn(ctx, model.Credential{ User: c.existing.User, Password: password_hash }); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := repo.AddScope(ctx, model.CredentialScope{ User: c.existing.User, Scope: c.scope }); err != nil {
+					t.Fatal(err)
+				}
+			}
+			useCaseCredential := NewUseCaseCredential(repo, nil, nil, nil, nil)
+
+			if c.failFirst {
+				repo.fail = true
+				if err := useCaseCredential.BootstrapAdmin(ctx, "admin", "admin-secret"); err == nil {
+					t.Fatal("BootstrapAdmin must fail when the scope is not written")
+				}
+				repo.fail = false
+			}
+			if err := useCaseCredential.BootstrapAdmin(ctx, "admin", "admin-secret"); err != nil {
+				t.Fatal(err)
+			}
+
+			stored, err := repo.QueryCredentialScope(ctx, model.Credential{ User: "admin" })
+			if err != nil {
+				t.Fatal(err)
+			}
+			admin := false
+			for _, scope := range stored.Scope {
+				admin = admin || scope == ScopeAdmin
+			}
+			if admin != c.wantAdmin {
+				t.Errorf("scopes = %v, want auth.admin %v", stored.Scope, c.wantAdmin)
+			}
+			for _, scope := range c.scope {
+				if len(missingScopes([]string{scope}, stored.Scope)) > 0 {
+					t.Errorf("scopes = %v, the existing %s was lost", stored.Scope, scope)
+				}
+			}
+		})
+	}
+}
@@ -1,142 +1,501 @@
 package credential
 
 import(
+	"time"
 	"context"
+	"errors"
+	"strings"
+	"strconv"
 	
 	"github.com/rs/zerolog/log"
 
 	"github.com/lambda-go-autentication/pkg/observability"
 	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/erro"
 	
 	"github.com/lambda-go-autentication/internal/usecase/credential/repository"
+	"github.com/lambda-go-autentication/internal/usecase/jwt"
+	"github.com/lambda-go-autentication/internal/usecase/audit"
 )
 
 var childLogger = log.With().Str("usecase", "credential").Logger()
 
 type UseCaseCredential struct{
-	repository	*repository.RepoCredential
+	repository	repository.Repository
 	oAUTHToken func(context.Context, model.Credential, model.CredentialScope) (*model.Authentication, error)
 	oAUTHTokenRSA func(context.Context, model.Credential, model.CredentialScope) (*model.Authentication, error)
+	parseAccessToken func(context.Context, string) (*model.JwtData, error)
+	audit		*audit.UseCaseAudit
+	maxFailures	int
+	lockout		time.Duration
 }
 
-func NewUseCaseCredential(	repository	*repository.RepoCredential,
+func NewUseCaseCredential(	repository	repository.Repository,
 							oAUTHToken func(context.Context, model.Credential, model.CredentialScope) (*model.Authentication, error),
-							oAUTHTokenRSA func(context.Context, model.Credential, model.CredentialScope) (*model.Authentication, error)) *UseCaseCredential{
+							oAUTHTokenRSA func(context.Context, model.Credential, model.CredentialScope) (*model.Authentication, error),
+							parseAccessToken func(context.Context, string) (*model.JwtData, error),
+							useCaseAudit *audit.UseCaseAudit) *UseCaseCredential{
 	childLogger.Debug().Msg("NewUseCaseCredential")
 
 	return &UseCaseCredential{
 		repository: repository,
 		oAUTHToken: oAUTHToken,
 		oAUTHTokenRSA: oAUTHTokenRSA,
+		parseAccessToken: parseAccessToken,
+		audit: useCaseAudit,
 	}
 }
 
+// SetLockout refuses the logins of a credential during lockout once maxFailures logins failed within lockout,
+// without it (or with maxFailures 0) there is no lockout
+func (u *UseCaseCredential) SetLockout(maxFailures int, lockout time.Duration) {
+	u.maxFailures = maxFailures
+	u.lockout = lockout
+}
+
 func (u *UseCaseCredential) SignIn(ctx context.Context, credential model.Credential) (*model.Credential, error){
 	childLogger.Debug().Msg("SignIn")
 
-	span := observability.Span(ctx, "repository.SignIn")	
+	ctx, span := observability.Span(ctx, "repository.SignIn")	
     defer span.End()
 
+	// The client may choose the asymetric algorithm of its tokens
+	if _, err := jwt.AsymmetricMethod(credential.SigningAlg); err != nil {
+		return nil, err
+	}
+
+	// The recipient key of the encrypted tokens is checked on the registration
+	if credential.EncryptionKey != "" {
+		if _, err := jwt.CheckRecipientKey(credential.EncryptionKey); err != nil {
+			return nil, erro.ErrEncryptionKeyInvalid.Wrap(err)
+		}
+	}
+
+	// Only the password hash is stored
+	password_hash, err := hashPassword(credential.Password)
+	if err != nil {
+		return nil, err
+	}
+	credential.Password = password_hash
+
 	// Create a new credential
 	res, err := u.repository.SignIn(ctx, credential)
+	u.audit.Record(ctx, model.AuditEvent{	EventType: audit.EventSignIn,
+											Subject: credential.User,
+											Detail: map[string]string{"usage_plan": credential.UsagePlan, "signing_alg": credential.SigningAlg} }, err)
 	if err != nil {
 		return nil, err
 	}
+	res.Password = ""
+
 	return res, nil
 }
 
 func (u *UseCaseCredential) Login(ctx context.Context, credential model.Credential) (*model.Authentication, error){
 	childLogger.Debug().Msg("Login")
-	childLogger.Debug().Interface("credential :",credential).Msg("")
 
-	span := observability.Span(ctx, "repository.Login")	
+	ctx, span := observability.Span(ctx, "repository.Login")	
     defer span.End()
 
-	_, err := u.repository.Login(ctx, credential)
+	// the credential and its scopes are read together
+	credential_partition, err := u.authenticate(ctx, credential)
 	if err != nil {
-		childLogger.Error().Err(err).Msg("erro u.repository.Login")
+		childLogger.Error().Err(err).Msg("erro u.authenticate")
 		return nil, err
 	}
+	ctx = observability.WithSubject(ctx, credential.User)
+	ctx = observability.WithUsagePlan(ctx, credential_partition.Credential.UsagePlan)
 
-	// get scopes associated with a credential
-	credential_scope, err := u.repository.QueryCredentialScope(ctx, credential)
+	// restrict the scopes to the requested audience
+	credential_scope, err := u.restrictAudience(ctx, credential, credential_partition.CredentialScope)
 	if err != nil {
-		childLogger.Error().Err(err).Msg("error u.repository.QueryCredentialScope")
+		childLogger.Error().Err(err).Msg("error u.restrictAudience")
 		return nil, err
 	}
-	span_jwt := observability.Span(ctx, "service.create_jwt")	
+	ctx_jwt, span_jwt := observability.Span(ctx, "service.create_jwt")	
+	defer span_jwt.End()
 
-	auth, err := u.oAUTHToken(ctx, credential, *credential_scope)
+	auth, err := u.oAUTHToken(ctx_jwt, credential, *credential_scope)
 	if err != nil {
 		childLogger.Error().Err(err).Msg("error u.oAUTHToken")
 		return nil, err
 	}
 
-	defer span_jwt.End()
-	return auth, nil
+	return u.encryptToken(credential, credential_partition.Credential, auth)
 }
 
 func (u *UseCaseCredential) LoginRSA(ctx context.Context, credential model.Credential) (*model.Authentication, error){
 	childLogger.Debug().Msg("LoginRSA")
-	childLogger.Debug().Interface("credential :",credential).Msg("")
 
-	span := observability.Span(ctx, "repository.Login")	
+	ctx, span := observability.Span(ctx, "repository.Login")	
     defer span.End()
 
-	_, err := u.repository.Login(ctx, credential)
+	// the credential and its scopes are read together
+	credential_partition, err := u.authenticate(ctx, credential)
 	if err != nil {
-		childLogger.Error().Err(err).Msg("erro u.repository.Login")
+		childLogger.Error().Err(err).Msg("erro u.authenticate")
 		return nil, err
 	}
+	ctx = observability.WithSubject(ctx, credential.User)
+	ctx = observability.WithUsagePlan(ctx, credential_partition.Credential.UsagePlan)
+	// the token is signed with the algorithm registered for the client
+	credential.SigningAlg = credential_partition.Credential.SigningAlg
 
-	// get scopes associated with a credential
-	credential_scope, err := u.repository.QueryCredentialScope(ctx, credential)
+	// restrict the scopes to the requested audience
+	credential_scope, err := u.restrictAudience(ctx, credential, credential_partition.CredentialScope)
 	if err != nil {
-		childLogger.Error().Err(err).Msg("error u.repository.QueryCredentialScope")
+		childLogger.Error().Err(err).Msg("error u.restrictAudience")
 		return nil, err
 	}
-	span_jwt := observability.Span(ctx, "service.create_jwt")	
+	ctx_jwt, span_jwt := observability.Span(ctx, "service.create_jwt")	
+	defer span_jwt.End()
 
-	auth, err := u.oAUTHTokenRSA(ctx, credential, *credential_scope)
+	auth, err := u.oAUTHTokenRSA(ctx_jwt, credential, *credential_scope)
 	if err != nil {
 		childLogger.Error().Err(err).Msg("error u.oAUTHToken")
 		return nil, err
 	}
 
-	defer span_jwt.End()
+	return u.encryptToken(credential, credential_partition.Credential, auth)
+}
+
+// encryptToken returns the access token only encrypted (nested JWT) for the recipient key registered by the client, when requested
+func (u *UseCaseCredential) encryptToken(	credential model.Credential,
+											user_credential model.Credential,
+											auth *model.Authentication) (*model.Authentication, error){
+	if !credential.Encrypt {
+		return auth, nil
+	}
+	if user_credential.EncryptionKey == "" {
+		return nil, erro.ErrEncryptionKeyMissing
+	}
+
+	recipient, err := jwt.CheckRecipientKey(user_credential.EncryptionKey)
+	if err != nil {
+		return nil, erro.ErrEncryptionKeyInvalid.Wrap(err)
+	}
+	token_encrypted, err := jwt.EncryptToken(auth.Token, recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	auth.TokenEncrypted = token_encrypted
+	auth.Token = ""
 	return auth, nil
 }
 
+// authenticate loads the credential partition (one query) and checks the password, an unknown user, a wrong password
+// and a locked credential return the same error
+func (u *UseCaseCredential) authenticate(ctx context.Context, credential model.Credential) (*model.CredentialPartition, error){
+	childLogger.Debug().Msg("authenticate")
+
+	credential_partition, err := u.repository.LoadCredential(ctx, credential)
+	if errors.Is(err, erro.ErrNotFound) {
+		checkPassword("", credential.Password)
+		observability.RecordLogin(ctx, observability.LoginNotFound)
+		u.auditLogin(ctx, credential, observability.LoginNotFound, erro.ErrInvalidCredential)
+		return nil, erro.ErrInvalidCredential
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the metrics of a known user carry its usage plan
+	ctx = observability.WithUsagePlan(ctx, credential_partition.Credential.UsagePlan)
+
+	// a locked credential is refused even with the right password, the password is not checked
+	if credential_partition.LoginFailures.LockedUntil > time.Now().Unix() {
+		checkPassword("", credential.Password)
+		observability.RecordLogin(ctx, observability.LoginLocked)
+		u.auditLogin(ctx, credential, observability.LoginLocked, erro.ErrInvalidCredential)
+		return nil, erro.ErrInvalidCredential
+	}
+
+	if err := checkPassword(credential_partition.Credential.Password, credential.Password); err != nil {
+		observability.RecordLogin(ctx, observability.LoginBadPassword)
+		u.auditLogin(ctx, credential, observability.LoginBadPassword, err)
+		u.loginFailed(ctx, credential.User)
+		return nil, err
+	}
+	if credential_partition.LoginFailures.Failures > 0 {
+		if err := u.repository.ResetLoginFailures(ctx, credential.User); err != nil {
+			childLogger.Error().Err(err).Str("user", credential.User).Msg("error reset login failures")
+		}
+	}
+
+	// the credentials created before the hashing are hashed on their first successful login
+	if needsRehash(credential_partition.Credential.Password) {
+		u.rehashPassword(ctx, &credential_partition.Credential, credential.Password)
+	}
+
+	observability.RecordLogin(ctx, observability.LoginSuccess)
+	u.auditLogin(ctx, credential, observability.LoginSuccess, nil)
+	return credential_partition, nil
+}
+
+// loginFailed counts the failed login and locks the credential on the maxFailures failure, a storage error is
+// logged, the login fails anyway
+func (u *UseCaseCredential) loginFailed(ctx context.Context, user string) {
+	if u.maxFailures <= 0 {
+		return
+	}
+
+	login_failures, err := u.repository.AddLoginFailure(ctx, user, u.lockout)
+	if err != nil {
+		childLogger.Error().Err(err).Str("user", user).Msg("error add login failure")
+		return
+	}
+	if login_failures.Failures < u.maxFailures || login_failures.LockedUntil > time.Now().Unix() {
+		return
+	}
+
+	locked_until := time.Now().Add(u.lockout)
+	err = u.repository.LockLogin(ctx, user, locked_until)
+	u.audit.Record(ctx, model.AuditEvent{	EventType: audit.EventLoginLockout,
+											Subject: user,
+											Detail: map[string]string{"failures": strconv.Itoa(login_failures.Failures), "locked_until": locked_until.UTC().Format(time.RFC3339)} }, err)
+	if err != nil {
+		childLogger.Error().Err(err).Str("user", user).Msg("error lock login")
+		return
+	}
+	observability.RecordLoginLockout(ctx)
+	childLogger.Warn().Str("user", user).Int("failures", login_failures.Failures).Time("locked_until", locked_until).Msg("login locked")
+}
+
+// rehashPassword replaces the plain text password by its hash, a failure is logged and counted but does not fail the login
+func (u *UseCaseCredential) rehashPassword(ctx context.Context, stored *model.Credential, password string) {
+	childLogger.Warn().Str("user", stored.User).Msg("plain text password, rehashing")
+
+	password_hash, err := hashPassword(password)
+	if err == nil {
+		rehashed := *stored
+		rehashed.Password = password_hash
+		_, err = u.repository.SignIn(ctx, rehashed)
+	}
+	observability.RecordPasswordRehash(ctx, err)
+	if err != nil {
+		childLogger.Error().Err(err).Str("user", stored.User).Msg("error rehash password")
+		return
+	}
+	stored.Password = password_hash
+}
+
+// auditLogin records the login outcome, the user informed is the actor and the subject (it may not exist on a failure)
+func (u *UseCaseCredential) auditLogin(ctx context.Context, credential model.Credential, outcome string, err error) {
+	event := model.AuditEvent{	EventType: audit.EventLoginSuccess,
+								Actor: credential.User,
+								Subject: credential.User,
+								Detail: map[string]string{"reason": outcome} }
+	if err != nil {
+		event.EventType = audit.EventLoginFailure
+	}
+	if credential.Audience != "" {
+		event.Detail["audience"] = credential.Audience
+	}
+	u.audit.Record(ctx, event, err)
+}
+
 func (u *UseCaseCredential) AddScope(ctx context.Context, credential_scope model.CredentialScope) (*model.CredentialScope, error){
 	childLogger.Debug().Msg("AddScope")
 
-	span := observability.Span(ctx, "repository.AddScope")	
+	ctx, span := observability.Span(ctx, "repository.AddScope")	
     defer span.End()
 
+	// the scopes are replaced, the audit log records what was granted and revoked
+	previous_scope, err := u.repository.QueryCredentialScope(ctx, model.Credential{User: credential_scope.User})
+	if err != nil {
+		return nil, err
+	}
+
+	granted := missingScopes(credential_scope.Scope, previous_scope.Scope)
+	revoked := missingScopes(previous_scope.Scope, credential_scope.Scope)
+
+	// the scopes of the service (auth.*) are only granted or revoked by an admin
+	if err := checkAdminScopes(ctx, append(append([]string{}, granted...), revoked...)); err != nil {
+		u.audit.Record(ctx, model.AuditEvent{	EventType: audit.EventScopeGrant,
+												Subject: credential_scope.User,
+												Detail: map[string]string{"scope": strings.Join(credential_scope.Scope, " ")} }, err)
+		return nil, err
+	}
+
 	// Save the credentials scopes
 	res, err := u.repository.AddScope(ctx, credential_scope)
 	if err != nil {
+		u.audit.Record(ctx, model.AuditEvent{	EventType: audit.EventScopeGrant,
+												Subject: credential_scope.User,
+												Detail: map[string]string{"scope": strings.Join(credential_scope.Scope, " ")} }, err)
 		return nil, err
 	}
 
+	if len(granted) > 0 {
+		u.audit.Record(ctx, model.AuditEvent{	EventType: audit.EventScopeGrant,
+												Subject: credential_scope.User,
+												Detail: map[string]string{"scope": strings.Join(granted, " ")} }, nil)
+	}
+	if len(revoked) > 0 {
+		u.audit.Record(ctx, model.AuditEvent{	EventType: audit.EventScopeRevoke,
+												Subject: credential_scope.User,
+												Detail: map[string]string{"scope": strings.Join(revoked, " ")} }, nil)
+	}
+
 	return res, nil
 }
 
+// missingScopes returns the scopes not present in others
+func missingScopes(scopes []string, others []string) []string {
+	present := make(map[string]bool, len(others))
+	for _, scope := range others {
+		present[scope] = true
+	}
+
+	missing := []string{}
+	for _, scope := range scopes {
+		if !present[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
 func (u UseCaseCredential) QueryCredentialScope(ctx context.Context, credential model.Credential) (*model.CredentialScope, error){
 	childLogger.Debug().Msg("QueryCredentialScope")
 
-	span := observability.Span(ctx, "repository.QueryCredentialScope")	
+	ctx, span := observability.Span(ctx, "repository.QueryCredentialScope")	
     defer span.End()
 
 	// Query all scope linked with the credentials
-
-	childLogger.Debug().Interface("++++++++>>>>>> :", u.repository.TableName).Msg("")
-	childLogger.Debug().Interface("++++++++>>>>>> :", u.repository.Repository).Msg("")
-
 	credential_scope, err := u.repository.QueryCredentialScope(ctx, credential)
 	if err != nil {
 		return nil, err
 	}
 
 	return credential_scope, nil
-}
\ No newline at end of file
+}
+
+// restrictAudience keeps only the scopes accepted by the requested resource server
+func (u *UseCaseCredential) restrictAudience(ctx context.Context, 
+											credential model.Credential,
+											credential_scope model.CredentialScope) (*model.CredentialScope, error){
+	childLogger.Debug().Msg("restrictAudience")
+
+	if credential.Audience == "" {
+		return &credential_scope, nil
+	}
+
+	resource_server, err := u.repository.QueryResourceServer(ctx, credential.Audience)
+	if err != nil {
+		return nil, err
+	}
+
+	accepted := make(map[string]bool, len(resource_server.Scope))
+	for _, scope := range resource_server.Scope {
+		accepted[scope] = true
+	}
+
+	scopes := []string{}
+	for _, scope := range credential_scope.Scope {
+		if accepted[scope] {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, erro.ErrScopeNotAllowed
+	}
+
+	credential_scope.Scope = scopes
+	return &credential_scope, nil
+}
+
+func (u *UseCaseCredential) AddResourceServer(ctx context.Context, resource_server model.ResourceServer) (*model.ResourceServer, error){
+	childLogger.Debug().Msg("AddResourceServer")
+
+	ctx, span := observability.Span(ctx, "repository.AddResourceServer")	
+    defer span.End()
+
+	res, err := u.repository.AddResourceServer(ctx, resource_server)
+	u.audit.Record(ctx, model.AuditEvent{	EventType: audit.EventAdminAction,
+											Subject: resource_server.Audience,
+											Detail: map[string]string{"action": "resource_server.add", "scope": strings.Join(resource_server.Scope, " ")} }, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (u *UseCaseCredential) QueryResourceServer(ctx context.Context, audience string) (*model.ResourceServer, error){
+	childLogger.Debug().Msg("QueryResourceServer")
+
+	ctx, span := observability.Span(ctx, "repository.QueryResourceServer")	
+    defer span.End()
+
+	res, err := u.repository.QueryResourceServer(ctx, audience)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// UserInfo returns the profile claims of the credential owning the access token (OIDC userinfo)
+func (u *UseCaseCredential) UserInfo(ctx context.Context, bearerToken string) (*model.UserInfo, error){
+	childLogger.Debug().Msg("UserInfo")
+
+	ctx, span := observability.Span(ctx, "repository.UserInfo")	
+    defer span.End()
+
+	claims, err := u.ParseAccessToken(ctx, bearerToken)
+	if err != nil {
+		return nil, err
+	}
+
+	openid := false
+	for _, scope := range claims.Scope {
+		openid = openid || scope == jwt.ScopeOpenID
+	}
+	if !openid {
+		return nil, erro.ErrScopeOpenID
+	}
+
+	user_credential, err := u.repository.Login(ctx, model.Credential{User: claims.Username})
+	if err != nil {
+		return nil, err
+	}
+
+	userInfo := model.UserInfo{	Sub: user_credential.User,
+								PreferredUsername: user_credential.User,
+								UsagePlan: user_credential.UsagePlan,
+								UpdatedAt: user_credential.Updated_at.Unix()}
+
+	return &userInfo, nil
+}
+
+// ParseAccessToken validates the access token, the jwt usecase refuses the revoked ones
+func (u *UseCaseCredential) ParseAccessToken(ctx context.Context, bearerToken string) (*model.JwtData, error){
+	childLogger.Debug().Msg("ParseAccessToken")
+
+	return u.parseAccessToken(ctx, bearerToken)
+}
+
+// RevokeToken revokes the access token until its expiration, revoking twice is not an error
+func (u *UseCaseCredential) RevokeToken(ctx context.Context, bearerToken string) error{
+	childLogger.Debug().Msg("RevokeToken")
+
+	ctx, span := observability.Span(ctx, "repository.RevokeToken")	
+    defer span.End()
+
+	claims, err := u.ParseAccessToken(ctx, bearerToken)
+	if errors.Is(err, erro.ErrTokenRevoked) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = u.repository.RevokeToken(ctx, claims.JwtId, claims.ExpiresAt.Time)
+	u.audit.Record(ctx, model.AuditEvent{	EventType: audit.EventTokenRevoke,
+											Actor: claims.Username,
+											Subject: claims.Username,
+											Detail: map[string]string{"jwt_id": claims.JwtId} }, err)
+	return err
+}
@@ -0,0 +1,84 @@
+package credential
+
+import (
+	"time"
+	"errors"
+	"context"
+	"testing"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/usecase/credential/repository"
+)
+
+func TestAuthenticateLockout(t *testing.T) {
+	cases := []struct {
+		name		string
+		maxFailures	int
+		attempts	[]string	// the passwords tried, in order
+		wantLocked	bool		// the credential is locked after the attempts
+		wantErr		error		// the error of the last attempt
+	}{
+		{ name: "failures under the limit", maxFailures: 3, attempts: []string{"bad", "bad", "MrBeam"} },
+		{ name: "locked on the last failure", maxFailures: 3, attempts: []string{"bad", "bad", "bad"}, wantLocked: true, wantErr: erro.ErrInvalidCredential },
+		{ name: "right password refused once locked", maxFailures: 3, attempts: []string{"bad", "bad", "bad", "MrBeam"}, wantLocked: true, wantErr: erro.ErrInvalidCredential },
+		{ name: "success resets the failures", maxFailures: 3, attempts: []string{"bad", "bad", "MrBeam", "bad", "bad", "MrBeam"} },
+		{ name: "no lockout", maxFailures: 0, attempts: []string{"bad", "bad", "bad", "bad", "MrBeam"} },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := repository.NewRepoMemory()
+			password_hash, err := hashPassword("MrBeam")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.SignIn(ctx, model.Credential{ User: "007", Password: password_hash }); err != nil {
+				t.Fatal(err)
+			}
+			useCaseCredential := NewUseCaseCredential(repo, nil, nil, nil, nil)
+			useCaseCredential.SetLockout(c.maxFailures, time.Hour)
+
+			for _, password := range c.attempts {
+				_, err = useCaseCredential.authenticate(ctx, model.Credential{ User: "007", Password: password })
+			}
+			if c.wantErr == nil && err != nil {
+				t.Fatalf("authenticate error = %v", err)
+			}
+			if c.wantErr != nil && !errors.Is(err, c.wantErr) {
+				t.Fatalf("authenticate error = %v, want %v", err, c.wantErr)
+			}
+
+			credential_partition, err := repo.LoadCredential(ctx, model.Credential{ User: "007" })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if locked := credential_partition.LoginFailures.LockedUntil > time.Now().Unix(); locked != c.wantLocked {
+				t.Errorf("locked = %v, want %v (%+v)", locked, c.wantLocked, credential_partition.LoginFailures)
+			}
+		})
+	}
+}
+
+func TestAuthenticateLockoutExpires(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewRepoMemory()
+	password_hash, err := hashPassword("MrBeam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SignIn(ctx, model.Credential{ User: "007", Password: password_hash }); err != nil {
+		t.Fatal(err)
+	}
+	useCaseCredential := NewUseCaseCredential(repo, nil, nil, nil, nil)
+	useCaseCredential.SetLockout(1, time.Hour)
+
+	// a lock already over does not refuse the login
+	if err := repo.LockLogin(ctx, "007", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := useCaseCredential.authenticate(ctx, model.Credential{ User: "007", Password: "MrBeam" }); err != nil {
+		t.Fatalf("authenticate after the lockout error = %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package credential
+
+import(
+	"errors"
+	"strings"
+	"crypto/subtle"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/lambda-go-autentication/internal/erro"
+)
+
+// dummyHash is compared when the user does not exist, the response time does not reveal the registered users
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+// maxPasswordBytes is the bcrypt limit, a longer password is refused instead of truncated
+const maxPasswordBytes = 72
+
+func hashPassword(password string) (string, error) {
+	if len(password) > maxPasswordBytes {
+		return "", erro.ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", erro.ErrPasswordTooLong
+	}
+	if err != nil {
+		return "", erro.ErrInternal.Wrap(err)
+	}
+	return string(hash), nil
+}
+
+// needsRehash is true for a password stored before the hashing (plain text)
+func needsRehash(stored string) bool {
+	return stored != "" && !strings.HasPrefix(stored, "$2")
+}
+
+// checkPassword compares the password with the stored bcrypt hash, the credentials created before the hashing keep the plain text comparison
+func checkPassword(stored string, password string) error {
+	if stored == "" || password == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return erro.ErrInvalidCredential
+	}
+
+	if needsRehash(stored) {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(password)) != 1 {
+			return erro.ErrInvalidCredential
+		}
+		return nil
+	}
+
+	// bcrypt compares only the first 72 bytes, no hash was created from a longer password
+	if len(password) > maxPasswordBytes {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password[:maxPasswordBytes]))
+		return erro.ErrInvalidCredential
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)); err != nil {
+		return erro.ErrInvalidCredential
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package credential
+
+import (
+	"errors"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/usecase/credential/repository"
+)
+
+func TestCheckPassword(t *testing.T) {
+	password_hash, err := hashPassword("MrBeam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name		string
+		stored		string
+		password	string
+		wantErr		bool
+	}{
+		{ name: "bcrypt hash", stored: password_hash, password: "MrBeam" },
+		{ name: "bcrypt hash wrong password", stored: password_hash, password: "MrBean", wantErr: true },
+		{ name: "plain text", stored: "MrBeam", password: "MrBeam" },
+		{ name: "plain text wrong password", stored: "MrBeam", password: "MrBean", wantErr: true },
+		{ name: "empty password", stored: password_hash, password: "", wantErr: true },
+		{ name: "unknown user", stored: "", password: "MrBeam", wantErr: true },
+		{ name: "longer than the bcrypt limit", stored: password_hash, password: "MrBeam" + strings.Repeat("x", 70), wantErr: true },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := checkPassword(c.stored, c.password)
+			if c.wantErr {
+				if !errors.Is(err, erro.ErrInvalidCredential) {
+					t.Fatalf("checkPassword error = %v, want %v", err, erro.ErrInvalidCredential)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRehashesPlainText(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewRepoMemory()
+	if _, err := repo.SignIn(ctx, model.Credential{ User: "007", Password: "MrBeam", UsagePlan: "tier1" }); err != nil {
+		t.Fatal(err)
+	}
+	useCaseCredential := NewUseCaseCredential(repo, nil, nil, nil, nil)
+
+	if _, err := useCaseCredential.authenticate(ctx, model.Credential{ User: "007", Password: "MrBeam" }); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := repo.Login(ctx, model.Credential{ User: "007" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored.Password, "$2") {
+		t.Fatalf("password = %s, want a bcrypt hash", stored.Password)
+	}
+	if stored.UsagePlan != "tier1" {
+		t.Errorf("usage plan = %s, want tier1", stored.UsagePlan)
+	}
+
+	// the hashed password keeps working and the plain text is no longer stored
+	if _, err := useCaseCredential.authenticate(ctx, model.Credential{ User: "007", Password: "MrBeam" }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := useCaseCredential.authenticate(ctx, model.Credential{ User: "007", Password: stored.Password }); err == nil {
+		t.Error("the stored hash must not be accepted as the password")
+	}
+}
+
+func TestHashPasswordLimit(t *testing.T) {
+	cases := []struct {
+		name		string
+		password	string
+		wantErr		error
+	}{
+		{ name: "72 bytes", password: strings.Repeat("x", 72) },
+		{ name: "73 bytes", password: strings.Repeat("x", 73), wantErr: erro.ErrPasswordTooLong },
+		{ name: "72 characters of 2 bytes", password: strings.Repeat("é", 72), wantErr: erro.ErrPasswordTooLong },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			password_hash, err := hashPassword(c.password)
+			if c.wantErr != nil {
+				if !errors.Is(err, c.wantErr) {
+					t.Fatalf("hashPassword error = %v, want %v", err, c.wantErr)
+				}
+				if problem := erro.As(err); problem.Status != 400 {
+					t.Errorf("status = %d, want 400", problem.Status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := checkPassword(password_hash, c.password); err != nil {
+				t.Errorf("checkPassword error = %v", err)
+			}
+		})
+	}
+}
+
+func TestSignInPasswordTooLong(t *testing.T) {
+	useCaseCredential := NewUseCaseCredential(repository.NewRepoMemory(), nil, nil, nil, nil)
+
+	_, err := useCaseCredential.SignIn(context.Background(), model.Credential{ User: "007", Password: strings.Repeat("x", 100) })
+	if !errors.Is(err, erro.ErrPasswordTooLong) {
+		t.Errorf("SignIn error = %v, want %v", err, erro.ErrPasswordTooLong)
+	}
+}
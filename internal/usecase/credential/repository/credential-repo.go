@@ -2,10 +2,14 @@ package repository
 
 import(
 	"fmt"
+	"errors"
 	"time"
 	"context"
+	"strings"
 	
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/lambda-go-autentication/internal/erro"
 	database "github.com/lambda-go-autentication/pkg/database/dynamo"
@@ -15,7 +19,9 @@ import(
 	
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
 var childLogger = log.With().Str("repo", "credential").Logger()
@@ -38,7 +44,7 @@ func NewRepoCredential(	repository *database.Database,
 func (r *RepoCredential) SignIn(ctx context.Context, user_credential model.Credential) (*model.Credential, error){
 	childLogger.Debug().Msg("SignIn")
 	
-	span := observability.Span(ctx, "repo.SignIn")	
+	ctx, span := observability.Span(ctx, "repo.SignIn")	
     defer span.End()
 
 	user_credential.ID 			= "USER-" + user_credential.User
@@ -65,18 +71,55 @@ func (r *RepoCredential) SignIn(ctx context.Context, user_credential model.Crede
 	return &user_credential , nil
 }
 
+// CreateCredential creates a credential only if the user does not exist (used by the admin bootstrap)
+func (r *RepoCredential) CreateCredential(ctx context.Context, user_credential model.Credential) (*model.Credential, error){
+	childLogger.Debug().Msg("CreateCredential")
+	
+	ctx, span := observability.Span(ctx, "repo.CreateCredential")	
+    defer span.End()
+
+	user_credential.ID 			= "USER-" + user_credential.User
+	user_credential.SK 			= "USER-" + user_credential.User
+	user_credential.Updated_at 	= time.Now()
+
+	item, err := attributevalue.MarshalMap(user_credential)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("erro MarshalMap")
+		return nil, erro.ErrUnmarshal
+	}
+
+	putInput := &dynamodb.PutItemInput{
+        TableName: r.TableName,
+        Item:      item,
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+    }
+
+	_, err = r.Repository.Client.PutItem(ctx, putInput)
+    if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return nil, erro.ErrCredentialExists
+		}
+		childLogger.Error().Err(err).Msg("error CreateCredential PutItem")
+		return nil, erro.ErrInsert
+    }
+
+	return &user_credential , nil
+}
+
 func (r *RepoCredential) Login(ctx context.Context, user_credential model.Credential) (*model.Credential, error){
 	childLogger.Debug().Msg("Login")
 
-	span := observability.Span(ctx, "repo.Login")	
+	ctx, span := observability.Span(ctx, "repo.Login")	
     defer span.End()
 
 	var keyCond expression.KeyConditionBuilder
 	id := "USER-" + user_credential.User
 
+	// SK equal, BeginsWith would also match the items of the partition starting with the user id
 	keyCond = expression.KeyAnd(
 		expression.Key("ID").Equal(expression.Value(id)),
-		expression.Key("SK").BeginsWith(id),
+		expression.Key("SK").Equal(expression.Value(id)),
 	)
 
 	expr, err := expression.NewBuilder().
@@ -91,6 +134,7 @@ func (r *RepoCredential) Login(ctx context.Context, user_credential model.Creden
 									ExpressionAttributeNames:  expr.Names(),
 									ExpressionAttributeValues: expr.Values(),
 									KeyConditionExpression:    expr.KeyCondition(),
+									ReturnConsumedCapacity:	   types.ReturnConsumedCapacityTotal,
 	}
 
 	result, err := r.Repository.Client.Query(ctx, key)
@@ -98,6 +142,7 @@ func (r *RepoCredential) Login(ctx context.Context, user_credential model.Creden
 		childLogger.Error().Err(err).Msg("error Query")
 		return nil, erro.ErrQuery
 	}
+	consumedCapacity(span, result.ConsumedCapacity)
 
 	credential := []model.Credential{}
 	err = attributevalue.UnmarshalListOfMaps(result.Items, &credential)
@@ -113,10 +158,104 @@ func (r *RepoCredential) Login(ctx context.Context, user_credential model.Creden
 	}
 }
 
+// LoadCredential queries the whole USER- partition once and splits the items by SK:
+// USER-<user> the credential, SCOPE-001 the scopes, ROLE- the roles, MFA- the mfa devices and LOCKOUT the failed logins
+func (r *RepoCredential) LoadCredential(ctx context.Context, user_credential model.Credential) (*model.CredentialPartition, error){
+	childLogger.Debug().Msg("LoadCredential")
+
+	ctx, span := observability.Span(ctx, "repo.LoadCredential")	
+    defer span.End()
+
+	id := "USER-" + user_credential.User
+	expr, err := expression.NewBuilder().
+							WithKeyCondition(expression.Key("ID").Equal(expression.Value(id))).
+							Build()
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error NewBuilder")
+		return nil, erro.ErrPreparedQuery
+	}
+
+	key := &dynamodb.QueryInput{	TableName:                 r.TableName,
+									ExpressionAttributeNames:  expr.Names(),
+									ExpressionAttributeValues: expr.Values(),
+									KeyConditionExpression:    expr.KeyCondition(),
+									ReturnConsumedCapacity:	   types.ReturnConsumedCapacityTotal,
+	}
+
+	credential_partition := model.CredentialPartition{}
+	found := false
+	capacity := &types.ConsumedCapacity{ CapacityUnits: aws.Float64(0) }
+
+	paginator := dynamodb.NewQueryPaginator(r.Repository.Client, key)
+	for paginator.HasMorePages() {
+		result, err := paginator.NextPage(ctx)
+		if err != nil {
+			childLogger.Error().Err(err).Msg("error Query")
+			return nil, erro.ErrQuery
+		}
+		if result.ConsumedCapacity != nil && result.ConsumedCapacity.CapacityUnits != nil {
+			*capacity.CapacityUnits += *result.ConsumedCapacity.CapacityUnits
+		}
+
+		for _, item := range result.Items {
+			sk := ""
+			if err := attributevalue.Unmarshal(item["SK"], &sk); err != nil {
+				childLogger.Error().Err(err).Msg("error Unmarshal SK")
+				return nil, erro.ErrUnmarshal
+			}
+
+			var target interface{}
+			switch {
+			case sk == id:
+				found = true
+				target = &credential_partition.Credential
+			case sk == "SCOPE-001":
+				target = &credential_partition.CredentialScope
+			case strings.HasPrefix(sk, "ROLE-"):
+				credential_partition.Roles = append(credential_partition.Roles, model.CredentialRole{})
+				target = &credential_partition.Roles[len(credential_partition.Roles)-1]
+			case strings.HasPrefix(sk, "MFA-"):
+				credential_partition.MFA = append(credential_partition.MFA, model.CredentialMFA{})
+				target = &credential_partition.MFA[len(credential_partition.MFA)-1]
+			case sk == "LOCKOUT":
+				target = &credential_partition.LoginFailures
+			default:
+				continue
+			}
+
+			if err := attributevalue.UnmarshalMap(item, target); err != nil {
+				childLogger.Error().Err(err).Str("SK", sk).Msg("error UnmarshalMap")
+				return nil, erro.ErrUnmarshal
+			}
+		}
+	}
+	consumedCapacity(span, capacity)
+
+	if !found {
+		return nil, erro.ErrNotFound
+	}
+	// like QueryCredentialScope, the user is not returned with the scopes
+	credential_partition.CredentialScope.User = ""
+	// the TTL deletion is lazy, the expired failures may still be read
+	if credential_partition.LoginFailures.ExpiresAt <= time.Now().Unix() {
+		credential_partition.LoginFailures = model.LoginFailures{}
+	}
+
+	return &credential_partition, nil
+}
+
+// consumedCapacity records the read capacity units of the query in the span
+func consumedCapacity(span trace.Span, capacity *types.ConsumedCapacity) {
+	if capacity == nil || capacity.CapacityUnits == nil {
+		return
+	}
+	span.SetAttributes(attribute.Float64("aws.dynamodb.consumed_capacity_units", *capacity.CapacityUnits))
+}
+
 func (r *RepoCredential) AddScope(ctx context.Context, credential_scope model.CredentialScope) (*model.CredentialScope, error){
 	childLogger.Debug().Msg("AddScope")
 
-	span := observability.Span(ctx, "repo.AddScope")	
+	ctx, span := observability.Span(ctx, "repo.AddScope")	
     defer span.End()
 
 	credential_scope.ID 			= "USER-" + credential_scope.User
@@ -134,7 +273,7 @@ func (r *RepoCredential) AddScope(ctx context.Context, credential_scope model.Cr
         Item:      item,
     }
 
-	_, err = r.Repository.Client.PutItem(context.TODO(), putInput)
+	_, err = r.Repository.Client.PutItem(ctx, putInput)
     if err != nil {
 		childLogger.Error().Err(err).Msg("error AddScope TransactWriteItems")
 		return nil, erro.ErrInsert
@@ -146,8 +285,8 @@ func (r *RepoCredential) AddScope(ctx context.Context, credential_scope model.Cr
 func (r *RepoCredential) QueryCredentialScope(ctx context.Context, user_credential model.Credential) (*model.CredentialScope, error){
 	childLogger.Debug().Msg("QueryCredentialScope")
 
-	//span := observability.Span(ctx, "repo.QueryCredentialScope")	
-    //defer span.End()
+	ctx, span := observability.Span(ctx, "repo.QueryCredentialScope")	
+    defer span.End()
 
 	var keyCond expression.KeyConditionBuilder
 
@@ -170,6 +309,7 @@ func (r *RepoCredential) QueryCredentialScope(ctx context.Context, user_credenti
 								ExpressionAttributeNames:  expr.Names(),
 								ExpressionAttributeValues: expr.Values(),
 								KeyConditionExpression:    expr.KeyCondition(),
+								ReturnConsumedCapacity:	   types.ReturnConsumedCapacityTotal,
 							}
 
 	result, err := r.Repository.Client.Query(ctx, key)
@@ -177,6 +317,7 @@ func (r *RepoCredential) QueryCredentialScope(ctx context.Context, user_credenti
 		childLogger.Error().Err(err).Msg("error Query")
 		return nil, erro.ErrList
 	}
+	consumedCapacity(span, result.ConsumedCapacity)
 
 	credential_scope_temp := []model.CredentialScope{}
 	err = attributevalue.UnmarshalListOfMaps(result.Items, &credential_scope_temp)
@@ -194,4 +335,298 @@ func (r *RepoCredential) QueryCredentialScope(ctx context.Context, user_credenti
 	}
 
 	return &credential_scope_result, nil
-}
\ No newline at end of file
+}
+
+func (r *RepoCredential) AddResourceServer(ctx context.Context, resource_server model.ResourceServer) (*model.ResourceServer, error){
+	childLogger.Debug().Msg("AddResourceServer")
+
+	ctx, span := observability.Span(ctx, "repo.AddResourceServer")	
+    defer span.End()
+
+	resource_server.ID 			= "RESOURCE-" + resource_server.Audience
+	resource_server.SK 			= "RESOURCE-" + resource_server.Audience
+	resource_server.Updated_at 	= time.Now()
+
+	item, err := attributevalue.MarshalMap(resource_server)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error MarshalMap")
+		return nil, erro.ErrUnmarshal
+	}
+
+	putInput := &dynamodb.PutItemInput{
+        TableName: r.TableName,
+        Item:      item,
+    }
+
+	_, err = r.Repository.Client.PutItem(ctx, putInput)
+    if err != nil {
+		childLogger.Error().Err(err).Msg("error AddResourceServer PutItem")
+		return nil, erro.ErrInsert
+    }
+
+	return &resource_server , nil
+}
+
+func (r *RepoCredential) QueryResourceServer(ctx context.Context, audience string) (*model.ResourceServer, error){
+	childLogger.Debug().Msg("QueryResourceServer")
+
+	ctx, span := observability.Span(ctx, "repo.QueryResourceServer")	
+    defer span.End()
+
+	var keyCond expression.KeyConditionBuilder
+	id := "RESOURCE-" + audience
+
+	keyCond = expression.KeyAnd(
+		expression.Key("ID").Equal(expression.Value(id)),
+		expression.Key("SK").Equal(expression.Value(id)),
+	)
+
+	expr, err := expression.NewBuilder().
+							WithKeyCondition(keyCond).
+							Build()
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error NewBuilder")
+		return nil, erro.ErrPreparedQuery
+	}
+
+	key := &dynamodb.QueryInput{	TableName:                 r.TableName,
+									ExpressionAttributeNames:  expr.Names(),
+									ExpressionAttributeValues: expr.Values(),
+									KeyConditionExpression:    expr.KeyCondition(),
+	}
+
+	result, err := r.Repository.Client.Query(ctx, key)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error Query")
+		return nil, erro.ErrQuery
+	}
+
+	resource_server := []model.ResourceServer{}
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &resource_server)
+    if err != nil {
+		childLogger.Error().Err(err).Msg("error unmarshalListOfMaps")
+		return nil, erro.ErrUnmarshal
+    }
+
+	if len(resource_server) == 0 {
+		return nil, erro.ErrAudienceUnknown
+	}
+	return &resource_server[0], nil
+}
+
+func (r *RepoCredential) RevokeToken(ctx context.Context, jwt_id string, expires_at time.Time) error{
+	childLogger.Debug().Msg("RevokeToken")
+
+	ctx, span := observability.Span(ctx, "repo.RevokeToken")	
+    defer span.End()
+
+	revoked_token := model.RevokedToken{	ID: "REVOKED-" + jwt_id,
+											SK: "REVOKED-" + jwt_id,
+											JwtId: jwt_id,
+											ExpiresAt: expires_at.Unix(),
+											Updated_at: time.Now() }
+
+	item, err := attributevalue.MarshalMap(revoked_token)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error MarshalMap")
+		return erro.ErrUnmarshal
+	}
+
+	putInput := &dynamodb.PutItemInput{
+        TableName: r.TableName,
+        Item:      item,
+    }
+
+	_, err = r.Repository.Client.PutItem(ctx, putInput)
+    if err != nil {
+		childLogger.Error().Err(err).Msg("error RevokeToken PutItem")
+		return erro.ErrInsert
+    }
+
+	return nil
+}
+
+func (r *RepoCredential) IsTokenRevoked(ctx context.Context, jwt_id string) (bool, error){
+	childLogger.Debug().Msg("IsTokenRevoked")
+
+	ctx, span := observability.Span(ctx, "repo.IsTokenRevoked")	
+    defer span.End()
+
+	id := "REVOKED-" + jwt_id
+	key, err := attributevalue.MarshalMap(map[string]string{"ID": id, "SK": id})
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error MarshalMap")
+		return false, erro.ErrUnmarshal
+	}
+
+	result, err := r.Repository.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: r.TableName,
+		Key: key,
+	})
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error GetItem")
+		return false, erro.ErrQuery
+	}
+	if result.Item == nil {
+		return false, nil
+	}
+
+	revoked_token := model.RevokedToken{}
+	if err := attributevalue.UnmarshalMap(result.Item, &revoked_token); err != nil {
+		childLogger.Error().Err(err).Msg("error UnmarshalMap")
+		return false, erro.ErrUnmarshal
+	}
+
+	// the TTL deletion is lazy, the expired items may still be read
+	return time.Now().Unix() < revoked_token.ExpiresAt, nil
+}
+
+// AddLoginFailure adds one to the failures of the LOCKOUT item, the condition restarts the item (failures 1) once
+// expires_at has passed, the TTL deletion may not have happened yet
+func (r *RepoCredential) AddLoginFailure(ctx context.Context, user string, window time.Duration) (*model.LoginFailures, error){
+	childLogger.Debug().Msg("AddLoginFailure")
+
+	ctx, span := observability.Span(ctx, "repo.AddLoginFailure")	
+    defer span.End()
+
+	now := time.Now()
+	key, err := attributevalue.MarshalMap(map[string]string{"ID": "USER-" + user, "SK": "LOCKOUT"})
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error MarshalMap")
+		return nil, erro.ErrUnmarshal
+	}
+
+	update := expression.Add(expression.Name("failures"), expression.Value(1)).
+						Set(expression.Name("user"), expression.Value(user)).
+						Set(expression.Name("updated_at"), expression.Value(now)).
+						Set(expression.Name("expires_at"), expression.IfNotExists(expression.Name("expires_at"), expression.Value(now.Add(window).Unix())))
+	condition := expression.Or(	expression.AttributeNotExists(expression.Name("expires_at")),
+								expression.Name("expires_at").GreaterThan(expression.Value(now.Unix())))
+
+	expr, err := expression.NewBuilder().
+							WithUpdate(update).
+							WithCondition(condition).
+							Build()
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error NewBuilder")
+		return nil, erro.ErrPreparedQuery
+	}
+
+	result, err := r.Repository.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: r.TableName,
+		Key: key,
+		ExpressionAttributeNames: expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression: expr.Update(),
+		ConditionExpression: expr.Condition(),
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	var conditionalCheckFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionalCheckFailed) {
+		return r.restartLoginFailures(ctx, user, now, window)
+	}
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error AddLoginFailure UpdateItem")
+		return nil, erro.ErrInsert
+	}
+
+	login_failures := model.LoginFailures{}
+	if err := attributevalue.UnmarshalMap(result.Attributes, &login_failures); err != nil {
+		childLogger.Error().Err(err).Msg("error UnmarshalMap")
+		return nil, erro.ErrUnmarshal
+	}
+
+	return &login_failures, nil
+}
+
+// restartLoginFailures replaces the expired LOCKOUT item by the first failure of a new window
+func (r *RepoCredential) restartLoginFailures(ctx context.Context, user string, now time.Time, window time.Duration) (*model.LoginFailures, error){
+	login_failures := model.LoginFailures{	ID: "USER-" + user,
+											SK: "LOCKOUT",
+											User: user,
+											Failures: 1,
+											ExpiresAt: now.Add(window).Unix(),
+											Updated_at: now }
+
+	item, err := attributevalue.MarshalMap(login_failures)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error MarshalMap")
+		return nil, erro.ErrUnmarshal
+	}
+
+	_, err = r.Repository.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: r.TableName,
+		Item: item,
+	})
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error restartLoginFailures PutItem")
+		return nil, erro.ErrInsert
+	}
+
+	return &login_failures, nil
+}
+
+func (r *RepoCredential) LockLogin(ctx context.Context, user string, locked_until time.Time) error{
+	childLogger.Debug().Msg("LockLogin")
+
+	ctx, span := observability.Span(ctx, "repo.LockLogin")	
+    defer span.End()
+
+	key, err := attributevalue.MarshalMap(map[string]string{"ID": "USER-" + user, "SK": "LOCKOUT"})
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error MarshalMap")
+		return erro.ErrUnmarshal
+	}
+
+	// the item lives until the end of the lock
+	update := expression.Set(expression.Name("locked_until"), expression.Value(locked_until.Unix())).
+						Set(expression.Name("expires_at"), expression.Value(locked_until.Unix())).
+						Set(expression.Name("user"), expression.Value(user)).
+						Set(expression.Name("updated_at"), expression.Value(time.Now()))
+
+	expr, err := expression.NewBuilder().
+							WithUpdate(update).
+							Build()
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error NewBuilder")
+		return erro.ErrPreparedQuery
+	}
+
+	_, err = r.Repository.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: r.TableName,
+		Key: key,
+		ExpressionAttributeNames: expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression: expr.Update(),
+	})
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error LockLogin UpdateItem")
+		return erro.ErrInsert
+	}
+
+	return nil
+}
+
+func (r *RepoCredential) ResetLoginFailures(ctx context.Context, user string) error{
+	childLogger.Debug().Msg("ResetLoginFailures")
+
+	ctx, span := observability.Span(ctx, "repo.ResetLoginFailures")	
+    defer span.End()
+
+	key, err := attributevalue.MarshalMap(map[string]string{"ID": "USER-" + user, "SK": "LOCKOUT"})
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error MarshalMap")
+		return erro.ErrUnmarshal
+	}
+
+	_, err = r.Repository.Client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: r.TableName,
+		Key: key,
+	})
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error ResetLoginFailures DeleteItem")
+		return erro.ErrInsert
+	}
+
+	return nil
+}
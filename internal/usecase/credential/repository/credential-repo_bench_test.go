@@ -0,0 +1,97 @@
+package repository_test
+
+import (
+	"sync"
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/usecase/credential/repository"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// capacityCounter sums the capacity units returned by the queries of the client
+type capacityCounter struct {
+	mutex	sync.Mutex
+	units	float64
+}
+
+func (c *capacityCounter) apiOption(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ConsumedCapacity",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			if result, ok := out.Result.(*dynamodb.QueryOutput); ok && result.ConsumedCapacity != nil && result.ConsumedCapacity.CapacityUnits != nil {
+				c.mutex.Lock()
+				c.units += *result.ConsumedCapacity.CapacityUnits
+				c.mutex.Unlock()
+			}
+			return out, metadata, err
+		}), middleware.After)
+}
+
+func (c *capacityCounter) reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.units = 0
+}
+
+func (c *capacityCounter) perOp(n int) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.units / float64(n)
+}
+
+// newLoginBench creates a loginbench-<uuid> user with two scopes on the table of TABLE_NAME
+func newLoginBench(b *testing.B) (*repository.RepoCredential, *capacityCounter, model.Credential) {
+	b.Helper()
+
+	counter := &capacityCounter{}
+	repo := newRepoCredential(b, counter.apiOption)
+
+	ctx := context.Background()
+	user := model.Credential{User: "loginbench-" + uuid.New().String(), Password: "loginbench"}
+	if _, err := repo.SignIn(ctx, user); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := repo.AddScope(ctx, model.CredentialScope{User: user.User, Scope: []string{"loginbench.read", "loginbench.write"}}); err != nil {
+		b.Fatal(err)
+	}
+	return repo, counter, user
+}
+
+// BenchmarkLoginTwoQueries reads the credential and its scopes as before LoadCredential: Login + QueryCredentialScope
+func BenchmarkLoginTwoQueries(b *testing.B) {
+	repo, counter, user := newLoginBench(b)
+	ctx := context.Background()
+
+	counter.reset()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.Login(ctx, user); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := repo.QueryCredentialScope(ctx, user); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(counter.perOp(b.N), "RCU/op")
+}
+
+// BenchmarkLoadCredential reads the USER-<user> partition with one query
+func BenchmarkLoadCredential(b *testing.B) {
+	repo, counter, user := newLoginBench(b)
+	ctx := context.Background()
+
+	counter.reset()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.LoadCredential(ctx, user); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(counter.perOp(b.N), "RCU/op")
+}
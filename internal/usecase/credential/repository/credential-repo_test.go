@@ -0,0 +1,91 @@
+package repository_test
+
+import (
+	"os"
+	"context"
+	"testing"
+
+	"github.com/lambda-go-autentication/configs"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/usecase/credential/repository"
+	"github.com/lambda-go-autentication/internal/usecase/credential/repository/repositorytest"
+
+	database "github.com/lambda-go-autentication/pkg/database/dynamo"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// newRepoCredential opens the DynamoDB table of TABLE_NAME (REGION) with the api options added to the client,
+// the test is skipped without it
+func newRepoCredential(t testing.TB, apiOptions ...func(*middleware.Stack) error) *repository.RepoCredential {
+	t.Helper()
+
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		t.Skip("TABLE_NAME not set, the DynamoDB repository is not tested")
+	}
+
+	ctx := context.Background()
+	configAWS, err := configs.GetAWSConfig(ctx, os.Getenv("REGION"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.NewDatabase(ctx, configAWS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apiOptions) > 0 {
+		db.Client = dynamodb.NewFromConfig(*configAWS, func(o *dynamodb.Options) {
+			o.APIOptions = append(o.APIOptions, apiOptions...)
+		})
+	}
+	return repository.NewRepoCredential(db, &tableName)
+}
+
+func TestRepoCredentialConformance(t *testing.T) {
+	repositorytest.Run(t, newRepoCredential(t))
+}
+
+type testCtxKey struct{}
+
+// TestRepoCredentialRequestContext checks each DynamoDB call gets the request ctx, the calls are answered by
+// a middleware (no table)
+func TestRepoCredentialRequestContext(t *testing.T) {
+	var got []interface{}
+	answer := func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("answer",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				got = append(got, ctx.Value(testCtxKey{}))
+				return middleware.InitializeOutput{ Result: &dynamodb.PutItemOutput{} }, middleware.Metadata{}, nil
+			}), middleware.After)
+	}
+	client := dynamodb.New(dynamodb.Options{ Region: "us-east-1",
+											 Credentials: aws.AnonymousCredentials{},
+											 APIOptions: []func(*middleware.Stack) error{answer} })
+	tableName := "user_login_2"
+	repoCredential := repository.NewRepoCredential(&database.Database{ Client: client }, &tableName)
+
+	cases := []struct {
+		name	string
+		call	func(ctx context.Context) error
+	}{
+		{ name: "AddScope", call: func(ctx context.Context) error {
+			_, err := repoCredential.AddScope(ctx, model.CredentialScope{ User: "user-01", Scope: []string{"payment.read"} })
+			return err
+		} },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got = nil
+			if err := c.call(context.WithValue(context.Background(), testCtxKey{}, "request")); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != "request" {
+				t.Errorf("%s DynamoDB ctx values = %v, want the request ctx", c.name, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package repository
+
+import(
+	"sync"
+	"time"
+	"context"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/pkg/observability"
+)
+
+// RepoMemory keeps the items in memory with the same semantics of RepoCredential (local runs and the conformance suite)
+type RepoMemory struct{
+	mutex				sync.RWMutex
+	credentials			map[string]model.Credential
+	credential_scopes	map[string]model.CredentialScope
+	resource_servers	map[string]model.ResourceServer
+	revoked_tokens		map[string]model.RevokedToken
+	login_failures		map[string]model.LoginFailures
+}
+
+func NewRepoMemory() *RepoMemory{
+	childLogger.Debug().Msg("NewRepoMemory")
+
+	return &RepoMemory{
+		credentials: map[string]model.Credential{},
+		credential_scopes: map[string]model.CredentialScope{},
+		resource_servers: map[string]model.ResourceServer{},
+		revoked_tokens: map[string]model.RevokedToken{},
+		login_failures: map[string]model.LoginFailures{},
+	}
+}
+
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string{}, values...)
+}
+
+func (r *RepoMemory) SignIn(ctx context.Context, user_credential model.Credential) (*model.Credential, error){
+	childLogger.Debug().Msg("SignIn")
+
+	ctx, span := observability.Span(ctx, "repo.SignIn")	
+    defer span.End()
+
+	user_credential.ID 			= "USER-" + user_credential.User
+	user_credential.SK 			= "USER-" + user_credential.User
+	user_credential.Updated_at 	= time.Now()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.credentials[user_credential.ID] = user_credential
+
+	return &user_credential, nil
+}
+
+func (r *RepoMemory) CreateCredential(ctx context.Context, user_credential model.Credential) (*model.Credential, error){
+	childLogger.Debug().Msg("CreateCredential")
+
+	ctx, span := observability.Span(ctx, "repo.CreateCredential")	
+    defer span.End()
+
+	user_credential.ID 			= "USER-" + user_credential.User
+	user_credential.SK 			= "USER-" + user_credential.User
+	user_credential.Updated_at 	= time.Now()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// same as the attribute_not_exists(ID) condition
+	if _, ok := r.credentials[user_credential.ID]; ok {
+		return nil, erro.ErrCredentialExists
+	}
+	r.credentials[user_credential.ID] = user_credential
+
+	return &user_credential, nil
+}
+
+func (r *RepoMemory) Login(ctx context.Context, user_credential model.Credential) (*model.Credential, error){
+	childLogger.Debug().Msg("Login")
+
+	ctx, span := observability.Span(ctx, "repo.Login")	
+    defer span.End()
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	credential, ok := r.credentials["USER-" + user_credential.User]
+	if !ok {
+		return nil, erro.ErrNotFound
+	}
+
+	return &credential, nil
+}
+
+func (r *RepoMemory) LoadCredential(ctx context.Context, user_credential model.Credential) (*model.CredentialPartition, error){
+	childLogger.Debug().Msg("LoadCredential")
+
+	ctx, span := observability.Span(ctx, "repo.LoadCredential")	
+    defer span.End()
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	credential, ok := r.credentials["USER-" + user_credential.User]
+	if !ok {
+		return nil, erro.ErrNotFound
+	}
+
+	credential_partition := model.CredentialPartition{ Credential: credential }
+	if item, ok := r.credential_scopes["USER-" + user_credential.User]; ok {
+		credential_partition.CredentialScope.ID = item.ID
+		credential_partition.CredentialScope.SK = item.SK
+		credential_partition.CredentialScope.Updated_at = item.Updated_at
+		credential_partition.CredentialScope.Scope = copyStrings(item.Scope)
+	}
+	// like the dynamo TTL, the expired failures are not returned
+	if item, ok := r.login_failures["USER-" + user_credential.User]; ok && time.Now().Unix() < item.ExpiresAt {
+		credential_partition.LoginFailures = item
+	}
+
+	return &credential_partition, nil
+}
+
+func (r *RepoMemory) AddScope(ctx context.Context, credential_scope model.CredentialScope) (*model.CredentialScope, error){
+	childLogger.Debug().Msg("AddScope")
+
+	ctx, span := observability.Span(ctx, "repo.AddScope")	
+    defer span.End()
+
+	credential_scope.ID 			= "USER-" + credential_scope.User
+	credential_scope.SK 			= "SCOPE-001"
+	credential_scope.Updated_at 	= time.Now()
+	credential_scope.Scope			= copyStrings(credential_scope.Scope)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.credential_scopes[credential_scope.ID] = credential_scope
+
+	result := credential_scope
+	result.Scope = copyStrings(credential_scope.Scope)
+	return &result, nil
+}
+
+func (r *RepoMemory) QueryCredentialScope(ctx context.Context, user_credential model.Credential) (*model.CredentialScope, error){
+	childLogger.Debug().Msg("QueryCredentialScope")
+
+	ctx, span := observability.Span(ctx, "repo.QueryCredentialScope")	
+    defer span.End()
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	// like the dynamo query the user is not returned and no scope is not an error
+	credential_scope_result := model.CredentialScope{}
+	if item, ok := r.credential_scopes["USER-" + user_credential.User]; ok {
+		credential_scope_result.ID = item.ID
+		credential_scope_result.SK = item.SK
+		credential_scope_result.Updated_at = item.Updated_at
+		credential_scope_result.Scope = copyStrings(item.Scope)
+	}
+
+	return &credential_scope_result, nil
+}
+
+func (r *RepoMemory) AddResourceServer(ctx context.Context, resource_server model.ResourceServer) (*model.ResourceServer, error){
+	childLogger.Debug().Msg("AddResourceServer")
+
+	ctx, span := observability.Span(ctx, "repo.AddResourceServer")	
+    defer span.End()
+
+	resource_server.ID 			= "RESOURCE-" + resource_server.Audience
+	resource_server.SK 			= "RESOURCE-" + resource_server.Audience
+	resource_server.Updated_at 	= time.Now()
+	resource_server.Scope		= copyStrings(resource_server.Scope)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.resource_servers[resource_server.ID] = resource_server
+
+	result := resource_server
+	result.Scope = copyStrings(resource_server.Scope)
+	return &result, nil
+}
+
+func (r *RepoMemory) QueryResourceServer(ctx context.Context, audience string) (*model.ResourceServer, error){
+	childLogger.Debug().Msg("QueryResourceServer")
+
+	ctx, span := observability.Span(ctx, "repo.QueryResourceServer")	
+    defer span.End()
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	resource_server, ok := r.resource_servers["RESOURCE-" + audience]
+	if !ok {
+		return nil, erro.ErrAudienceUnknown
+	}
+	resource_server.Scope = copyStrings(resource_server.Scope)
+
+	return &resource_server, nil
+}
+
+func (r *RepoMemory) RevokeToken(ctx context.Context, jwt_id string, expires_at time.Time) error{
+	childLogger.Debug().Msg("RevokeToken")
+
+	ctx, span := observability.Span(ctx, "repo.RevokeToken")	
+    defer span.End()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// the expired items are dropped here, as the dynamo TTL does
+	now := time.Now().Unix()
+	for id, revoked_token := range r.revoked_tokens {
+		if revoked_token.ExpiresAt <= now {
+			delete(r.revoked_tokens, id)
+		}
+	}
+
+	r.revoked_tokens["REVOKED-" + jwt_id] = model.RevokedToken{	ID: "REVOKED-" + jwt_id,
+																SK: "REVOKED-" + jwt_id,
+																JwtId: jwt_id,
+																ExpiresAt: expires_at.Unix(),
+																Updated_at: time.Now() }
+	return nil
+}
+
+func (r *RepoMemory) IsTokenRevoked(ctx context.Context, jwt_id string) (bool, error){
+	childLogger.Debug().Msg("IsTokenRevoked")
+
+	ctx, span := observability.Span(ctx, "repo.IsTokenRevoked")	
+    defer span.End()
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	revoked_token, ok := r.revoked_tokens["REVOKED-" + jwt_id]
+	if !ok {
+		return false, nil
+	}
+
+	return time.Now().Unix() < revoked_token.ExpiresAt, nil
+}
+
+func (r *RepoMemory) AddLoginFailure(ctx context.Context, user string, window time.Duration) (*model.LoginFailures, error){
+	childLogger.Debug().Msg("AddLoginFailure")
+
+	ctx, span := observability.Span(ctx, "repo.AddLoginFailure")	
+    defer span.End()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	login_failures, ok := r.login_failures["USER-" + user]
+	if !ok || login_failures.ExpiresAt <= now.Unix() {
+		login_failures = model.LoginFailures{	ID: "USER-" + user,
+												SK: "LOCKOUT",
+												User: user,
+												ExpiresAt: now.Add(window).Unix() }
+	}
+	login_failures.Failures++
+	login_failures.Updated_at = now
+
+	r.login_failures["USER-" + user] = login_failures
+
+	return &login_failures, nil
+}
+
+func (r *RepoMemory) LockLogin(ctx context.Context, user string, locked_until time.Time) error{
+	childLogger.Debug().Msg("LockLogin")
+
+	ctx, span := observability.Span(ctx, "repo.LockLogin")	
+    defer span.End()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	login_failures, ok := r.login_failures["USER-" + user]
+	if !ok {
+		login_failures = model.LoginFailures{ ID: "USER-" + user, SK: "LOCKOUT", User: user }
+	}
+	login_failures.LockedUntil = locked_until.Unix()
+	login_failures.ExpiresAt = locked_until.Unix()
+	login_failures.Updated_at = time.Now()
+
+	r.login_failures["USER-" + user] = login_failures
+
+	return nil
+}
+
+func (r *RepoMemory) ResetLoginFailures(ctx context.Context, user string) error{
+	childLogger.Debug().Msg("ResetLoginFailures")
+
+	ctx, span := observability.Span(ctx, "repo.ResetLoginFailures")	
+    defer span.End()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.login_failures, "USER-" + user)
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package repository_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/usecase/credential/repository"
+	"github.com/lambda-go-autentication/internal/usecase/credential/repository/repositorytest"
+)
+
+func TestRepoMemoryConformance(t *testing.T) {
+	repositorytest.Run(t, repository.NewRepoMemory())
+}
+
+// LoadCredential must return what the two reads it replaces (Login + QueryCredentialScope) return
+func TestRepoMemoryLoadCredential(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewRepoMemory()
+
+	cases := []struct {
+		name	string
+		user	model.Credential
+		scope	[]string
+	}{
+		{ name: "with scopes", user: model.Credential{User: "007", Password: "hash", UsagePlan: "tier1", SigningAlg: "ES256"}, scope: []string{"payment.read", "payment.write"} },
+		{ name: "without scopes", user: model.Credential{User: "008", Password: "hash", UsagePlan: "tier2"} },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := repo.SignIn(ctx, c.user); err != nil {
+				t.Fatal(err)
+			}
+			if c.scope != nil {
+				if _, err := repo.AddScope(ctx, model.CredentialScope{User: c.user.User, Scope: c.scope}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			login, err := repo.Login(ctx, c.user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			credential_scope, err := repo.QueryCredentialScope(ctx, c.user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			credential_partition, err := repo.LoadCredential(ctx, c.user)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(credential_partition.Credential, *login) {
+				t.Errorf("LoadCredential credential = %+v, Login = %+v", credential_partition.Credential, *login)
+			}
+			if !reflect.DeepEqual(credential_partition.CredentialScope.Scope, credential_scope.Scope) {
+				t.Errorf("LoadCredential scope = %v, QueryCredentialScope = %v", credential_partition.CredentialScope.Scope, credential_scope.Scope)
+			}
+		})
+	}
+}
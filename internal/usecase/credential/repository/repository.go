@@ -0,0 +1,63 @@
+package repository
+
+import(
+	"context"
+	"time"
+
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+// CredentialStore keeps the credentials (USER- items)
+type CredentialStore interface {
+	// SignIn creates or replaces the credential
+	SignIn(ctx context.Context, user_credential model.Credential) (*model.Credential, error)
+	// CreateCredential creates the credential, erro.ErrCredentialExists when the user already exists
+	CreateCredential(ctx context.Context, user_credential model.Credential) (*model.Credential, error)
+	// Login reads the credential, erro.ErrNotFound when the user does not exist
+	Login(ctx context.Context, user_credential model.Credential) (*model.Credential, error)
+	// LoadCredential reads the credential with its scopes, roles and mfa in one round trip, erro.ErrNotFound when the user does not exist
+	LoadCredential(ctx context.Context, user_credential model.Credential) (*model.CredentialPartition, error)
+}
+
+// ScopeStore keeps the scopes of the credentials and the scopes accepted by the resource servers
+type ScopeStore interface {
+	// AddScope replaces the scopes of the credential
+	AddScope(ctx context.Context, credential_scope model.CredentialScope) (*model.CredentialScope, error)
+	// QueryCredentialScope returns the scopes of the credential, empty (without error) when there are none
+	QueryCredentialScope(ctx context.Context, user_credential model.Credential) (*model.CredentialScope, error)
+	// AddResourceServer creates or replaces the resource server
+	AddResourceServer(ctx context.Context, resource_server model.ResourceServer) (*model.ResourceServer, error)
+	// QueryResourceServer reads the resource server, erro.ErrAudienceUnknown when it is not registered
+	QueryResourceServer(ctx context.Context, audience string) (*model.ResourceServer, error)
+}
+
+// RevocationStore keeps the revoked token ids until the token expiration
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, jwt_id string, expires_at time.Time) error
+	// IsTokenRevoked is false once the expiration is reached (the token is refused anyway)
+	IsTokenRevoked(ctx context.Context, jwt_id string) (bool, error)
+}
+
+// LockoutStore counts the failed logins of the credentials (the LOCKOUT item), LoadCredential returns them
+type LockoutStore interface {
+	// AddLoginFailure counts a failed login, the count restarts once the window of the first failure has passed
+	AddLoginFailure(ctx context.Context, user string, window time.Duration) (*model.LoginFailures, error)
+	// LockLogin refuses the logins of the credential until the time informed
+	LockLogin(ctx context.Context, user string, locked_until time.Time) error
+	// ResetLoginFailures removes the failed logins, no failures is not an error
+	ResetLoginFailures(ctx context.Context, user string) error
+}
+
+// Repository is the storage used by the credential usecase, implemented by RepoCredential (DynamoDB), RepoSQL and RepoMemory
+type Repository interface {
+	CredentialStore
+	ScopeStore
+	RevocationStore
+	LockoutStore
+}
+
+var (
+	_ Repository = (*RepoCredential)(nil)
+	_ Repository = (*RepoSQL)(nil)
+	_ Repository = (*RepoMemory)(nil)
+)
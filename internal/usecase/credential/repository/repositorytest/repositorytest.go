@@ -0,0 +1,374 @@
+// Package repositorytest is the conformance suite of the repository.Repository implementations.
+// It is a regular package (like testing/fstest) so the same cases run from the tests of each backend:
+// the memory store always, a DynamoDB table with TABLE_NAME and a sql database with DATABASE_DSN.
+package repositorytest
+
+import(
+	"fmt"
+	"sync"
+	"time"
+	"errors"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/usecase/credential/repository"
+)
+
+type conformanceCase struct {
+	name	string
+	run		func(ctx context.Context, repo repository.Repository, suffix string) error
+}
+
+var cases = []conformanceCase{
+	{"login unknown user", loginUnknownUser},
+	{"create credential conflict", createCredentialConflict},
+	{"create credential concurrent", createCredentialConcurrent},
+	{"sign in overwrites", signInOverwrites},
+	{"credential scope", credentialScope},
+	{"load credential", loadCredential},
+	{"resource server", resourceServer},
+	{"revoke token", revokeToken},
+	{"login failures", loginFailures},
+}
+
+// Run executes every case against the repository as a subtest.
+// The items are created with unique names, an existing table may be used
+func Run(t *testing.T, repo repository.Repository) {
+	t.Helper()
+
+	ctx := context.Background()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.run(ctx, repo, uuid.New().String()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func loginUnknownUser(ctx context.Context, repo repository.Repository, suffix string) error {
+	_, err := repo.Login(ctx, model.Credential{User: "unknown-" + suffix})
+	if !errors.Is(err, erro.ErrNotFound) {
+		return fmt.Errorf("Login got %v, want %v", err, erro.ErrNotFound)
+	}
+	return nil
+}
+
+func createCredentialConflict(ctx context.Context, repo repository.Repository, suffix string) error {
+	user := "create-" + suffix
+
+	created, err := repo.CreateCredential(ctx, model.Credential{User: user, Password: "first"})
+	if err != nil {
+		return fmt.Errorf("CreateCredential: %w", err)
+	}
+	if created.ID != "USER-" + user || created.SK != "USER-" + user {
+		return fmt.Errorf("CreateCredential keys got %s/%s", created.ID, created.SK)
+	}
+
+	_, err = repo.CreateCredential(ctx, model.Credential{User: user, Password: "second"})
+	if !errors.Is(err, erro.ErrCredentialExists) {
+		return fmt.Errorf("second CreateCredential got %v, want %v", err, erro.ErrCredentialExists)
+	}
+
+	// the conflict must not change the stored credential
+	stored, err := repo.Login(ctx, model.Credential{User: user})
+	if err != nil {
+		return fmt.Errorf("Login: %w", err)
+	}
+	if stored.Password != "first" {
+		return fmt.Errorf("Login password got %q, want %q", stored.Password, "first")
+	}
+	return nil
+}
+
+func createCredentialConcurrent(ctx context.Context, repo repository.Repository, suffix string) error {
+	user := "concurrent-" + suffix
+	workers := 8
+
+	var wg sync.WaitGroup
+	results := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			_, err := repo.CreateCredential(ctx, model.Credential{User: user})
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	created := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			created++
+		case errors.Is(err, erro.ErrCredentialExists):
+		default:
+			return fmt.Errorf("CreateCredential: %w", err)
+		}
+	}
+	if created != 1 {
+		return fmt.Errorf("CreateCredential succeeded %d times, want 1", created)
+	}
+	return nil
+}
+
+func signInOverwrites(ctx context.Context, repo repository.Repository, suffix string) error {
+	user := "signin-" + suffix
+
+	if _, err := repo.SignIn(ctx, model.Credential{User: user, UsagePlan: "basic"}); err != nil {
+		return fmt.Errorf("SignIn: %w", err)
+	}
+	if _, err := repo.SignIn(ctx, model.Credential{User: user, UsagePlan: "premium", SigningAlg: "RS256"}); err != nil {
+		return fmt.Errorf("second SignIn: %w", err)
+	}
+
+	stored, err := repo.Login(ctx, model.Credential{User: user})
+	if err != nil {
+		return fmt.Errorf("Login: %w", err)
+	}
+	if stored.User != user || stored.UsagePlan != "premium" || stored.SigningAlg != "RS256" {
+		return fmt.Errorf("Login got %+v", stored)
+	}
+	if stored.Updated_at.IsZero() {
+		return fmt.Errorf("Login without updated_at")
+	}
+	return nil
+}
+
+func credentialScope(ctx context.Context, repo repository.Repository, suffix string) error {
+	user := "scope-" + suffix
+
+	// no scope is an empty result, not an error
+	empty, err := repo.QueryCredentialScope(ctx, model.Credential{User: user})
+	if err != nil {
+		return fmt.Errorf("QueryCredentialScope without scope: %w", err)
+	}
+	if len(empty.Scope) != 0 {
+		return fmt.Errorf("QueryCredentialScope without scope got %v", empty.Scope)
+	}
+
+	scopes := []string{"a.read", "a.write"}
+	if _, err := repo.AddScope(ctx, model.CredentialScope{User: user, Scope: scopes}); err != nil {
+		return fmt.Errorf("AddScope: %w", err)
+	}
+	// the store keeps its own copy
+	scopes[0] = "changed"
+
+	stored, err := repo.QueryCredentialScope(ctx, model.Credential{User: user})
+	if err != nil {
+		return fmt.Errorf("QueryCredentialScope: %w", err)
+	}
+	if !reflect.DeepEqual(stored.Scope, []string{"a.read", "a.write"}) {
+		return fmt.Errorf("QueryCredentialScope got %v", stored.Scope)
+	}
+	if stored.ID != "USER-" + user || stored.SK != "SCOPE-001" {
+		return fmt.Errorf("QueryCredentialScope keys got %s/%s", stored.ID, stored.SK)
+	}
+
+	// AddScope replaces the scopes
+	if _, err := repo.AddScope(ctx, model.CredentialScope{User: user, Scope: []string{"b.read"}}); err != nil {
+		return fmt.Errorf("second AddScope: %w", err)
+	}
+	stored, err = repo.QueryCredentialScope(ctx, model.Credential{User: user})
+	if err != nil {
+		return fmt.Errorf("QueryCredentialScope: %w", err)
+	}
+	if !reflect.DeepEqual(stored.Scope, []string{"b.read"}) {
+		return fmt.Errorf("QueryCredentialScope after replace got %v", stored.Scope)
+	}
+	return nil
+}
+
+func loadCredential(ctx context.Context, repo repository.Repository, suffix string) error {
+	user := "load-" + suffix
+
+	_, err := repo.LoadCredential(ctx, model.Credential{User: user})
+	if !errors.Is(err, erro.ErrNotFound) {
+		return fmt.Errorf("LoadCredential got %v, want %v", err, erro.ErrNotFound)
+	}
+
+	// the scopes alone are not a credential
+	if _, err := repo.AddScope(ctx, model.CredentialScope{User: user, Scope: []string{"a.read"}}); err != nil {
+		return fmt.Errorf("AddScope: %w", err)
+	}
+	_, err = repo.LoadCredential(ctx, model.Credential{User: user})
+	if !errors.Is(err, erro.ErrNotFound) {
+		return fmt.Errorf("LoadCredential without credential got %v, want %v", err, erro.ErrNotFound)
+	}
+
+	if _, err := repo.SignIn(ctx, model.Credential{User: user, Password: "secret", SigningAlg: "RS256"}); err != nil {
+		return fmt.Errorf("SignIn: %w", err)
+	}
+	credential_partition, err := repo.LoadCredential(ctx, model.Credential{User: user})
+	if err != nil {
+		return fmt.Errorf("LoadCredential: %w", err)
+	}
+	if credential_partition.Credential.User != user || credential_partition.Credential.Password != "secret" || credential_partition.Credential.SigningAlg != "RS256" {
+		return fmt.Errorf("LoadCredential credential got %+v", credential_partition.Credential)
+	}
+	if !reflect.DeepEqual(credential_partition.CredentialScope.Scope, []string{"a.read"}) {
+		return fmt.Errorf("LoadCredential scope got %v", credential_partition.CredentialScope.Scope)
+	}
+
+	// same result as the two queries
+	credential_scope, err := repo.QueryCredentialScope(ctx, model.Credential{User: user})
+	if err != nil {
+		return fmt.Errorf("QueryCredentialScope: %w", err)
+	}
+	if credential_scope.ID != credential_partition.CredentialScope.ID || credential_scope.SK != credential_partition.CredentialScope.SK {
+		return fmt.Errorf("LoadCredential scope keys got %s/%s, want %s/%s",	credential_partition.CredentialScope.ID, credential_partition.CredentialScope.SK,
+																				credential_scope.ID, credential_scope.SK)
+	}
+
+	// a credential without scope has an empty scope
+	other := "load-noscope-" + suffix
+	if _, err := repo.SignIn(ctx, model.Credential{User: other}); err != nil {
+		return fmt.Errorf("SignIn: %w", err)
+	}
+	credential_partition, err = repo.LoadCredential(ctx, model.Credential{User: other})
+	if err != nil {
+		return fmt.Errorf("LoadCredential: %w", err)
+	}
+	if len(credential_partition.CredentialScope.Scope) != 0 {
+		return fmt.Errorf("LoadCredential without scope got %v", credential_partition.CredentialScope.Scope)
+	}
+	return nil
+}
+
+func resourceServer(ctx context.Context, repo repository.Repository, suffix string) error {
+	audience := "api-" + suffix
+
+	_, err := repo.QueryResourceServer(ctx, audience)
+	if !errors.Is(err, erro.ErrAudienceUnknown) {
+		return fmt.Errorf("QueryResourceServer got %v, want %v", err, erro.ErrAudienceUnknown)
+	}
+
+	if _, err := repo.AddResourceServer(ctx, model.ResourceServer{Audience: audience, Scope: []string{"a.read"}}); err != nil {
+		return fmt.Errorf("AddResourceServer: %w", err)
+	}
+	if _, err := repo.AddResourceServer(ctx, model.ResourceServer{Audience: audience, Scope: []string{"a.read", "a.write"}}); err != nil {
+		return fmt.Errorf("second AddResourceServer: %w", err)
+	}
+
+	stored, err := repo.QueryResourceServer(ctx, audience)
+	if err != nil {
+		return fmt.Errorf("QueryResourceServer: %w", err)
+	}
+	if stored.Audience != audience || !reflect.DeepEqual(stored.Scope, []string{"a.read", "a.write"}) {
+		return fmt.Errorf("QueryResourceServer got %+v", stored)
+	}
+	return nil
+}
+
+func revokeToken(ctx context.Context, repo repository.Repository, suffix string) error {
+	revoked, err := repo.IsTokenRevoked(ctx, "unknown-" + suffix)
+	if err != nil {
+		return fmt.Errorf("IsTokenRevoked: %w", err)
+	}
+	if revoked {
+		return fmt.Errorf("IsTokenRevoked of an unknown token is true")
+	}
+
+	if err := repo.RevokeToken(ctx, "valid-" + suffix, time.Now().Add(time.Hour)); err != nil {
+		return fmt.Errorf("RevokeToken: %w", err)
+	}
+	// revoking twice is not an error
+	if err := repo.RevokeToken(ctx, "valid-" + suffix, time.Now().Add(time.Hour)); err != nil {
+		return fmt.Errorf("second RevokeToken: %w", err)
+	}
+	revoked, err = repo.IsTokenRevoked(ctx, "valid-" + suffix)
+	if err != nil {
+		return fmt.Errorf("IsTokenRevoked: %w", err)
+	}
+	if !revoked {
+		return fmt.Errorf("IsTokenRevoked of a revoked token is false")
+	}
+
+	// an expired revocation is ignored even before it is deleted
+	if err := repo.RevokeToken(ctx, "expired-" + suffix, time.Now().Add(-time.Minute)); err != nil {
+		return fmt.Errorf("RevokeToken expired: %w", err)
+	}
+	revoked, err = repo.IsTokenRevoked(ctx, "expired-" + suffix)
+	if err != nil {
+		return fmt.Errorf("IsTokenRevoked: %w", err)
+	}
+	if revoked {
+		return fmt.Errorf("IsTokenRevoked of an expired revocation is true")
+	}
+	return nil
+}
+
+func loginFailures(ctx context.Context, repo repository.Repository, suffix string) error {
+	user := "lockout-" + suffix
+	if _, err := repo.SignIn(ctx, model.Credential{User: user, Password: "secret"}); err != nil {
+		return fmt.Errorf("SignIn: %w", err)
+	}
+
+	for want := 1; want <= 3; want++ {
+		login_failures, err := repo.AddLoginFailure(ctx, user, time.Hour)
+		if err != nil {
+			return fmt.Errorf("AddLoginFailure: %w", err)
+		}
+		if login_failures.Failures != want {
+			return fmt.Errorf("AddLoginFailure failures got %d, want %d", login_failures.Failures, want)
+		}
+	}
+
+	locked_until := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := repo.LockLogin(ctx, user, locked_until); err != nil {
+		return fmt.Errorf("LockLogin: %w", err)
+	}
+	credential_partition, err := repo.LoadCredential(ctx, model.Credential{User: user})
+	if err != nil {
+		return fmt.Errorf("LoadCredential: %w", err)
+	}
+	if credential_partition.LoginFailures.Failures != 3 || credential_partition.LoginFailures.LockedUntil != locked_until.Unix() {
+		return fmt.Errorf("LoadCredential failures got %+v, want 3 locked until %d", credential_partition.LoginFailures, locked_until.Unix())
+	}
+	// the scopes are not changed by the failures item of the partition
+	if credential_partition.Credential.Password != "secret" || len(credential_partition.CredentialScope.Scope) != 0 {
+		return fmt.Errorf("LoadCredential got %+v", credential_partition)
+	}
+
+	if err := repo.ResetLoginFailures(ctx, user); err != nil {
+		return fmt.Errorf("ResetLoginFailures: %w", err)
+	}
+	// resetting twice is not an error
+	if err := repo.ResetLoginFailures(ctx, user); err != nil {
+		return fmt.Errorf("second ResetLoginFailures: %w", err)
+	}
+	credential_partition, err = repo.LoadCredential(ctx, model.Credential{User: user})
+	if err != nil {
+		return fmt.Errorf("LoadCredential: %w", err)
+	}
+	if credential_partition.LoginFailures.Failures != 0 || credential_partition.LoginFailures.LockedUntil != 0 {
+		return fmt.Errorf("LoadCredential after the reset got %+v", credential_partition.LoginFailures)
+	}
+
+	// an expired window is ignored even before it is deleted and the next failure restarts the count
+	if _, err := repo.AddLoginFailure(ctx, user, -time.Minute); err != nil {
+		return fmt.Errorf("AddLoginFailure expired: %w", err)
+	}
+	credential_partition, err = repo.LoadCredential(ctx, model.Credential{User: user})
+	if err != nil {
+		return fmt.Errorf("LoadCredential: %w", err)
+	}
+	if credential_partition.LoginFailures.Failures != 0 {
+		return fmt.Errorf("LoadCredential of an expired window got %+v", credential_partition.LoginFailures)
+	}
+	login_failures, err := repo.AddLoginFailure(ctx, user, time.Hour)
+	if err != nil {
+		return fmt.Errorf("AddLoginFailure: %w", err)
+	}
+	if login_failures.Failures != 1 {
+		return fmt.Errorf("AddLoginFailure after an expired window got %d, want 1", login_failures.Failures)
+	}
+	return nil
+}
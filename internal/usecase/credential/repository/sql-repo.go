@@ -0,0 +1,460 @@
+package repository
+
+import(
+	"time"
+	"errors"
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/pkg/observability"
+
+	database "github.com/lambda-go-autentication/pkg/database/sqldb"
+)
+
+// RepoSQL keeps the items in postgres or sqlite (database/sql), the schema is in pkg/database/sqldb/migrations
+type RepoSQL struct{
+	Repository	*database.Database
+}
+
+func NewRepoSQL(repository *database.Database) *RepoSQL{
+	childLogger.Debug().Msg("NewRepoSQL")
+
+	return &RepoSQL{
+		Repository: repository,
+	}
+}
+
+func (r *RepoSQL) SignIn(ctx context.Context, user_credential model.Credential) (*model.Credential, error){
+	childLogger.Debug().Msg("SignIn")
+
+	ctx, span := observability.Span(ctx, "repo.SignIn")	
+    defer span.End()
+
+	user_credential.ID 			= "USER-" + user_credential.User
+	user_credential.SK 			= "USER-" + user_credential.User
+	user_credential.Updated_at 	= time.Now().UTC()
+
+	_, err := r.Repository.Client.ExecContext(ctx,
+		r.Repository.Rebind(`INSERT INTO credentials (user_name, password, usage_plan, api_key, signing_alg, encryption_key, updated_at)
+								VALUES (?, ?, ?, ?, ?, ?, ?)
+								ON CONFLICT (user_name) DO UPDATE SET	password = excluded.password,
+																		usage_plan = excluded.usage_plan,
+																		api_key = excluded.api_key,
+																		signing_alg = excluded.signing_alg,
+																		encryption_key = excluded.encryption_key,
+																		updated_at = excluded.updated_at`),
+		user_credential.User,
+		user_credential.Password,
+		user_credential.UsagePlan,
+		user_credential.ApiKey,
+		user_credential.SigningAlg,
+		user_credential.EncryptionKey,
+		user_credential.Updated_at)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error SignIn ExecContext")
+		return nil, erro.ErrInsert
+	}
+
+	return &user_credential, nil
+}
+
+func (r *RepoSQL) CreateCredential(ctx context.Context, user_credential model.Credential) (*model.Credential, error){
+	childLogger.Debug().Msg("CreateCredential")
+
+	ctx, span := observability.Span(ctx, "repo.CreateCredential")	
+    defer span.End()
+
+	user_credential.ID 			= "USER-" + user_credential.User
+	user_credential.SK 			= "USER-" + user_credential.User
+	user_credential.Updated_at 	= time.Now().UTC()
+
+	result, err := r.Repository.Client.ExecContext(ctx,
+		r.Repository.Rebind(`INSERT INTO credentials (user_name, password, usage_plan, api_key, signing_alg, encryption_key, updated_at)
+								VALUES (?, ?, ?, ?, ?, ?, ?)
+								ON CONFLICT (user_name) DO NOTHING`),
+		user_credential.User,
+		user_credential.Password,
+		user_credential.UsagePlan,
+		user_credential.ApiKey,
+		user_credential.SigningAlg,
+		user_credential.EncryptionKey,
+		user_credential.Updated_at)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error CreateCredential ExecContext")
+		return nil, erro.ErrInsert
+	}
+
+	// no row inserted is the conflict (same as the attribute_not_exists(ID) condition)
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error RowsAffected")
+		return nil, erro.ErrInsert
+	}
+	if inserted == 0 {
+		return nil, erro.ErrCredentialExists
+	}
+
+	return &user_credential, nil
+}
+
+func (r *RepoSQL) Login(ctx context.Context, user_credential model.Credential) (*model.Credential, error){
+	childLogger.Debug().Msg("Login")
+
+	ctx, span := observability.Span(ctx, "repo.Login")	
+    defer span.End()
+
+	credential := model.Credential{}
+	err := r.Repository.Client.QueryRowContext(ctx,
+		r.Repository.Rebind(`SELECT user_name, password, usage_plan, api_key, signing_alg, encryption_key, updated_at
+								FROM credentials
+								WHERE user_name = ?`),
+		user_credential.User).Scan(	&credential.User,
+									&credential.Password,
+									&credential.UsagePlan,
+									&credential.ApiKey,
+									&credential.SigningAlg,
+									&credential.EncryptionKey,
+									&credential.Updated_at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, erro.ErrNotFound
+	}
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error Login QueryRowContext")
+		return nil, erro.ErrQuery
+	}
+	credential.ID = "USER-" + credential.User
+	credential.SK = "USER-" + credential.User
+
+	return &credential, nil
+}
+
+// LoadCredential reads the credential, its scopes and its failed logins with one join (there are no role and mfa tables)
+func (r *RepoSQL) LoadCredential(ctx context.Context, user_credential model.Credential) (*model.CredentialPartition, error){
+	childLogger.Debug().Msg("LoadCredential")
+
+	ctx, span := observability.Span(ctx, "repo.LoadCredential")	
+    defer span.End()
+
+	credential_partition := model.CredentialPartition{}
+	credential := &credential_partition.Credential
+
+	var scope sql.NullString
+	var scope_updated_at sql.NullTime
+	var failures, locked_until, expires_at sql.NullInt64
+	err := r.Repository.Client.QueryRowContext(ctx,
+		r.Repository.Rebind(`SELECT c.user_name, c.password, c.usage_plan, c.api_key, c.signing_alg, c.encryption_key, c.updated_at, s.scope, s.updated_at,
+									f.failures, f.locked_until, f.expires_at
+								FROM credentials c
+								LEFT JOIN credential_scopes s ON s.user_name = c.user_name
+								LEFT JOIN login_failures f ON f.user_name = c.user_name
+								WHERE c.user_name = ?`),
+		user_credential.User).Scan(	&credential.User,
+									&credential.Password,
+									&credential.UsagePlan,
+									&credential.ApiKey,
+									&credential.SigningAlg,
+									&credential.EncryptionKey,
+									&credential.Updated_at,
+									&scope,
+									&scope_updated_at,
+									&failures,
+									&locked_until,
+									&expires_at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, erro.ErrNotFound
+	}
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error LoadCredential QueryRowContext")
+		return nil, erro.ErrQuery
+	}
+	credential.ID = "USER-" + credential.User
+	credential.SK = "USER-" + credential.User
+
+	if scope.Valid {
+		if err := json.Unmarshal([]byte(scope.String), &credential_partition.CredentialScope.Scope); err != nil {
+			childLogger.Error().Err(err).Msg("error Unmarshal")
+			return nil, erro.ErrUnmarshal
+		}
+		credential_partition.CredentialScope.ID = credential.ID
+		credential_partition.CredentialScope.SK = "SCOPE-001"
+		credential_partition.CredentialScope.Updated_at = scope_updated_at.Time
+	}
+	// the expired rows are not returned, they are restarted by AddLoginFailure
+	if expires_at.Valid && time.Now().Unix() < expires_at.Int64 {
+		credential_partition.LoginFailures = model.LoginFailures{	ID: credential.ID,
+																	SK: "LOCKOUT",
+																	User: credential.User,
+																	Failures: int(failures.Int64),
+																	LockedUntil: locked_until.Int64,
+																	ExpiresAt: expires_at.Int64 }
+	}
+
+	return &credential_partition, nil
+}
+
+func (r *RepoSQL) AddScope(ctx context.Context, credential_scope model.CredentialScope) (*model.CredentialScope, error){
+	childLogger.Debug().Msg("AddScope")
+
+	ctx, span := observability.Span(ctx, "repo.AddScope")	
+    defer span.End()
+
+	credential_scope.ID 			= "USER-" + credential_scope.User
+	credential_scope.SK 			= "SCOPE-001"
+	credential_scope.Updated_at 	= time.Now().UTC()
+
+	scope, err := json.Marshal(credential_scope.Scope)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error Marshal")
+		return nil, erro.ErrUnmarshal
+	}
+
+	_, err = r.Repository.Client.ExecContext(ctx,
+		r.Repository.Rebind(`INSERT INTO credential_scopes (user_name, scope, updated_at)
+								VALUES (?, ?, ?)
+								ON CONFLICT (user_name) DO UPDATE SET	scope = excluded.scope,
+																		updated_at = excluded.updated_at`),
+		credential_scope.User,
+		string(scope),
+		credential_scope.Updated_at)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error AddScope ExecContext")
+		return nil, erro.ErrInsert
+	}
+
+	return &credential_scope, nil
+}
+
+func (r *RepoSQL) QueryCredentialScope(ctx context.Context, user_credential model.Credential) (*model.CredentialScope, error){
+	childLogger.Debug().Msg("QueryCredentialScope")
+
+	ctx, span := observability.Span(ctx, "repo.QueryCredentialScope")	
+    defer span.End()
+
+	// like the dynamo query the user is not returned and no scope is not an error
+	credential_scope_result := model.CredentialScope{}
+
+	var scope string
+	var updated_at time.Time
+	err := r.Repository.Client.QueryRowContext(ctx,
+		r.Repository.Rebind(`SELECT scope, updated_at FROM credential_scopes WHERE user_name = ?`),
+		user_credential.User).Scan(&scope, &updated_at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &credential_scope_result, nil
+	}
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error QueryCredentialScope QueryRowContext")
+		return nil, erro.ErrList
+	}
+
+	if err := json.Unmarshal([]byte(scope), &credential_scope_result.Scope); err != nil {
+		childLogger.Error().Err(err).Msg("error Unmarshal")
+		return nil, erro.ErrUnmarshal
+	}
+	credential_scope_result.ID = "USER-" + user_credential.User
+	credential_scope_result.SK = "SCOPE-001"
+	credential_scope_result.Updated_at = updated_at
+
+	return &credential_scope_result, nil
+}
+
+func (r *RepoSQL) AddResourceServer(ctx context.Context, resource_server model.ResourceServer) (*model.ResourceServer, error){
+	childLogger.Debug().Msg("AddResourceServer")
+
+	ctx, span := observability.Span(ctx, "repo.AddResourceServer")	
+    defer span.End()
+
+	resource_server.ID 			= "RESOURCE-" + resource_server.Audience
+	resource_server.SK 			= "RESOURCE-" + resource_server.Audience
+	resource_server.Updated_at 	= time.Now().UTC()
+
+	scope, err := json.Marshal(resource_server.Scope)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error Marshal")
+		return nil, erro.ErrUnmarshal
+	}
+
+	_, err = r.Repository.Client.ExecContext(ctx,
+		r.Repository.Rebind(`INSERT INTO resource_servers (audience, scope, updated_at)
+								VALUES (?, ?, ?)
+								ON CONFLICT (audience) DO UPDATE SET	scope = excluded.scope,
+																		updated_at = excluded.updated_at`),
+		resource_server.Audience,
+		string(scope),
+		resource_server.Updated_at)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error AddResourceServer ExecContext")
+		return nil, erro.ErrInsert
+	}
+
+	return &resource_server, nil
+}
+
+func (r *RepoSQL) QueryResourceServer(ctx context.Context, audience string) (*model.ResourceServer, error){
+	childLogger.Debug().Msg("QueryResourceServer")
+
+	ctx, span := observability.Span(ctx, "repo.QueryResourceServer")	
+    defer span.End()
+
+	resource_server := model.ResourceServer{}
+
+	var scope string
+	err := r.Repository.Client.QueryRowContext(ctx,
+		r.Repository.Rebind(`SELECT audience, scope, updated_at FROM resource_servers WHERE audience = ?`),
+		audience).Scan(&resource_server.Audience, &scope, &resource_server.Updated_at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, erro.ErrAudienceUnknown
+	}
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error QueryResourceServer QueryRowContext")
+		return nil, erro.ErrQuery
+	}
+
+	if err := json.Unmarshal([]byte(scope), &resource_server.Scope); err != nil {
+		childLogger.Error().Err(err).Msg("error Unmarshal")
+		return nil, erro.ErrUnmarshal
+	}
+	resource_server.ID = "RESOURCE-" + resource_server.Audience
+	resource_server.SK = "RESOURCE-" + resource_server.Audience
+
+	return &resource_server, nil
+}
+
+func (r *RepoSQL) RevokeToken(ctx context.Context, jwt_id string, expires_at time.Time) error{
+	childLogger.Debug().Msg("RevokeToken")
+
+	ctx, span := observability.Span(ctx, "repo.RevokeToken")	
+    defer span.End()
+
+	// the expired rows are dropped here, there is no TTL
+	_, err := r.Repository.Client.ExecContext(ctx,
+		r.Repository.Rebind(`DELETE FROM revoked_tokens WHERE expires_at <= ?`),
+		time.Now().Unix())
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error RevokeToken delete expired")
+		return erro.ErrInsert
+	}
+
+	_, err = r.Repository.Client.ExecContext(ctx,
+		r.Repository.Rebind(`INSERT INTO revoked_tokens (jwt_id, expires_at, updated_at)
+								VALUES (?, ?, ?)
+								ON CONFLICT (jwt_id) DO UPDATE SET	expires_at = excluded.expires_at,
+																	updated_at = excluded.updated_at`),
+		jwt_id,
+		expires_at.Unix(),
+		time.Now().UTC())
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error RevokeToken ExecContext")
+		return erro.ErrInsert
+	}
+
+	return nil
+}
+
+func (r *RepoSQL) IsTokenRevoked(ctx context.Context, jwt_id string) (bool, error){
+	childLogger.Debug().Msg("IsTokenRevoked")
+
+	ctx, span := observability.Span(ctx, "repo.IsTokenRevoked")	
+    defer span.End()
+
+	var expires_at int64
+	err := r.Repository.Client.QueryRowContext(ctx,
+		r.Repository.Rebind(`SELECT expires_at FROM revoked_tokens WHERE jwt_id = ?`),
+		jwt_id).Scan(&expires_at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error IsTokenRevoked QueryRowContext")
+		return false, erro.ErrQuery
+	}
+
+	return time.Now().Unix() < expires_at, nil
+}
+
+// AddLoginFailure adds one to the failures in a single statement, an expired row restarts with the first failure
+func (r *RepoSQL) AddLoginFailure(ctx context.Context, user string, window time.Duration) (*model.LoginFailures, error){
+	childLogger.Debug().Msg("AddLoginFailure")
+
+	ctx, span := observability.Span(ctx, "repo.AddLoginFailure")	
+    defer span.End()
+
+	now := time.Now().UTC()
+	_, err := r.Repository.Client.ExecContext(ctx,
+		r.Repository.Rebind(`INSERT INTO login_failures (user_name, failures, locked_until, expires_at, updated_at)
+								VALUES (?, 1, 0, ?, ?)
+								ON CONFLICT (user_name) DO UPDATE SET
+									failures = CASE WHEN login_failures.expires_at <= ? THEN 1 ELSE login_failures.failures + 1 END,
+									locked_until = CASE WHEN login_failures.expires_at <= ? THEN 0 ELSE login_failures.locked_until END,
+									expires_at = CASE WHEN login_failures.expires_at <= ? THEN excluded.expires_at ELSE login_failures.expires_at END,
+									updated_at = excluded.updated_at`),
+		user,
+		now.Add(window).Unix(),
+		now,
+		now.Unix(),
+		now.Unix(),
+		now.Unix())
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error AddLoginFailure ExecContext")
+		return nil, erro.ErrInsert
+	}
+
+	login_failures := model.LoginFailures{ ID: "USER-" + user, SK: "LOCKOUT" }
+	err = r.Repository.Client.QueryRowContext(ctx,
+		r.Repository.Rebind(`SELECT user_name, failures, locked_until, expires_at, updated_at FROM login_failures WHERE user_name = ?`),
+		user).Scan(	&login_failures.User,
+					&login_failures.Failures,
+					&login_failures.LockedUntil,
+					&login_failures.ExpiresAt,
+					&login_failures.Updated_at)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error AddLoginFailure QueryRowContext")
+		return nil, erro.ErrQuery
+	}
+
+	return &login_failures, nil
+}
+
+func (r *RepoSQL) LockLogin(ctx context.Context, user string, locked_until time.Time) error{
+	childLogger.Debug().Msg("LockLogin")
+
+	ctx, span := observability.Span(ctx, "repo.LockLogin")	
+    defer span.End()
+
+	// the row lives until the end of the lock
+	_, err := r.Repository.Client.ExecContext(ctx,
+		r.Repository.Rebind(`INSERT INTO login_failures (user_name, failures, locked_until, expires_at, updated_at)
+								VALUES (?, 0, ?, ?, ?)
+								ON CONFLICT (user_name) DO UPDATE SET	locked_until = excluded.locked_until,
+																		expires_at = excluded.expires_at,
+																		updated_at = excluded.updated_at`),
+		user,
+		locked_until.Unix(),
+		locked_until.Unix(),
+		time.Now().UTC())
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error LockLogin ExecContext")
+		return erro.ErrInsert
+	}
+
+	return nil
+}
+
+func (r *RepoSQL) ResetLoginFailures(ctx context.Context, user string) error{
+	childLogger.Debug().Msg("ResetLoginFailures")
+
+	ctx, span := observability.Span(ctx, "repo.ResetLoginFailures")	
+    defer span.End()
+
+	_, err := r.Repository.Client.ExecContext(ctx,
+		r.Repository.Rebind(`DELETE FROM login_failures WHERE user_name = ?`),
+		user)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("error ResetLoginFailures ExecContext")
+		return erro.ErrInsert
+	}
+
+	return nil
+}
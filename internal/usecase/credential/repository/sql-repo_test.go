@@ -0,0 +1,47 @@
+package repository_test
+
+import (
+	"os"
+	"context"
+	"testing"
+
+	"github.com/lambda-go-autentication/internal/usecase/credential/repository"
+	"github.com/lambda-go-autentication/internal/usecase/credential/repository/repositorytest"
+
+	"github.com/lambda-go-autentication/pkg/database/sqldb"
+)
+
+func newRepoSQL(t *testing.T, driver string, dsn string) *repository.RepoSQL {
+	t.Helper()
+
+	ctx := context.Background()
+	db, err := sqldb.NewDatabase(ctx, driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Client.Close() })
+
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return repository.NewRepoSQL(db)
+}
+
+// the sqlite driver is pure go, the suite always runs on an in memory database
+func TestRepoSQLiteConformance(t *testing.T) {
+	repositorytest.Run(t, newRepoSQL(t, sqldb.DriverSQLite, ":memory:"))
+}
+
+// DATABASE_DSN (DATABASE_BACKEND postgres by default) runs the suite on a real database, the test is skipped without it
+func TestRepoSQLConformance(t *testing.T) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("DATABASE_DSN not set, the sql repository is only tested on sqlite")
+	}
+	driver := os.Getenv("DATABASE_BACKEND")
+	if driver == "" {
+		driver = sqldb.DriverPostgres
+	}
+
+	repositorytest.Run(t, newRepoSQL(t, driver, dsn))
+}
@@ -6,43 +6,47 @@ import(
 	"encoding/json"
 
 	"github.com/rs/zerolog/log"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	
 	"github.com/lambda-go-autentication/internal/usecase/jwt"
 
 	"github.com/lambda-go-autentication/pkg/observability"
+	"github.com/lambda-go-autentication/pkg/util"
 	"github.com/lambda-go-autentication/internal/model"
 	"github.com/lambda-go-autentication/internal/erro"
-
-	"github.com/aws/aws-lambda-go/events"
 )
 
 var childLogger = log.With().Str("adapter", "AdapterJwt").Logger()
 
 type AdapterJwt struct{
+	appServer	*model.AppServer
 	usecaseJwt	*jwt.UseCaseJwt
 }
 
-func NewAdapterJwt(usecaseJwt *jwt.UseCaseJwt) *AdapterJwt{
+func NewAdapterJwt(	appServer	*model.AppServer,
+					usecaseJwt *jwt.UseCaseJwt) *AdapterJwt{
 	childLogger.Debug().Msg("NewAdapterJwt")
 
 	return &AdapterJwt{
+		appServer: appServer,
 		usecaseJwt: usecaseJwt,
 	}
 }
 
-type MessageBody struct {
-	ErrorMsg 	*string `json:"error,omitempty"`
-	Msg 		*string `json:"message,omitempty"`
+// The discovery documents change only on key rotation
+const cacheControlWellKnown = "public, max-age=3600"
+
+// ApiErrorResponse is the RFC 7807 (application/problem+json) response of the error, the status comes from the erro type
+func ApiErrorResponse(ctx context.Context, err error) (*model.HttpResponse, error){
+	return erro.ProblemResponse(ctx, err), nil
 }
 
-func ApiHandlerResponse(statusCode int, body interface{}) (*events.APIGatewayProxyResponse, error){
+func ApiHandlerResponse(statusCode int, body interface{}) (*model.HttpResponse, error){
 	stringBody, err := json.Marshal(&body)
 	if err != nil {
 		return nil, erro.ErrUnmarshal
 	}
 
-	return &events.APIGatewayProxyResponse{
+	return &model.HttpResponse{
 		StatusCode: statusCode,
 		Headers: map[string]string{
 			"Content-Type": "application/json",
@@ -51,98 +55,146 @@ func ApiHandlerResponse(statusCode int, body interface{}) (*events.APIGatewayPro
 	}, nil
 }
 
-func (h *AdapterJwt) TokenValidation(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+func (h *AdapterJwt) TokenValidation(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
 	childLogger.Debug().Msg("TokenValidation")
 
-	span := observability.Span(ctx, "adapter.tokenValidation")	
+	ctx, span := observability.Span(ctx, "adapter.tokenValidation")	
     defer span.End()
 
-	var token model.Credential
-    if err := json.Unmarshal([]byte(req.Body), &token); err != nil {
-        return ApiHandlerResponse(http.StatusBadRequest, MessageBody{ErrorMsg: aws.String(err.Error())})
-    }
+	var token model.TokenRequest
+	if err := util.DecodeRequest(req.Body, &token); err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
 
-	response, err := h.usecaseJwt.TokenValidation(ctx, token.Token)
+	response, err := h.usecaseJwt.TokenValidation(ctx, token.Token, token.Audience)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusUnauthorized, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
 	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusInternalServerError, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
 	return handlerResponse, nil
 }
 
-func (h *AdapterJwt) TokenValidationRSA(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+func (h *AdapterJwt) TokenValidationRSA(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
 	childLogger.Debug().Msg("TokenValidationRSA")
 
-	span := observability.Span(ctx, "adapter.TokenValidationRSA")	
+	ctx, span := observability.Span(ctx, "adapter.TokenValidationRSA")	
     defer span.End()
 
-	var token model.Credential
-    if err := json.Unmarshal([]byte(req.Body), &token); err != nil {
-        return ApiHandlerResponse(http.StatusBadRequest, MessageBody{ErrorMsg: aws.String(err.Error())})
-    }
+	var token model.TokenRequest
+	if err := util.DecodeRequest(req.Body, &token); err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
 
-	response, err := h.usecaseJwt.TokenValidationRSA(ctx, token.Token)
+	response, err := h.usecaseJwt.TokenValidationRSA(ctx, token.Token, token.Audience)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusUnauthorized, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
 	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusInternalServerError, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
 	return handlerResponse, nil
 }
 
-func (h *AdapterJwt) RefreshToken(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+func (h *AdapterJwt) RefreshToken(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
 	childLogger.Debug().Msg("RefreshToken")
 
-	span := observability.Span(ctx, "adapter.refreshToken")	
+	ctx, span := observability.Span(ctx, "adapter.refreshToken")	
     defer span.End()
 
-	var token model.Credential
-    if err := json.Unmarshal([]byte(req.Body), &token); err != nil {
-        return ApiHandlerResponse(http.StatusBadRequest, MessageBody{ErrorMsg: aws.String(err.Error())})
-    }
+	var token model.TokenRequest
+	if err := util.DecodeRequest(req.Body, &token); err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
 
 	response, err := h.usecaseJwt.RefreshToken(ctx, token.Token)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusUnauthorized, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
 	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusInternalServerError, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
 	return handlerResponse, nil
 }
 
-func (h *AdapterJwt) RefreshTokenRSA(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+func (h *AdapterJwt) RefreshTokenRSA(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
 	childLogger.Debug().Msg("RefreshTokenRSA")
 
-	span := observability.Span(ctx, "adapter.RefreshTokenRSA")	
+	ctx, span := observability.Span(ctx, "adapter.RefreshTokenRSA")	
     defer span.End()
 
-	var token model.Credential
-    if err := json.Unmarshal([]byte(req.Body), &token); err != nil {
-        return ApiHandlerResponse(http.StatusBadRequest, MessageBody{ErrorMsg: aws.String(err.Error())})
-    }
+	var token model.TokenRequest
+	if err := util.DecodeRequest(req.Body, &token); err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
 
 	response, err := h.usecaseJwt.RefreshTokenRSA(ctx, token.Token)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusUnauthorized, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
 	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
 	if err != nil {
-		return ApiHandlerResponse(http.StatusInternalServerError, MessageBody{ErrorMsg: aws.String(err.Error())})
+		return ApiErrorResponse(ctx, err)
 	}
 
 	return handlerResponse, nil
-}
\ No newline at end of file
+}
+
+func (h *AdapterJwt) OpenIDConfiguration(ctx context.Context, req model.HttpRequest) (*model.HttpResponse, error) {
+	childLogger.Debug().Msg("OpenIDConfiguration")
+
+	ctx, span := observability.Span(ctx, "adapter.OpenIDConfiguration")	
+    defer span.End()
+
+	// only what the service does: there is no authorization endpoint (so no response type) and /loginRSA is not an
+	// OAuth token endpoint, the id tokens are signed only by the asymmetric keys
+	issuer := util.GetIssuerURL(h.appServer.InfoApp)
+	openIDConfiguration := model.OpenIDConfiguration{
+		Issuer: issuer,
+		JwksURI: issuer + "/.well-known/jwks.json",
+		UserinfoEndpoint: issuer + "/userinfo",
+		ScopesSupported: []string{jwt.ScopeOpenID},
+		SubjectTypesSupported: []string{"public"},
+		IDTokenSigningAlgValuesSupported: h.usecaseJwt.IDTokenSigningAlgs(),
+		ClaimsSupported: []string{"iss","sub","aud","exp","iat","auth_time","nonce","at_hash","preferred_username","usage_plan","updated_at"},
+	}
+
+	handlerResponse, err := ApiHandlerResponse(http.StatusOK, openIDConfiguration)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+	handlerResponse.Headers["Cache-Control"] = cacheControlWellKnown
+
+	return handlerResponse, nil
+}
+
+func (h *AdapterJwt) JWKS(ctx context.Context) (*model.HttpResponse, error) {
+	childLogger.Debug().Msg("JWKS")
+
+	ctx, span := observability.Span(ctx, "adapter.JWKS")	
+    defer span.End()
+
+	response, err := h.usecaseJwt.JWKS(ctx)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+
+	handlerResponse, err := ApiHandlerResponse(http.StatusOK, response)
+	if err != nil {
+		return ApiErrorResponse(ctx, err)
+	}
+	handlerResponse.Headers["Cache-Control"] = cacheControlWellKnown
+
+	return handlerResponse, nil
+}
@@ -0,0 +1,182 @@
+package adapter
+
+import (
+	"context"
+	"testing"
+	"net/http"
+	"strings"
+	"math/big"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/json"
+	"encoding/base64"
+
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/usecase/jwt"
+)
+
+func newTestAdapterJwt(t *testing.T, keys ...*jwt.Key) *AdapterJwt {
+	t.Helper()
+
+	keyring := jwt.NewKeyring()
+	for _, key := range keys {
+		if err := keyring.Add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appServer := &model.AppServer{ InfoApp: &model.InfoApp{ IssuerURL: "https://auth.domain.com/" } }
+	return NewAdapterJwt(appServer, jwt.NewUseCaseJwt(keyring))
+}
+
+func testRSAKey(t *testing.T, kid string, state jwt.KeyState) *jwt.Key {
+	t.Helper()
+
+	private_key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &jwt.Key{ Kid: kid, Alg: "RS256", State: state, Private: private_key, Public: &private_key.PublicKey }
+}
+
+func TestOpenIDConfiguration(t *testing.T) {
+	adapterJwt := newTestAdapterJwt(t,	&jwt.Key{ Kid: "hs", Alg: "HS256", State: jwt.KeyStateActive, Secret: []byte("secret") },
+										testRSAKey(t, "rsa", jwt.KeyStateActive))
+
+	// the Host header of the request never changes the issuer
+	request := model.HttpRequest{ DomainName: "evil.example.com", Headers: map[string]string{ "host": "evil.example.com" } }
+	response, err := adapterJwt.OpenIDConfiguration(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK || response.Headers["Cache-Control"] != cacheControlWellKnown {
+		t.Fatalf("status = %d, Cache-Control = %s", response.StatusCode, response.Headers["Cache-Control"])
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal([]byte(response.Body), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name	string
+		field	string
+		want	interface{}
+	}{
+		{ name: "issuer from ISSUER_URL", field: "issuer", want: "https://auth.domain.com" },
+		{ name: "jwks uri of the issuer", field: "jwks_uri", want: "https://auth.domain.com/.well-known/jwks.json" },
+		{ name: "userinfo endpoint", field: "userinfo_endpoint", want: "https://auth.domain.com/userinfo" },
+		{ name: "only the asymmetric algorithms with an active key", field: "id_token_signing_alg_values_supported", want: []interface{}{"RS256"} },
+		{ name: "no token endpoint", field: "token_endpoint", want: nil },
+		{ name: "no response types without an authorization endpoint", field: "response_types_supported", want: nil },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, _ := json.Marshal(document[c.field])
+			want, _ := json.Marshal(c.want)
+			if string(got) != string(want) {
+				t.Errorf("%s = %s, want %s", c.field, got, want)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	active := testRSAKey(t, "rsa-active", jwt.KeyStateActive)
+	ec_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptionKey, err := jwt.EncryptionKey(testRSAKey(t, "rsa-enc", jwt.KeyStatePending))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("secret-of-the-hs256-key-0123456789")
+	adapterJwt := newTestAdapterJwt(t,	&jwt.Key{ Kid: "hs", Alg: "HS256", State: jwt.KeyStateActive, Secret: secret },
+										active,
+										testRSAKey(t, "rsa-pending", jwt.KeyStatePending),
+										testRSAKey(t, "rsa-retiring", jwt.KeyStateRetiring),
+										testRSAKey(t, "rsa-retired", jwt.KeyStateRetired),
+										&jwt.Key{ Kid: "ec", Alg: "ES256", State: jwt.KeyStateActive, Private: ec_key, Public: &ec_key.PublicKey },
+										encryptionKey)
+
+	response, err := adapterJwt.JWKS(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK || response.Headers["Cache-Control"] != cacheControlWellKnown {
+		t.Fatalf("status = %d, Cache-Control = %s", response.StatusCode, response.Headers["Cache-Control"])
+	}
+
+	// the secrets and the private parts are never published
+	for _, forbidden := range []string{ string(secret), base64.RawURLEncoding.EncodeToString(secret), `"k"`, `"d"`, `"p"`, `"q"` } {
+		if strings.Contains(response.Body, forbidden) {
+			t.Errorf("JWKS %s contains %s", response.Body, forbidden)
+		}
+	}
+
+	var jwks model.Jwks
+	if err := json.Unmarshal([]byte(response.Body), &jwks); err != nil {
+		t.Fatal(err)
+	}
+	published := map[string]model.Jwk{}
+	for _, jwk := range jwks.Keys {
+		published[jwk.Kid] = jwk
+	}
+
+	cases := []struct {
+		name	string
+		kid		string
+		want	*model.Jwk
+	}{
+		{ name: "active RSA key", kid: "rsa-active", want: &model.Jwk{ Kty: "RSA", Kid: "rsa-active", Use: "sig", Alg: "RS256" } },
+		{ name: "pending key ahead of the activation", kid: "rsa-pending", want: &model.Jwk{ Kty: "RSA", Kid: "rsa-pending", Use: "sig", Alg: "RS256" } },
+		{ name: "retiring key for the outstanding tokens", kid: "rsa-retiring", want: &model.Jwk{ Kty: "RSA", Kid: "rsa-retiring", Use: "sig", Alg: "RS256" } },
+		{ name: "EC key with its curve", kid: "ec", want: &model.Jwk{ Kty: "EC", Kid: "ec", Use: "sig", Alg: "ES256", Crv: "P-256" } },
+		{ name: "encryption key", kid: encryptionKey.Kid, want: &model.Jwk{ Kty: "RSA", Kid: encryptionKey.Kid, Use: "enc", Alg: jwt.JweAlg } },
+		{ name: "no HS256 secret", kid: "hs" },
+		{ name: "no retired key", kid: "rsa-retired" },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			jwk, ok := published[c.kid]
+			if c.want == nil {
+				if ok {
+					t.Fatalf("kid %s published: %+v", c.kid, jwk)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("kid %s not published", c.kid)
+			}
+			if jwk.Kty != c.want.Kty || jwk.Use != c.want.Use || jwk.Alg != c.want.Alg || jwk.Crv != c.want.Crv {
+				t.Errorf("jwk = %+v, want %+v", jwk, *c.want)
+			}
+		})
+	}
+	if len(jwks.Keys) != 5 {
+		t.Errorf("JWKS keys = %d, want 5", len(jwks.Keys))
+	}
+
+	// the published members rebuild the public keys
+	rsa_jwk := published["rsa-active"]
+	n, _ := base64.RawURLEncoding.DecodeString(rsa_jwk.N)
+	e, _ := base64.RawURLEncoding.DecodeString(rsa_jwk.E)
+	rsa_public := &rsa.PublicKey{ N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64()) }
+	if !rsa_public.Equal(active.Public) {
+		t.Error("n and e of the RSA jwk are not the public key")
+	}
+	ec_jwk := published["ec"]
+	x, _ := base64.RawURLEncoding.DecodeString(ec_jwk.X)
+	y, _ := base64.RawURLEncoding.DecodeString(ec_jwk.Y)
+	if len(x) != 32 || len(y) != 32 {
+		t.Fatalf("EC coordinates = %d and %d bytes, want 32", len(x), len(y))
+	}
+	ec_public := &ecdsa.PublicKey{ Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y) }
+	if !ec_public.Equal(&ec_key.PublicKey) {
+		t.Error("x and y of the EC jwk are not the public key")
+	}
+}
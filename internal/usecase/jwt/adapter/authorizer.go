@@ -0,0 +1,148 @@
+package adapter
+
+import(
+	"context"
+	"strings"
+	"errors"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lambda-go-autentication/pkg/observability"
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+// APIGW answers 401 only when the authorizer fails with this exact message
+var ErrAuthorizerUnauthorized = errors.New("Unauthorized")
+
+// the scopes not configured in AUTHORIZER_SCOPE_ROUTES follow the convention <resource>.read and <resource>.write
+var scopeActionMethods = map[string][]string{
+	"read":		{"GET"},
+	"write":	{"POST", "PUT", "PATCH", "DELETE"},
+}
+
+// AuthorizerToken handles the TOKEN authorizer, the token comes in the identity source (Authorization header)
+func (h *AdapterJwt) AuthorizerToken(ctx context.Context, req events.APIGatewayCustomAuthorizerRequest) (*events.APIGatewayCustomAuthorizerResponse, error) {
+	childLogger.Debug().Msg("AuthorizerToken")
+
+	ctx, span := observability.Span(ctx, "adapter.AuthorizerToken")
+    defer span.End()
+
+	return h.authorize(ctx, req.AuthorizationToken, req.MethodArn)
+}
+
+// AuthorizerRequest handles the REQUEST authorizer, the token comes in the Authorization header
+func (h *AdapterJwt) AuthorizerRequest(ctx context.Context, req events.APIGatewayCustomAuthorizerRequestTypeRequest) (*events.APIGatewayCustomAuthorizerResponse, error) {
+	childLogger.Debug().Msg("AuthorizerRequest")
+
+	ctx, span := observability.Span(ctx, "adapter.AuthorizerRequest")
+    defer span.End()
+
+	authorization := req.Headers["Authorization"]
+	if authorization == "" {
+		authorization = req.Headers["authorization"]
+	}
+
+	return h.authorize(ctx, authorization, req.MethodArn)
+}
+
+func (h *AdapterJwt) authorize(ctx context.Context, authorization string, methodArn string) (*events.APIGatewayCustomAuthorizerResponse, error) {
+	token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	if token == "" {
+		return nil, ErrAuthorizerUnauthorized
+	}
+
+	claims, err := h.usecaseJwt.ParseAccessToken(ctx, token)
+	if err != nil {
+		childLogger.Debug().Err(err).Msg("token rejected")
+		observability.SpanError(trace.SpanFromContext(ctx), err)
+		return nil, ErrAuthorizerUnauthorized
+	}
+	ctx = observability.WithSubject(ctx, claims.Username)
+
+	resources := scopeResources(methodArn, claims.Scope, h.appServer.InfoApp.AuthorizerScopeRoutes)
+
+	effect := "Allow"
+	if len(resources) == 0 {
+		effect, resources = "Deny", []string{methodArn}
+	}
+
+	response := events.APIGatewayCustomAuthorizerResponse{
+		PrincipalID: claims.Username,
+		PolicyDocument: events.APIGatewayCustomAuthorizerPolicy{
+			Version: "2012-10-17",
+			Statement: []events.IAMPolicyStatement{
+				{
+					Action: []string{"execute-api:Invoke"},
+					Effect: effect,
+					Resource: resources,
+				},
+			},
+		},
+		Context: authorizerContext(claims),
+	}
+
+	return &response, nil
+}
+
+// scopeResources maps the token scopes to method ARNs of the api and stage of the methodArn
+// arn:aws:execute-api:{region}:{account}:{api-id}/{stage}/{method}/{resource path}
+func scopeResources(methodArn string, scopes []string, scopeRoutes map[string][]string) []string {
+	arnParts := strings.SplitN(methodArn, ":", 6)
+	if len(arnParts) != 6 {
+		return nil
+	}
+	apiParts := strings.SplitN(arnParts[5], "/", 3)
+	if len(apiParts) < 2 {
+		return nil
+	}
+	arnBase := strings.Join(arnParts[:5], ":") + ":" + apiParts[0] + "/" + apiParts[1] + "/"
+
+	resources := []string{}
+	seen := map[string]bool{}
+	add := func(route string) {
+		if !seen[route] {
+			seen[route] = true
+			resources = append(resources, arnBase + route)
+		}
+	}
+
+	for _, scope := range scopes {
+		if routes, ok := scopeRoutes[scope]; ok {
+			for _, route := range routes {
+				add(strings.TrimPrefix(route, "/"))
+			}
+			continue
+		}
+
+		resource, action, found := strings.Cut(scope, ".")
+		if !found || resource == "" {
+			continue
+		}
+		for _, method := range scopeActionMethods[action] {
+			add(method + "/" + resource)
+			add(method + "/" + resource + "/*")
+		}
+	}
+
+	return resources
+}
+
+// authorizerContext passes the claims to the integration ($context.authorizer.<key>), only flat values are accepted
+func authorizerContext(claims *model.JwtData) map[string]interface{} {
+	authorizerContext := map[string]interface{}{
+		"username":		claims.Username,
+		"scope":		strings.Join(claims.Scope, " "),
+		"jwt_id":		claims.JwtId,
+		"token_use":	claims.TokenUse,
+		"iss":			claims.ISS,
+	}
+	if len(claims.Audience) > 0 {
+		authorizerContext["aud"] = strings.Join(claims.Audience, " ")
+	}
+	if claims.ExpiresAt != nil {
+		authorizerContext["exp"] = claims.ExpiresAt.Unix()
+	}
+
+	return authorizerContext
+}
@@ -0,0 +1,135 @@
+package adapter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/usecase/jwt"
+)
+
+const testMethodArn = "arn:aws:execute-api:us-east-2:908671954593:abc123/prod/GET/payment/42"
+
+func TestScopeResources(t *testing.T) {
+	base := "arn:aws:execute-api:us-east-2:908671954593:abc123/prod/"
+
+	cases := []struct {
+		name		string
+		methodArn	string
+		scopes		[]string
+		scopeRoutes	map[string][]string
+		want		[]string
+	}{
+		{	name: "read scope", methodArn: testMethodArn, scopes: []string{"payment.read"},
+			want: []string{base + "GET/payment", base + "GET/payment/*"} },
+		{	name: "write scope", methodArn: testMethodArn, scopes: []string{"payment.write"},
+			want: []string{	base + "POST/payment", base + "POST/payment/*", base + "PUT/payment", base + "PUT/payment/*",
+							base + "PATCH/payment", base + "PATCH/payment/*", base + "DELETE/payment", base + "DELETE/payment/*"} },
+		{	name: "configured routes replace the convention", methodArn: testMethodArn, scopes: []string{"payment.read"},
+			scopeRoutes: map[string][]string{ "payment.read": {"/GET/payment/*", "GET/balance"} },
+			want: []string{base + "GET/payment/*", base + "GET/balance"} },
+		{	name: "repeated routes once", methodArn: testMethodArn, scopes: []string{"payment.read", "report.read"},
+			scopeRoutes: map[string][]string{ "report.read": {"GET/payment/*"} },
+			want: []string{base + "GET/payment", base + "GET/payment/*"} },
+		{	name: "scopes without action are ignored", methodArn: testMethodArn, scopes: []string{"admin", "openid", ".read", "payment.delete"},
+			want: []string{} },
+		{	name: "stage of the method arn", methodArn: "arn:aws:execute-api:us-east-2:908671954593:abc123/dev/POST/payment", scopes: []string{"payment.read"},
+			want: []string{	"arn:aws:execute-api:us-east-2:908671954593:abc123/dev/GET/payment",
+							"arn:aws:execute-api:us-east-2:908671954593:abc123/dev/GET/payment/*"} },
+		{ name: "malformed arn", methodArn: "arn:aws:execute-api:us-east-2", scopes: []string{"payment.read"}, want: nil },
+		{ name: "arn without stage", methodArn: "arn:aws:execute-api:us-east-2:908671954593:abc123", scopes: []string{"payment.read"}, want: nil },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := scopeResources(c.methodArn, c.scopes, c.scopeRoutes)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("scopeResources = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizerToken(t *testing.T) {
+	keyring := jwt.NewKeyring()
+	if err := keyring.Add(&jwt.Key{ Kid: "hs", Alg: "HS256", State: jwt.KeyStateActive, Secret: []byte("secret") }); err != nil {
+		t.Fatal(err)
+	}
+	useCaseJwt := jwt.NewUseCaseJwt(keyring)
+	useCaseJwt.SetAudiences("lambda-go-autentication", nil)
+	appServer := &model.AppServer{ InfoApp: &model.InfoApp{ IssuerURL: "https://auth.domain.com" } }
+	adapterJwt := NewAdapterJwt(appServer, useCaseJwt)
+
+	token := func(scopes ...string) string {
+		auth, err := useCaseJwt.OAUTHToken(context.Background(), model.Credential{ User: "user-01", Issuer: "https://auth.domain.com" },
+																model.CredentialScope{ Scope: scopes })
+		if err != nil {
+			t.Fatal(err)
+		}
+		return auth.Token
+	}
+
+	cases := []struct {
+		name			string
+		authorization	string
+		wantErr			error
+		wantEffect		string
+		wantResources	int
+	}{
+		{ name: "allowed scope", authorization: "Bearer " + token("payment.read"), wantEffect: "Allow", wantResources: 2 },
+		{ name: "policy of the scope resource, not of the method arn", authorization: "Bearer " + token("report.write"), wantEffect: "Allow", wantResources: 8 },
+		{ name: "token without scopes is denied", authorization: "Bearer " + token(), wantEffect: "Deny", wantResources: 1 },
+		{ name: "missing token", authorization: "", wantErr: ErrAuthorizerUnauthorized },
+		{ name: "invalid token", authorization: "Bearer abc.def.ghi", wantErr: ErrAuthorizerUnauthorized },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			response, err := adapterJwt.AuthorizerToken(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+				Type: "TOKEN",
+				AuthorizationToken: c.authorization,
+				MethodArn: testMethodArn,
+			})
+			if c.wantErr != nil {
+				// APIGW answers 401 only for the exact message
+				if err != c.wantErr || err.Error() != "Unauthorized" {
+					t.Fatalf("AuthorizerToken error = %v, want %v", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			statement := response.PolicyDocument.Statement[0]
+			if statement.Effect != c.wantEffect || len(statement.Resource) != c.wantResources {
+				t.Errorf("policy = %s %v, want %s with %d resources", statement.Effect, statement.Resource, c.wantEffect, c.wantResources)
+			}
+			if c.wantEffect == "Deny" && statement.Resource[0] != testMethodArn {
+				t.Errorf("denied resource = %s, want the method arn", statement.Resource[0])
+			}
+			if response.PrincipalID != "user-01" || response.Context["username"] != "user-01" {
+				t.Errorf("principal = %s, context = %v", response.PrincipalID, response.Context)
+			}
+		})
+	}
+}
+
+func TestAuthorizerRequestHeader(t *testing.T) {
+	adapterJwt := newTestAdapterJwt(t)
+
+	// without the header the REQUEST authorizer answers 401, whatever the case of the name
+	for _, headers := range []map[string]string{ {}, { "authorization": "" }, { "Authorization": "Bearer " } } {
+		_, err := adapterJwt.AuthorizerRequest(context.Background(), events.APIGatewayCustomAuthorizerRequestTypeRequest{
+			Type: "REQUEST",
+			Headers: headers,
+			MethodArn: testMethodArn,
+		})
+		if err != ErrAuthorizerUnauthorized {
+			t.Errorf("AuthorizerRequest %v error = %v, want %v", headers, err, ErrAuthorizerUnauthorized)
+		}
+	}
+}
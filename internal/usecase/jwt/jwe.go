@@ -0,0 +1,172 @@
+package jwt
+
+import (
+	"fmt"
+	"errors"
+	"strings"
+	"crypto/aes"
+	"crypto/rsa"
+	"crypto/rand"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/base64"
+)
+
+// the nested tokens are signed then encrypted (RFC 7516 compact serialization, RFC 7519 section 5.2)
+const (
+	JweAlg		= "RSA-OAEP-256"
+	JweEnc		= "A256GCM"
+	jweKidPrefix = "enc-"
+)
+
+var ErrJweInvalid = errors.New("invalid encrypted token")
+
+type jweHeader struct {
+	Alg		string	`json:"alg"`
+	Enc		string	`json:"enc"`
+	Cty		string	`json:"cty,omitempty"`
+	Kid		string	`json:"kid,omitempty"`
+}
+
+// EncryptionKey turns a RSA key pair into the decryption key of the service (published in the JWKS with use enc)
+func EncryptionKey(key *Key) (*Key, error) {
+	if _, ok := key.Public.(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("encryption key %s: RSA key expected for %s", key.Kid, JweAlg)
+	}
+
+	encryption_key := *key
+	encryption_key.Kid = jweKidPrefix + key.Kid
+	encryption_key.Alg = JweAlg
+	return &encryption_key, nil
+}
+
+// CheckRecipientKey parses the recipient public key registered by a client (PKIX pem, RSA 2048 bits or more)
+func CheckRecipientKey(public_pem string) (*rsa.PublicKey, error) {
+	recipient, err := ParsePemToRSAPub(&public_pem)
+	if err != nil {
+		return nil, err
+	}
+	if recipient.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA key of %d bits, 2048 bits or more expected", recipient.N.BitLen())
+	}
+	return recipient, nil
+}
+
+// IsEncrypted reports if the token is a JWE (5 segments) instead of a JWS (3 segments)
+func IsEncrypted(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// EncryptToken encrypts the signed token for the recipient public key (RSA-OAEP-256 / A256GCM, cty JWT)
+func EncryptToken(token string, recipient *rsa.PublicKey) (string, error) {
+	kid, err := Thumbprint(recipient)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(jweHeader{ Alg: JweAlg, Enc: JweEnc, Cty: "JWT", Kid: kid })
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(header)
+
+	// content encryption key, wrapped with the recipient key
+	cek := make([]byte, 32)
+	if _, err := rand.Read(cek); err != nil {
+		return "", err
+	}
+	encrypted_key, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, recipient, cek, nil)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	// the additional authenticated data is the protected header (RFC 7516 section 5.1 step 14)
+	sealed := gcm.Seal(nil, iv, []byte(token), []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encrypted_key),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// DecryptToken returns the nested signed token, for the holders of the recipient private key. The signature is not checked here
+func DecryptToken(token string, private_key *rsa.PrivateKey) (string, error) {
+	header, parts, err := splitJwe(token)
+	if err != nil {
+		return "", err
+	}
+	if header.Alg != JweAlg || header.Enc != JweEnc {
+		return "", fmt.Errorf("%w: alg %s enc %s not supported", ErrJweInvalid, header.Alg, header.Enc)
+	}
+
+	cek, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, private_key, parts[1], nil)
+	if err != nil || len(cek) != 32 {
+		return "", ErrJweInvalid
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	if len(parts[2]) != gcm.NonceSize() || len(parts[4]) != gcm.Overhead() {
+		return "", ErrJweInvalid
+	}
+	plaintext, err := gcm.Open(nil, parts[2], append(parts[3], parts[4]...), []byte(strings.SplitN(token, ".", 2)[0]))
+	if err != nil {
+		return "", ErrJweInvalid
+	}
+
+	return string(plaintext), nil
+}
+
+// jweKid returns the kid of the protected header (the recipient key thumbprint)
+func jweKid(token string) (string, error) {
+	header, _, err := splitJwe(token)
+	if err != nil {
+		return "", err
+	}
+	return header.Kid, nil
+}
+
+func splitJwe(token string) (*jweHeader, [][]byte, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 5 {
+		return nil, nil, ErrJweInvalid
+	}
+
+	parts := make([][]byte, len(segments))
+	for i, segment := range segments {
+		part, err := base64.RawURLEncoding.DecodeString(segment)
+		if err != nil {
+			return nil, nil, ErrJweInvalid
+		}
+		parts[i] = part
+	}
+
+	var header jweHeader
+	if err := json.Unmarshal(parts[0], &header); err != nil {
+		return nil, nil, ErrJweInvalid
+	}
+	return &header, parts, nil
+}
+
+func newGCM(cek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,125 @@
+package jwt
+
+import (
+	"time"
+	"errors"
+	"context"
+	"strings"
+	"testing"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestEncryptDecryptToken(t *testing.T) {
+	recipient, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := signTestToken(t, jwt.SigningMethodHS256, testSecretKey("active", KeyStateActive), testClaims(time.Hour))
+	encrypted, err := EncryptToken(signed, &recipient.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(encrypted) || IsEncrypted(signed) {
+		t.Fatalf("IsEncrypted encrypted = %v, signed = %v", IsEncrypted(encrypted), IsEncrypted(signed))
+	}
+
+	// tamper replaces the segment i of the token
+	tamper := func(i int, segment string) string {
+		segments := strings.Split(encrypted, ".")
+		segments[i] = segment
+		return strings.Join(segments, ".")
+	}
+	flip := func(i int) string {
+		part, _ := base64.RawURLEncoding.DecodeString(strings.Split(encrypted, ".")[i])
+		part[0] ^= 0x01
+		return tamper(i, base64.RawURLEncoding.EncodeToString(part))
+	}
+	otherHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RSA-OAEP","enc":"A256GCM"}`))
+
+	cases := []struct {
+		name		string
+		token		string
+		private_key	*rsa.PrivateKey
+		wantErr		bool
+	}{
+		{ name: "round trip", token: encrypted, private_key: recipient },
+		{ name: "other recipient key", token: encrypted, private_key: other, wantErr: true },
+		{ name: "ciphertext changed", token: flip(3), private_key: recipient, wantErr: true },
+		{ name: "tag changed", token: flip(4), private_key: recipient, wantErr: true },
+		{ name: "protected header changed", token: tamper(0, otherHeader), private_key: recipient, wantErr: true },
+		{ name: "signed token", token: signed, private_key: recipient, wantErr: true },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			decrypted, err := DecryptToken(c.token, c.private_key)
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("DecryptToken must fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decrypted != signed {
+				t.Errorf("decrypted token = %s, want %s", decrypted, signed)
+			}
+		})
+	}
+}
+
+func TestTokenValidationEncrypted(t *testing.T) {
+	rsa_key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, err := Thumbprint(&rsa_key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptionKey, err := EncryptionKey(&Key{ Kid: kid, Alg: "RS256", State: KeyStateActive, Private: rsa_key, Public: &rsa_key.PublicKey })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	active := testSecretKey("active", KeyStateActive)
+	keyring := NewKeyring()
+	for _, key := range []*Key{ active, encryptionKey } {
+		if err := keyring.Add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	useCaseJwt := NewUseCaseJwt(keyring)
+
+	signed := signTestToken(t, jwt.SigningMethodHS256, active, testClaims(time.Hour))
+	encrypted, err := EncryptToken(signed, &rsa_key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedOther, err := EncryptToken(signed, &other.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the service decrypts the tokens encrypted for its key, the nested signature is then verified
+	if valid, err := useCaseJwt.TokenValidation(context.Background(), encrypted, ""); err != nil || !valid {
+		t.Errorf("TokenValidation encrypted = %v, %v", valid, err)
+	}
+	if _, err := useCaseJwt.TokenValidation(context.Background(), encryptedOther, ""); err == nil || errors.Is(err, ErrJweInvalid) {
+		t.Errorf("TokenValidation for an other recipient error = %v, want unauthorized", err)
+	}
+}
@@ -1,12 +1,10 @@
 package jwt
 
 import (
-	"fmt"
 	"time"
+	"errors"
 	"context"
-	"crypto/x509"
 	"crypto/rsa"
-    "encoding/pem"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 
@@ -15,75 +13,191 @@ import (
 	"github.com/lambda-go-autentication/pkg/observability"
 	"github.com/lambda-go-autentication/internal/erro"
 	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/usecase/audit"
+	"github.com/lambda-go-autentication/internal/usecase/credential/repository"
 )
 
 var childLogger = log.With().Str("usecase", "jwt").Logger()
 
 type UseCaseJwt struct{
-	JwtKey		*string
-	key_rsa_priv *rsa.PrivateKey
-	key_rsa_pub *rsa.PublicKey
+	keyring				*Keyring
+	audit				*audit.UseCaseAudit
+	serviceAudience		string
+	allowedAudiences	[]string
+	revocation			repository.RevocationStore
 }
 
-func NewUseCaseJwt(	jwtKey *string,
-					key_rsa_priv *string,
-					key_rsa_pub *string) *UseCaseJwt{
+func NewUseCaseJwt(keyring *Keyring) *UseCaseJwt{
 	childLogger.Debug().Msg("NewUseCaseJwt")
 
-	_key_rsa_priv, err := ParsePemToRSAPriv(key_rsa_priv)
-	if err != nil{
-		childLogger.Error().Err(err).Msg("erro ParsePemToRSA !!!!")
+	return &UseCaseJwt{
+		keyring: keyring,
 	}
-	_key_rsa_pub, err := ParsePemToRSAPub(key_rsa_pub)
-	if err != nil{
-		childLogger.Error().Err(err).Msg("erro ParsePemToRSA !!!!")
+}
+
+// SetAudit records the token refreshes in the audit log, without it they are not audited
+func (u *UseCaseJwt) SetAudit(useCaseAudit *audit.UseCaseAudit) {
+	u.audit = useCaseAudit
+}
+
+// SetRevocation refuses the revoked tokens (jwt_id) on the validation, the refresh and ParseAccessToken,
+// without it the revocation is not checked
+func (u *UseCaseJwt) SetRevocation(revocation repository.RevocationStore) {
+	u.revocation = revocation
+}
+
+// SetAudiences sets the audience of the tokens issued without a requested audience (the service itself) and the
+// other audiences accepted by ParseAccessToken (ex: the resource servers protected by the authorizer)
+func (u *UseCaseJwt) SetAudiences(serviceAudience string, allowedAudiences []string) {
+	u.serviceAudience = serviceAudience
+	u.allowedAudiences = allowedAudiences
+}
+
+// tokenAudience is the requested audience or, without one, the service audience
+func (u *UseCaseJwt) tokenAudience(credential model.Credential) jwt.ClaimStrings {
+	if credential.Audience != "" {
+		return jwt.ClaimStrings{credential.Audience}
+	}
+	if u.serviceAudience != "" {
+		return jwt.ClaimStrings{u.serviceAudience}
 	}
+	return nil
+}
 
-	return &UseCaseJwt{
-		JwtKey: jwtKey,
-		key_rsa_priv: _key_rsa_priv,
-		key_rsa_pub: _key_rsa_pub,
+// auditRefresh records the refresh of a token with a valid signature, the owner of the token is the actor
+func (u *UseCaseJwt) auditRefresh(ctx context.Context, claims *model.JwtData, alg string, err error) {
+	u.audit.Record(ctx, model.AuditEvent{	EventType: audit.EventTokenRefresh,
+											Actor: claims.Username,
+											Subject: claims.Username,
+											Detail: map[string]string{"alg": alg, "jwt_id": claims.JwtId} }, err)
+}
+
+func (u *UseCaseJwt) JWKS(ctx context.Context) (*model.Jwks, error){
+	childLogger.Debug().Msg("JWKS")
+
+	ctx, span := observability.Span(ctx, "usecase.JWKS")
+	defer span.End()
+
+	// the pending keys are published ahead of the activation, so caches already know them
+	jwks := model.Jwks{ Keys: []model.Jwk{} }
+	for _, key := range u.keyring.Keys() {
+		if !key.published() {
+			continue
+		}
+		jwk, err := PublicToJwk(key.Public, key.Kid, key.Alg)
+		if err != nil {
+			return nil, err
+		}
+		if key.Alg == JweAlg {
+			jwk.Use = "enc"
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
 	}
+
+	return &jwks, nil
 }
 
-func ParsePemToRSAPriv(private_key *string) (*rsa.PrivateKey, error){
-	childLogger.Debug().Msg("ParsePemToRSA")
+// CheckAudience rejects a token issued for another resource server. A token 
+// without audience is only accepted when no audience is requested
+func CheckAudience(claims *model.JwtData, audience string) error {
+	if audience == "" {
+		if len(claims.Audience) == 0 {
+			return nil
+		}
+		return erro.ErrAudienceMismatch
+	}
 
-	block, _ := pem.Decode([]byte(*private_key))
-	if block == nil || block.Type != "PRIVATE KEY" {
-		childLogger.Error().Err(erro.ErrDecodeKey).Msg("erro Decode")
-		return nil, erro.ErrDecodeKey
+	if !claims.VerifyAudience(audience, true) {
+		return erro.ErrAudienceMismatch
 	}
+	return nil
+}
 
-	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+// signToken signs with the active key of the algorithm and sets its kid in the header
+func (u *UseCaseJwt) signToken(ctx context.Context, method jwt.SigningMethod, claims jwt.Claims) (string, error){
+	key, err := u.keyring.Signing(method.Alg())
 	if err != nil {
-		childLogger.Error().Err(err).Msg("erro ParsePKCS8PrivateKey")
-		return nil, err
+		return "", err
 	}
 
-	key_rsa := privateKey.(*rsa.PrivateKey)
+	// a KMS key signs remotely (within the request ctx), the token is the same
+	if externalSigner(key.Private) {
+		method = signerMethod{ SigningMethod: method, ctx: ctx }
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.Kid
 
-	return key_rsa, nil
+	return token.SignedString(key.signingKey())
 }
 
-func ParsePemToRSAPub(public_key *string) (*rsa.PublicKey, error){
-	childLogger.Debug().Msg("ParsePemToRSA")
+// decryptToken returns the nested token of a JWE encrypted for one of the encryption keys of the service, a signed token is returned as is
+func (u *UseCaseJwt) decryptToken(bearerToken string) (string, error){
+	if !IsEncrypted(bearerToken) {
+		return bearerToken, nil
+	}
 
-	block, _ := pem.Decode([]byte(*public_key))
-	if block == nil || block.Type != "PUBLIC KEY" {
-		childLogger.Error().Err(erro.ErrDecodeKey).Msg("erro Decode")
-		return nil, erro.ErrDecodeKey
+	kid, err := jweKid(bearerToken)
+	if err != nil {
+		return "", erro.ErrStatusUnauthorized.Wrap(err)
+	}
+	key, err := u.keyring.Verification(jweKidPrefix + kid, JweAlg)
+	if err != nil {
+		return "", err
+	}
+	private_key, ok := key.Private.(*rsa.PrivateKey)
+	if !ok {
+		return "", erro.ErrStatusUnauthorized
 	}
 
-	pubInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
+	token, err := DecryptToken(bearerToken, private_key)
 	if err != nil {
-		childLogger.Error().Err(err).Msg("erro ParsePKCS8PrivateKey")
-		return nil, err
+		return "", erro.ErrStatusUnauthorized.Wrap(err)
+	}
+	return token, nil
+}
+
+// parseToken verifies the token with the key selected by the kid, only the informed methods are accepted, a revoked jwt_id is refused
+func (u *UseCaseJwt) parseToken(ctx context.Context, bearerToken string, methods ...jwt.SigningMethod) (*model.JwtData, jwt.SigningMethod, error){
+	validMethods := make([]string, 0, len(methods))
+	for _, method := range methods {
+		validMethods = append(validMethods, method.Alg())
+	}
+
+	claims := &model.JwtData{}
+	tkn, err := jwt.ParseWithClaims(bearerToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := u.keyring.Verification(kid, token.Method.Alg())
+		if err != nil {
+			return nil, err
+		}
+		return key.verificationKey(), nil
+	}, jwt.WithValidMethods(validMethods))
+
+	if err != nil {
+		// only an expired token is reported as expired, any other failure (signature, alg, kid, format) is an invalid token
+		var validationError *jwt.ValidationError
+		if errors.As(err, &validationError) && validationError.Errors == jwt.ValidationErrorExpired {
+			return nil, nil, erro.ErrTokenExpired.Wrap(err)
+		}
+		return nil, nil, erro.ErrStatusUnauthorized.Wrap(err)
 	}
 
-	key_rsa := pubInterface.(*rsa.PublicKey)
+	if !tkn.Valid {
+		return nil, nil, erro.ErrStatusUnauthorized
+	}
 
-	return key_rsa, nil
+	if u.revocation != nil && claims.JwtId != "" {
+		revoked, err := u.revocation.IsTokenRevoked(ctx, claims.JwtId)
+		if err != nil {
+			return nil, nil, err
+		}
+		if revoked {
+			return nil, nil, erro.ErrTokenRevoked
+		}
+	}
+
+	return claims, tkn.Method, nil
 }
 
 func (u *UseCaseJwt) OAUTHToken(ctx context.Context, 
@@ -91,13 +205,16 @@ func (u *UseCaseJwt) OAUTHToken(ctx context.Context,
 								credential_scope model.CredentialScope) (*model.Authentication, error){
 	childLogger.Debug().Msg("OAUTHToken")
 
-	childLogger.Debug().Interface("credential :",credential).Msg("")
 	childLogger.Debug().Interface("credential_scope :",credential_scope).Msg("")
-	childLogger.Debug().Interface("u.JwtKey :", u.JwtKey).Msg("")
 
-	span := observability.Span(ctx, "usecase.OAUTHToken")
+	ctx, span := observability.Span(ctx, "usecase.OAUTHToken")
 	defer span.End()
 
+	// the HMAC secret is the one of the service, no client could verify an id token signed with it
+	if requestsOpenID(credential.Scope) {
+		return nil, erro.ErrOpenIDAsymmetric
+	}
+
 	// Set a JWT expiration date 
 	expirationTime := time.Now().Add(720 * time.Minute)
 
@@ -107,7 +224,7 @@ func (u *UseCaseJwt) OAUTHToken(ctx context.Context,
 	// Create a JWT Oauth 2.0 with all scopes and expiration date
 	jwtData := &model.JwtData{
 								Username: credential.User,
-								Scope: credential_scope.Scope,
+								Scope: accessScopes(credential_scope.Scope, credential.Scope),
 								ISS: "lambda-go-autentication",
 								Version: "2",
 								JwtId: uuidString,
@@ -116,69 +233,68 @@ func (u *UseCaseJwt) OAUTHToken(ctx context.Context,
 									ExpiresAt: jwt.NewNumericDate(expirationTime), 	// JWT expiry time is unix milliseconds
 								},
 	}
+	jwtData.Audience = u.tokenAudience(credential)
 
 	// Add the claims and sign the token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtData)
-	tokenString, err := token.SignedString([]byte(*u.JwtKey))
+	method := jwt.SigningMethodHS256
+	tokenString, err := u.signToken(ctx, method, jwtData)
 	if err != nil {
 		return nil, err
 	}
 	
 	auth := model.Authentication{Token: tokenString, 
 								ExpirationTime :expirationTime}	
+	observability.RecordTokenIssued(ctx, method.Alg(), observability.GrantPassword, jwtData.TokenUse)
 
 	return &auth ,nil
 }
 
-func (u *UseCaseJwt) TokenValidation(ctx context.Context, bearerToken string) (bool, error){
+func (u *UseCaseJwt) TokenValidation(ctx context.Context, bearerToken string, audience string) (valid bool, err error){
 	childLogger.Debug().Msg("TokenValidation")
 
-	span := observability.Span(ctx, "useCase.TokenValidation")	
+	ctx, span := observability.Span(ctx, "useCase.TokenValidation")	
     defer span.End()
 
+	defer func() { observability.RecordValidation(ctx, jwt.SigningMethodHS256.Alg(), err) }()
+
 	log.Debug().Interface("bearerToken : ", bearerToken).Msg("")
 
-	claims := &model.JwtData{}
-	tkn, err := jwt.ParseWithClaims(bearerToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(*u.JwtKey), nil
-	})
+	// an encrypted (nested) token is decrypted with the encryption key of the service
+	bearerToken, err = u.decryptToken(bearerToken)
+	if err != nil {
+		return false, err
+	}
 
+	claims, _, err := u.parseToken(ctx, bearerToken, jwt.SigningMethodHS256)
 	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			return false, erro.ErrStatusUnauthorized
-		}
-		return false, erro.ErrTokenExpired
+		return false, err
 	}
 
-	if !tkn.Valid {
-		return false, erro.ErrStatusUnauthorized
+	// without audience the token must be the one issued for the service
+	if audience == "" {
+		audience = u.serviceAudience
+	}
+	if err = CheckAudience(claims, audience); err != nil {
+		return false, err
 	}
 
 	return true, nil
 }
 
-func (u *UseCaseJwt) RefreshToken(ctx context.Context, bearerToken string) (*model.Authentication, error){
+func (u *UseCaseJwt) RefreshToken(ctx context.Context, bearerToken string) (_ *model.Authentication, err error){
 	childLogger.Debug().Msg("RefreshToken")
 
-	span := observability.Span(ctx, "useCase.RefreshToken")	
+	ctx, span := observability.Span(ctx, "useCase.RefreshToken")	
     defer span.End()
 
-	// Check with token is signed 
-	claims := &model.JwtData{}
-	tkn, err := jwt.ParseWithClaims(bearerToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(*u.JwtKey), nil
-	})
+	defer func() { observability.RecordRefresh(ctx, jwt.SigningMethodHS256.Alg(), err) }()
 
+	// Check with token is signed 
+	claims, _, err := u.parseToken(ctx, bearerToken, jwt.SigningMethodHS256)
 	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			return nil, erro.ErrStatusUnauthorized
-		}
-		return nil, erro.ErrTokenExpired
-	}
-
-	if !tkn.Valid {
-		return nil, erro.ErrStatusUnauthorized
+		return nil, err
 	}
+	defer func() { u.auditRefresh(ctx, claims, jwt.SigningMethodHS256.Alg(), err) }()
 
 	// Check if the token is still valid
 	if time.Until(claims.ExpiresAt.Time) > (719 * time.Minute) {
@@ -190,12 +306,11 @@ func (u *UseCaseJwt) RefreshToken(ctx context.Context, bearerToken string) (*mod
 	claims.ExpiresAt = jwt.NewNumericDate(expirationTime)
 	claims.ISS = "lambda-go-autentication-refreshed"
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	tokenString, err := token.SignedString([]byte(*u.JwtKey))
+	tokenString, err := u.signToken(ctx, jwt.SigningMethodHS256, claims)
 	if err != nil {
 		return nil, err
 	}
+	observability.RecordTokenIssued(ctx, jwt.SigningMethodHS256.Alg(), observability.GrantRefreshToken, claims.TokenUse)
 
 	auth := model.Authentication{	Token: tokenString, 
 									ExpirationTime :expirationTime}
@@ -208,12 +323,9 @@ func (u *UseCaseJwt) OAUTHTokenRSA(	ctx context.Context,
 									credential_scope model.CredentialScope) (*model.Authentication, error){
 	childLogger.Debug().Msg("OAUTHTokenRSA")
 
-	childLogger.Debug().Interface("credential :",credential).Msg("")
 	childLogger.Debug().Interface("credential_scope :",credential_scope).Msg("")
-	childLogger.Debug().Interface("u.key_rsa_priv :", u.key_rsa_priv).Msg("")
-	childLogger.Debug().Interface("u.key_rsa_pub :", u.key_rsa_pub).Msg("")
 
-	span := observability.Span(ctx, "usecase.OAUTHTokenRSA")
+	ctx, span := observability.Span(ctx, "usecase.OAUTHTokenRSA")
 	defer span.End()
 
 	// Set a JWT expiration date 
@@ -225,7 +337,7 @@ func (u *UseCaseJwt) OAUTHTokenRSA(	ctx context.Context,
 	// Create a JWT Oauth 2.0 with all scopes and expiration date
 	jwtData := &model.JwtData{
 								Username: credential.User,
-								Scope: credential_scope.Scope,
+								Scope: accessScopes(credential_scope.Scope, credential.Scope),
 								ISS: "lambda-go-autentication",
 								Version: "2",
 								JwtId: uuidString,
@@ -234,74 +346,84 @@ func (u *UseCaseJwt) OAUTHTokenRSA(	ctx context.Context,
 									ExpiresAt: jwt.NewNumericDate(expirationTime), 	// JWT expiry time is unix milliseconds
 								},
 	}
+	jwtData.Audience = u.tokenAudience(credential)
 
-	// Add the claims and sign the token
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwtData)
-	tokenString, err := token.SignedString(u.key_rsa_priv)
+	// Add the claims and sign the token with the algorithm chosen by the client
+	method, err := AsymmetricMethod(credential.SigningAlg)
+	if err != nil {
+		return nil, err
+	}
+	tokenString, err := u.signToken(ctx, method, jwtData)
 	if err != nil {
 		return nil, err
 	}
 	
 	auth := model.Authentication{Token: tokenString, 
 								ExpirationTime :expirationTime}	
+	observability.RecordTokenIssued(ctx, method.Alg(), observability.GrantPassword, jwtData.TokenUse)
+
+	// OpenID Connect, the id token is issued alongside the access token
+	if requestsOpenID(credential.Scope) {
+		auth.IDToken, err = u.idToken(ctx, method, credential, tokenString, expirationTime)
+		if err != nil {
+			return nil, err
+		}
+		observability.RecordTokenIssued(ctx, method.Alg(), observability.GrantPassword, "id")
+	}
 
 	return &auth ,nil
 }
 
-func (u *UseCaseJwt) TokenValidationRSA(ctx context.Context, bearerToken string) (bool, error){
+func (u *UseCaseJwt) TokenValidationRSA(ctx context.Context, bearerToken string, audience string) (valid bool, err error){
 	childLogger.Debug().Msg("TokenValidationRSA")
 
-	span := observability.Span(ctx, "useCase.TokenValidationRSA")	
+	ctx, span := observability.Span(ctx, "useCase.TokenValidationRSA")	
     defer span.End()
 
-	log.Debug().Interface("bearerToken : ", bearerToken).Msg("")
+	alg := "unknown"
+	defer func() { observability.RecordValidation(ctx, alg, err) }()
 
-	claims := &model.JwtData{}
+	log.Debug().Interface("bearerToken : ", bearerToken).Msg("")
 
-	tkn, err := jwt.ParseWithClaims(bearerToken, claims, func(token *jwt.Token) (interface{}, error) {
-	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("error unexpected signing method: %v", token.Header["alg"])
-		}
-		return u.key_rsa_pub, nil
-	})
+	// an encrypted (nested) token is decrypted with the encryption key of the service
+	bearerToken, err = u.decryptToken(bearerToken)
+	if err != nil {
+		return false, err
+	}
 
+	claims, method, err := u.parseToken(ctx, bearerToken, asymmetricMethods...)
 	if err != nil {
-		fmt.Println(err)
-		if err == jwt.ErrSignatureInvalid {
-			return false, erro.ErrStatusUnauthorized
-		}
-		return false, erro.ErrTokenExpired
+		return false, err
 	}
+	alg = method.Alg()
 
-	if !tkn.Valid {
-		return false, erro.ErrStatusUnauthorized
+	// without audience the token must be the one issued for the service
+	if audience == "" {
+		audience = u.serviceAudience
+	}
+	if err = CheckAudience(claims, audience); err != nil {
+		return false, err
 	}
 
 	return true ,nil
 }
 
-func (u *UseCaseJwt) RefreshTokenRSA(ctx context.Context, bearerToken string) (*model.Authentication, error){
+func (u *UseCaseJwt) RefreshTokenRSA(ctx context.Context, bearerToken string) (_ *model.Authentication, err error){
 	childLogger.Debug().Msg("RefreshTokenRSA")
 
-	span := observability.Span(ctx, "useCase.RefreshTokenRSA")	
+	ctx, span := observability.Span(ctx, "useCase.RefreshTokenRSA")	
     defer span.End()
 
-	// Check with token is signed 
-	claims := &model.JwtData{}
-	tkn, err := jwt.ParseWithClaims(bearerToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return u.key_rsa_pub, nil
-	})
+	alg := "unknown"
+	defer func() { observability.RecordRefresh(ctx, alg, err) }()
 
+	// Check with token is signed 
+	claims, method, err := u.parseToken(ctx, bearerToken, asymmetricMethods...)
 	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			return nil, erro.ErrStatusUnauthorized
-		}
-		return nil, erro.ErrTokenExpired
-	}
-
-	if !tkn.Valid {
-		return nil, erro.ErrStatusUnauthorized
+		return nil, err
 	}
+	alg = method.Alg()
+	defer func() { u.auditRefresh(ctx, claims, alg, err) }()
 
 	// Check if the token is still valid
 	if time.Until(claims.ExpiresAt.Time) > (719 * time.Minute) {
@@ -313,12 +435,11 @@ func (u *UseCaseJwt) RefreshTokenRSA(ctx context.Context, bearerToken string) (*
 	claims.ExpiresAt = jwt.NewNumericDate(expirationTime)
 	claims.ISS = "lambda-go-autentication-refreshed"
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	
-	tokenString, err := token.SignedString(u.key_rsa_priv)
+	tokenString, err := u.signToken(ctx, method, claims)
 	if err != nil {
 		return nil, err
 	}
+	observability.RecordTokenIssued(ctx, method.Alg(), observability.GrantRefreshToken, claims.TokenUse)
 
 	auth := model.Authentication{	Token: tokenString, 
 									ExpirationTime :expirationTime}
@@ -0,0 +1,144 @@
+package jwt
+
+import (
+	"time"
+	"errors"
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/usecase/credential/repository"
+)
+
+func testClaims(expiresIn time.Duration) *model.JwtData {
+	return &model.JwtData{	Username: "user-01",
+							JwtId: "jti-01",
+							TokenUse: "access",
+							RegisteredClaims: jwt.RegisteredClaims{
+								ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+							} }
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, key *Key, claims jwt.Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if key.Kid != "" {
+		token.Header["kid"] = key.Kid
+	}
+	tokenString, err := token.SignedString(key.signingKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenString
+}
+
+func TestParseToken(t *testing.T) {
+	active := testSecretKey("active", KeyStateActive)
+	retired := testSecretKey("retired", KeyStateRetired)
+	unknown := testSecretKey("unknown", KeyStateActive)
+	rsaKey := testRSAKey(t, "rsa", KeyStateActive)
+
+	keyring := NewKeyring()
+	for _, key := range []*Key{ active, retired, rsaKey } {
+		if err := keyring.Add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	useCaseJwt := NewUseCaseJwt(keyring)
+
+	cases := []struct {
+		name	string
+		token	string
+		methods	[]jwt.SigningMethod
+		wantErr	error
+	}{
+		{	name: "valid token",
+			token: signTestToken(t, jwt.SigningMethodHS256, active, testClaims(time.Hour)),
+			methods: []jwt.SigningMethod{ jwt.SigningMethodHS256 } },
+		{	name: "valid asymetric token",
+			token: signTestToken(t, jwt.SigningMethodRS256, rsaKey, testClaims(time.Hour)),
+			methods: asymmetricMethods },
+		{	name: "unknown kid",
+			token: signTestToken(t, jwt.SigningMethodHS256, unknown, testClaims(time.Hour)),
+			methods: []jwt.SigningMethod{ jwt.SigningMethodHS256 },
+			wantErr: erro.ErrStatusUnauthorized },
+		{	name: "retired kid",
+			token: signTestToken(t, jwt.SigningMethodHS256, retired, testClaims(time.Hour)),
+			methods: []jwt.SigningMethod{ jwt.SigningMethodHS256 },
+			wantErr: erro.ErrStatusUnauthorized },
+		{	name: "wrong alg",
+			token: signTestToken(t, jwt.SigningMethodRS256, rsaKey, testClaims(time.Hour)),
+			methods: []jwt.SigningMethod{ jwt.SigningMethodHS256 },
+			wantErr: erro.ErrStatusUnauthorized },
+		{	name: "expired token",
+			token: signTestToken(t, jwt.SigningMethodHS256, active, testClaims(-time.Minute)),
+			methods: []jwt.SigningMethod{ jwt.SigningMethodHS256 },
+			wantErr: erro.ErrTokenExpired },
+		{	name: "malformed token",
+			token: "not.a.token",
+			methods: []jwt.SigningMethod{ jwt.SigningMethodHS256 },
+			wantErr: erro.ErrStatusUnauthorized },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			claims, _, err := useCaseJwt.parseToken(context.Background(), c.token, c.methods...)
+			if c.wantErr != nil {
+				if !errors.Is(err, c.wantErr) {
+					t.Fatalf("parseToken error = %v, want %v", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Username != "user-01" {
+				t.Errorf("username = %s, want user-01", claims.Username)
+			}
+		})
+	}
+}
+
+func TestRevokedToken(t *testing.T) {
+	ctx := context.Background()
+	active := testSecretKey("active", KeyStateActive)
+	keyring := NewKeyring()
+	if err := keyring.Add(active); err != nil {
+		t.Fatal(err)
+	}
+	revocation := repository.NewRepoMemory()
+	if err := revocation.RevokeToken(ctx, "jti-01", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	useCaseJwt := NewUseCaseJwt(keyring)
+	useCaseJwt.SetRevocation(revocation)
+
+	revoked := signTestToken(t, jwt.SigningMethodHS256, active, testClaims(time.Hour))
+	other := testClaims(time.Hour)
+	other.JwtId = "jti-02"
+	valid := signTestToken(t, jwt.SigningMethodHS256, active, other)
+
+	cases := []struct {
+		name	string
+		call	func(token string) error
+	}{
+		{ name: "TokenValidation", call: func(token string) error { _, err := useCaseJwt.TokenValidation(ctx, token, ""); return err } },
+		{ name: "RefreshToken", call: func(token string) error { _, err := useCaseJwt.RefreshToken(ctx, token); return err } },
+		{ name: "ParseAccessToken", call: func(token string) error { _, err := useCaseJwt.ParseAccessToken(ctx, token); return err } },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.call(revoked); !errors.Is(err, erro.ErrTokenRevoked) {
+				t.Errorf("revoked token error = %v, want %v", err, erro.ErrTokenRevoked)
+			}
+			if err := c.call(valid); errors.Is(err, erro.ErrTokenRevoked) {
+				t.Errorf("not revoked token error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+	"context"
+)
+
+// keyReloader keeps the keys of a source (S3KeySource, SecretKeySource) in the keyring: Load, the reload each ttl
+// and the reload when a token carries an unknown kid of the algorithms of the source.
+// The kid comes from an untrusted token, so the reloads it causes are throttled by the last attempt (failed or not)
+// and collapsed into one: during an outage of the source the forged kids do not start a load each
+type keyReloader struct {
+	keyring		*Keyring
+	source		string	// names the keys of the source in the keyring
+	fetch		func(ctx context.Context) ([]*Key, error)
+	accepts		func(alg string) bool	// the algorithms of the source
+	ttl			time.Duration
+	interval	time.Duration	// minimum interval between two reloads caused by unknown kids
+	mu			sync.Mutex	// one load at a time
+	attemptMu	sync.Mutex
+	attemptedAt	time.Time
+	reloading	bool
+	loaded		string	// kid:state of the loaded keys, the reloads without change are not logged
+}
+
+func newKeyReloader(keyring *Keyring,
+					source string,
+					ttl time.Duration,
+					interval time.Duration,
+					accepts func(alg string) bool,
+					fetch func(ctx context.Context) ([]*Key, error)) *keyReloader {
+	return &keyReloader{
+		keyring: keyring,
+		source: source,
+		fetch: fetch,
+		accepts: accepts,
+		ttl: ttl,
+		interval: interval,
+	}
+}
+
+// Load reads the keys of the source and moves them to their states in the keyring, on error the loaded keys are kept
+func (r *keyReloader) Load(ctx context.Context) error {
+	childLogger.Debug().Msg("Load")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attemptMu.Lock()
+	r.attemptedAt = time.Now()
+	r.attemptMu.Unlock()
+
+	keys, err := r.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	if err := r.keyring.Sync(r.source, keys); err != nil {
+		return err
+	}
+
+	loaded := ""
+	for _, key := range keys {
+		loaded += key.Kid + ":" + string(key.State) + " "
+	}
+	if loaded == r.loaded {
+		return nil
+	}
+	r.loaded = loaded
+
+	for _, key := range keys {
+		childLogger.Info().Str("source", r.source).Str("kid", key.Kid).Str("alg", key.Alg).Str("state", string(key.State)).Msg("key loaded")
+	}
+	return nil
+}
+
+// reload is called by the keyring for an unknown kid, nothing is done while an other load runs or
+// before the interval since the last attempt
+func (r *keyReloader) reload(kid string, alg string) {
+	if !r.accepts(alg) {
+		return
+	}
+
+	r.attemptMu.Lock()
+	if r.reloading || time.Since(r.attemptedAt) < r.interval {
+		r.attemptMu.Unlock()
+		return
+	}
+	r.reloading = true
+	r.attemptedAt = time.Now()
+	r.attemptMu.Unlock()
+
+	defer func() {
+		r.attemptMu.Lock()
+		r.reloading = false
+		r.attemptMu.Unlock()
+	}()
+
+	childLogger.Info().Str("source", r.source).Str("kid", kid).Msg("unknown kid, reloading the keys")
+	// the reload is shared by the requests, it does not depend on the one that found the kid
+	if err := r.Load(context.Background()); err != nil {
+		childLogger.Error().Err(err).Str("source", r.source).Msg("error reload keys")
+	}
+}
+
+// Start reloads the keys each ttl until the context is done. In Lambda the ticker is frozen
+// between the invocations and fires again on the first invocation after the ttl
+func (r *keyReloader) Start(ctx context.Context) {
+	childLogger.Debug().Msg("Start")
+
+	r.keyring.OnUnknownKid(r.reload)
+	if r.ttl <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.ttl)
+		defer ticker.Stop()
+
+		for {
+			select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := r.Load(ctx); err != nil {
+						childLogger.Error().Err(err).Str("source", r.source).Msg("error refresh keys")
+					}
+			}
+		}
+	}()
+}
@@ -0,0 +1,197 @@
+package jwt
+
+import (
+	"os"
+	"fmt"
+	"context"
+	"strings"
+	"crypto"
+	"crypto/rsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/ed25519"
+	"path/filepath"
+	"encoding/base64"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/lambda-go-autentication/pkg/aws_ssm"
+	"github.com/lambda-go-autentication/pkg/aws_bucket_s3"
+	"github.com/lambda-go-autentication/pkg/aws_secret_manager"
+)
+
+// KeyProvider reads the pem of a key by name (object key, secret, parameter, file or variable name)
+type KeyProvider interface {
+	GetKey(ctx context.Context, name string) (*string, error)
+	// String describes the source in the diagnostics, ex: s3://bucket/path
+	String() string
+}
+
+type S3KeyProvider struct {
+	clientS3	*aws_bucket_s3.AwsClientBucketS3
+	bucketName	string
+	filePath	string
+}
+
+func NewS3KeyProvider(clientS3 *aws_bucket_s3.AwsClientBucketS3, bucketName string, filePath string) *S3KeyProvider {
+	return &S3KeyProvider{ clientS3: clientS3, bucketName: bucketName, filePath: filePath }
+}
+
+func (p *S3KeyProvider) GetKey(ctx context.Context, name string) (*string, error) {
+	return p.clientS3.GetObject(ctx, p.bucketName, p.filePath, name)
+}
+
+func (p *S3KeyProvider) String() string {
+	return "s3://" + p.bucketName + p.filePath
+}
+
+// SecretKeyProvider reads the AWSCURRENT value of the secret
+type SecretKeyProvider struct {
+	clientSecret	*aws_secret_manager.AwsClientSecretManager
+}
+
+func NewSecretKeyProvider(clientSecret *aws_secret_manager.AwsClientSecretManager) *SecretKeyProvider {
+	return &SecretKeyProvider{ clientSecret: clientSecret }
+}
+
+func (p *SecretKeyProvider) GetKey(ctx context.Context, name string) (*string, error) {
+	return p.clientSecret.GetSecret(ctx, name)
+}
+
+func (p *SecretKeyProvider) String() string {
+	return "secretsmanager"
+}
+
+// SSMKeyProvider reads a (SecureString) parameter of the Parameter Store
+type SSMKeyProvider struct {
+	clientSSM	*aws_ssm.AwsClientSSM
+}
+
+func NewSSMKeyProvider(clientSSM *aws_ssm.AwsClientSSM) *SSMKeyProvider {
+	return &SSMKeyProvider{ clientSSM: clientSSM }
+}
+
+func (p *SSMKeyProvider) GetKey(ctx context.Context, name string) (*string, error) {
+	return p.clientSSM.GetParameter(ctx, name)
+}
+
+func (p *SSMKeyProvider) String() string {
+	return "ssm"
+}
+
+// FileKeyProvider reads the files of a local directory (mounted secrets, development)
+type FileKeyProvider struct {
+	dir		string
+}
+
+func NewFileKeyProvider(dir string) *FileKeyProvider {
+	return &FileKeyProvider{ dir: dir }
+}
+
+func (p *FileKeyProvider) GetKey(ctx context.Context, name string) (*string, error) {
+	content, err := os.ReadFile(filepath.Join(p.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	key := string(content)
+	return &key, nil
+}
+
+func (p *FileKeyProvider) String() string {
+	return "file://" + p.dir
+}
+
+// EnvKeyProvider reads the environment variable, the pem or the pem encoded in base64 (single line)
+type EnvKeyProvider struct {}
+
+func NewEnvKeyProvider() *EnvKeyProvider {
+	return &EnvKeyProvider{}
+}
+
+func (p *EnvKeyProvider) GetKey(ctx context.Context, name string) (*string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, fmt.Errorf("variable %s not set", name)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s is neither a pem nor a base64 pem: %w", name, err)
+		}
+		value = string(decoded)
+	}
+	return &value, nil
+}
+
+func (p *EnvKeyProvider) String() string {
+	return "env"
+}
+
+// keyAlg returns the signing alg of the public key type
+func keyAlg(public_key crypto.PublicKey) (string, error) {
+	switch key := public_key.(type) {
+		case *rsa.PublicKey:
+			return jwt.SigningMethodRS256.Alg(), nil
+		case *ecdsa.PublicKey:
+			switch key.Curve {
+				case elliptic.P256():
+					return jwt.SigningMethodES256.Alg(), nil
+				case elliptic.P384():
+					return jwt.SigningMethodES384.Alg(), nil
+			}
+		case ed25519.PublicKey:
+			return jwt.SigningMethodEdDSA.Alg(), nil
+	}
+	return "", fmt.Errorf("key type %T not supported", public_key)
+}
+
+// LoadKeyPair reads and validates the private and public pem of the provider and builds the active key,
+// the alg comes from the key type and the kid is the thumbprint. Every error names the provider, the key and the step
+func LoadKeyPair(ctx context.Context, keyProvider KeyProvider, privateKeyName string, publicKeyName string) (*Key, error) {
+	childLogger.Debug().Msg("LoadKeyPair")
+
+	diagnostic := func(format string, args ...interface{}) error {
+		return fmt.Errorf("key provider %s: " + format, append([]interface{}{keyProvider}, args...)...)
+	}
+
+	key_priv_pem, err := keyProvider.GetKey(ctx, privateKeyName)
+	if err != nil {
+		return nil, diagnostic("read private key %q: %w", privateKeyName, err)
+	}
+	key_pub_pem, err := keyProvider.GetKey(ctx, publicKeyName)
+	if err != nil {
+		return nil, diagnostic("read public key %q: %w", publicKeyName, err)
+	}
+
+	private_key, err := ParsePemToPriv(key_priv_pem)
+	if err != nil {
+		return nil, diagnostic("parse private key %q (PKCS8 or SEC1 pem expected): %w", privateKeyName, err)
+	}
+	public_key, err := ParsePemToPub(key_pub_pem)
+	if err != nil {
+		return nil, diagnostic("parse public key %q (PKIX pem expected): %w", publicKeyName, err)
+	}
+
+	kid, err := Thumbprint(public_key)
+	if err != nil {
+		return nil, diagnostic("public key %q: %w", publicKeyName, err)
+	}
+	if !samePublicKey(private_key, public_key) {
+		private_kid, _ := Thumbprint(private_key.Public())
+		return nil, diagnostic("private key %q does not match public key %q (public kid %s, private kid %s)",
+								privateKeyName, publicKeyName, kid, private_kid)
+	}
+
+	alg, err := keyAlg(public_key)
+	if err != nil {
+		return nil, diagnostic("public key %q: %w", publicKeyName, err)
+	}
+
+	childLogger.Info().Str("provider", keyProvider.String()).Str("kid", kid).Str("alg", alg).Msg("key pair loaded")
+
+	return &Key{	Kid: kid,
+					Alg: alg,
+					State: KeyStateActive,
+					Private: private_key,
+					Public: public_key }, nil
+}
@@ -0,0 +1,129 @@
+package jwt
+
+import (
+	"os"
+	"context"
+	"strings"
+	"testing"
+	"path/filepath"
+	"encoding/base64"
+)
+
+func TestFileKeyProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "private_key.pem"), []byte("pem"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyProvider := NewFileKeyProvider(dir)
+
+	key, err := keyProvider.GetKey(context.Background(), "private_key.pem")
+	if err != nil || *key != "pem" {
+		t.Fatalf("GetKey = %v (%v), want pem", key, err)
+	}
+	if _, err := keyProvider.GetKey(context.Background(), "missing.pem"); err == nil {
+		t.Error("GetKey of a missing file must fail")
+	}
+	if keyProvider.String() != "file://" + dir {
+		t.Errorf("String = %s", keyProvider)
+	}
+}
+
+func TestEnvKeyProvider(t *testing.T) {
+	pem := "-----BEGIN PUBLIC KEY-----\nMFkw\n-----END PUBLIC KEY-----\n"
+
+	cases := []struct {
+		name	string
+		value	string
+		want	string
+		wantErr	bool
+	}{
+		{ name: "pem", value: pem, want: pem },
+		{ name: "pem with leading spaces", value: "  " + pem, want: "  " + pem },
+		{ name: "base64 pem", value: base64.StdEncoding.EncodeToString([]byte(pem)), want: pem },
+		{ name: "not set", value: "", wantErr: true },
+		{ name: "neither pem nor base64", value: "not-a-pem!", wantErr: true },
+	}
+
+	keyProvider := NewEnvKeyProvider()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("TEST_KEY_PEM", c.value)
+
+			key, err := keyProvider.GetKey(context.Background(), "TEST_KEY_PEM")
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("GetKey must fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *key != c.want {
+				t.Errorf("GetKey = %q, want %q", *key, c.want)
+			}
+		})
+	}
+}
+
+// TestLoadKeyPair checks the key pair of each type is loaded active with its alg and thumbprint kid, and the
+// errors name the provider, the key and the step
+func TestLoadKeyPair(t *testing.T) {
+	signers := testSigners(t)
+	dir := t.TempDir()
+	write := func(name string, content *string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(*content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for alg, signer := range signers {
+		write(alg + "_private.pem", pkcs8Pem(t, signer))
+		write(alg + "_public.pem", pkixPem(t, signer.Public()))
+	}
+	not_pem := "not a pem"
+	write("invalid.pem", &not_pem)
+	keyProvider := NewFileKeyProvider(dir)
+
+	for alg, signer := range signers {
+		t.Run(alg, func(t *testing.T) {
+			key, err := LoadKeyPair(context.Background(), keyProvider, alg + "_private.pem", alg + "_public.pem")
+			if err != nil {
+				t.Fatal(err)
+			}
+			kid, err := Thumbprint(signer.Public())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.Alg != alg || key.Kid != kid || key.State != KeyStateActive || key.Private == nil || key.Public == nil {
+				t.Errorf("key = %s %s %s, want %s %s active", key.Kid, key.Alg, key.State, kid, alg)
+			}
+		})
+	}
+
+	cases := []struct {
+		name		string
+		private		string
+		public		string
+		wantInErr	[]string
+	}{
+		{ name: "missing private key", private: "missing.pem", public: "RS256_public.pem", wantInErr: []string{"file://" + dir, `read private key "missing.pem"`} },
+		{ name: "missing public key", private: "RS256_private.pem", public: "missing.pem", wantInErr: []string{`read public key "missing.pem"`} },
+		{ name: "invalid private pem", private: "invalid.pem", public: "RS256_public.pem", wantInErr: []string{`parse private key "invalid.pem"`} },
+		{ name: "invalid public pem", private: "RS256_private.pem", public: "invalid.pem", wantInErr: []string{`parse public key "invalid.pem"`} },
+		{ name: "private key of another pair", private: "ES256_private.pem", public: "RS256_public.pem", wantInErr: []string{`private key "ES256_private.pem" does not match public key "RS256_public.pem"`} },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := LoadKeyPair(context.Background(), keyProvider, c.private, c.public)
+			if err == nil {
+				t.Fatal("LoadKeyPair must fail")
+			}
+			for _, want := range c.wantInErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("err = %v, want it to contain %s", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package jwt
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"regexp"
+	"crypto"
+
+	"github.com/lambda-go-autentication/internal/erro"
+)
+
+// KeyState is the stage of a key in the rotation
+//
+//	pending  -> published for verification (JWKS), never used to sign
+//	active   -> the only key used to sign for its algorithm
+//	retiring -> no longer signs, still verifies the outstanding tokens
+//	retired  -> kept only for reference, not used at all
+type KeyState string
+
+const (
+	KeyStatePending		KeyState = "pending"
+	KeyStateActive		KeyState = "active"
+	KeyStateRetiring	KeyState = "retiring"
+	KeyStateRetired		KeyState = "retired"
+)
+
+// kidFormat is the format of the kids of the keyring (thumbprints, secret version ids, S3 folder names),
+// an unknown kid of an other format comes from a forged token and never triggers a reload
+var kidFormat = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+type Key struct {
+	Kid			string
+	Alg			string
+	State		KeyState
+	Secret		[]byte				// symetric keys (HS256)
+	Private		crypto.PrivateKey	// asymetric keys, nil for a verification only key
+	Public		crypto.PublicKey
+	Source		string				// the source that loaded the key (Sync), empty for the keys added once on the start
+}
+
+func (k *Key) symmetric() bool {
+	return k.Secret != nil
+}
+
+func (k *Key) signingKey() interface{} {
+	if k.symmetric() {
+		return k.Secret
+	}
+	return k.Private
+}
+
+func (k *Key) verificationKey() interface{} {
+	if k.symmetric() {
+		return k.Secret
+	}
+	return k.Public
+}
+
+func (k *Key) canVerify() bool {
+	return k.State == KeyStateActive || k.State == KeyStateRetiring
+}
+
+// published keys are exposed in the JWKS, the symetric keys never are
+func (k *Key) published() bool {
+	return !k.symmetric() && k.Public != nil && k.State != KeyStateRetired
+}
+
+// keyStateOrder is the position of each stage, a key only moves forward
+var keyStateOrder = map[KeyState]int{
+	KeyStatePending:	0,
+	KeyStateActive:		1,
+	KeyStateRetiring:	2,
+	KeyStateRetired:	3,
+}
+
+// Keyring holds every key known by the service, indexed by kid
+type Keyring struct {
+	mu				sync.RWMutex
+	keys			map[string]*Key
+	onUnknownKid	[]func(kid string, alg string)
+}
+
+func NewKeyring() *Keyring {
+	childLogger.Debug().Msg("NewKeyring")
+
+	return &Keyring{
+		keys: map[string]*Key{},
+	}
+}
+
+// Add inserts or replaces a key. Only one active key per algorithm is accepted
+func (k *Keyring) Add(key *Key) error {
+	if key.Kid == "" || key.Alg == "" || (key.Secret == nil && key.Public == nil) {
+		return erro.ErrKeyInvalid
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key.State == KeyStateActive {
+		if key.signingKey() == nil {
+			return erro.ErrKeyInvalid
+		}
+		if current := k.active(key.Alg); current != nil && current.Kid != key.Kid {
+			return fmt.Errorf("%w: key %s conflicts with active key %s for %s", erro.ErrKeyState, key.Kid, current.Kid, key.Alg)
+		}
+	}
+
+	k.keys[key.Kid] = key
+	return nil
+}
+
+// Sync moves the keys of the source to the states informed by it (reloaded while the service runs, ex: the S3 prefix
+// or the HS256 secret versions). A new kid is added in its state, a known kid takes the state of the source,
+// a kid no longer listed is retired and removed on the next Sync. The source is the authority: a backward move
+// (ex: a Secrets Manager rollback, AWSPREVIOUS back to AWSCURRENT) is applied and logged.
+// An invalid key or two active keys for an algorithm refuse the whole Sync, the keyring is not changed
+func (k *Keyring) Sync(source string, keys []*Key) error {
+	incoming := map[string]*Key{}
+	for _, key := range keys {
+		if key.Kid == "" || key.Alg == "" || (key.Secret == nil && key.Public == nil) {
+			return erro.ErrKeyInvalid
+		}
+		if key.State == KeyStateActive && key.signingKey() == nil {
+			return erro.ErrKeyInvalid
+		}
+		if _, ok := keyStateOrder[key.State]; !ok {
+			return erro.ErrKeyState
+		}
+		incoming[key.Kid] = key
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	next := make(map[string]*Key, len(k.keys) + len(keys))
+	for kid, key := range k.keys {
+		if key.Source != source {
+			next[kid] = key
+			continue
+		}
+		if _, ok := incoming[kid]; ok {
+			continue
+		}
+		if key.State == KeyStateRetired {
+			continue
+		}
+		retired := *key
+		retired.State = KeyStateRetired
+		next[kid] = &retired
+	}
+
+	backward := map[string]KeyState{}
+	for kid, key := range incoming {
+		if current, ok := k.keys[kid]; ok {
+			if current.Source != source {
+				return fmt.Errorf("%w: key %s already loaded by an other source", erro.ErrKeyInvalid, kid)
+			}
+			if keyStateOrder[key.State] < keyStateOrder[current.State] {
+				backward[kid] = current.State
+			}
+		}
+		synced := *key
+		synced.Source = source
+		next[kid] = &synced
+	}
+
+	actives := map[string]string{}
+	for _, key := range next {
+		if key.State != KeyStateActive {
+			continue
+		}
+		if active, ok := actives[key.Alg]; ok {
+			return fmt.Errorf("%w: key %s conflicts with active key %s for %s", erro.ErrKeyState, key.Kid, active, key.Alg)
+		}
+		actives[key.Alg] = key.Kid
+	}
+
+	for kid, previous := range backward {
+		childLogger.Warn().Str("source", source).Str("kid", kid).Str("from", string(previous)).Str("to", string(incoming[kid].State)).Msg("key moved back by the source (rollback)")
+	}
+
+	k.keys = next
+	return nil
+}
+
+// OnUnknownKid registers a function called (without blocking the verification) when a token carries a well formed kid
+// not in the keyring, ex: an other instance already signs with a rotated key. Each source registers its own and throttles its reloads
+func (k *Keyring) OnUnknownKid(fn func(kid string, alg string)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.onUnknownKid = append(k.onUnknownKid, fn)
+}
+
+// SetState moves a key to the next stage. Activating a key moves the current
+// active key of the same algorithm to retiring
+func (k *Keyring) SetState(kid string, state KeyState) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return erro.ErrKeyNotFound
+	}
+
+	switch {
+		case key.State == KeyStatePending && state == KeyStateActive:
+			if key.signingKey() == nil {
+				return erro.ErrKeyInvalid
+			}
+			if current := k.active(key.Alg); current != nil {
+				current.State = KeyStateRetiring
+			}
+		case key.State == KeyStatePending && state == KeyStateRetired:
+		case key.State == KeyStateActive && state == KeyStateRetiring:
+		case key.State == KeyStateRetiring && state == KeyStateRetired:
+		default:
+			return erro.ErrKeyState
+	}
+
+	key.State = state
+	return nil
+}
+
+func (k *Keyring) active(alg string) *Key {
+	for _, key := range k.keys {
+		if key.Alg == alg && key.State == KeyStateActive {
+			return key
+		}
+	}
+	return nil
+}
+
+// Signing returns the active key of the algorithm
+func (k *Keyring) Signing(alg string) (*Key, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key := k.active(alg)
+	if key == nil {
+		return nil, erro.ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// Verification selects the key by kid. Tokens issued before the keyring do not
+// carry a kid and are checked against the active key of the algorithm
+func (k *Keyring) Verification(kid string, alg string) (*Key, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if kid == "" {
+		if key := k.active(alg); key != nil {
+			return key, nil
+		}
+		return nil, erro.ErrStatusUnauthorized
+	}
+
+	key, ok := k.keys[kid]
+	if !ok && kidFormat.MatchString(kid) {
+		for _, fn := range k.onUnknownKid {
+			go fn(kid, alg)
+		}
+	}
+	if !ok || key.Alg != alg || !key.canVerify() {
+		return nil, erro.ErrStatusUnauthorized
+	}
+	return key, nil
+}
+
+// Keys returns a snapshot of the keys ordered by kid
+func (k *Keyring) Keys() []Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, *key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+
+	return keys
+}
@@ -0,0 +1,184 @@
+package jwt
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"context"
+	"strings"
+	"errors"
+	"encoding/json"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/pkg/aws_bucket_s3"
+	"github.com/lambda-go-autentication/pkg/aws_secret_manager"
+)
+
+// file names expected in each <prefix>/<kid>/ folder of the keyring bucket
+const (
+	keyringFileManifest		= "key.json"
+	keyringFilePrivateKey	= "private_key.pem"
+	keyringFilePublicKey	= "public_key.pem"
+)
+
+type keyManifest struct {
+	Alg		string		`json:"alg"`
+	State	KeyState	`json:"state"`
+}
+
+// minimum interval between two reloads of the S3 keyring caused by unknown kids
+const s3UnknownKidInterval = 30 * time.Second
+
+// S3KeySource keeps the keys of the <prefix>/<kid>/ folders of the bucket in the keyring. Each folder has a key.json
+// with the alg (RS256, ES256, ES384 or EdDSA) and state, a public_key.pem and, except for verification only keys, a private_key.pem.
+// The folders are reloaded each ttl and when a token carries an unknown kid, so a state changed in key.json
+// (ex: pending to active) moves the key in the keyring without a redeploy
+type S3KeySource struct {
+	*keyReloader
+	clientS3	*aws_bucket_s3.AwsClientBucketS3
+	bucketName	string
+	prefix		string
+}
+
+func NewS3KeySource(keyring *Keyring,
+					clientS3 *aws_bucket_s3.AwsClientBucketS3,
+					bucketName string,
+					prefix string,
+					ttl time.Duration) *S3KeySource {
+	childLogger.Debug().Msg("NewS3KeySource")
+
+	s := &S3KeySource{
+		clientS3: clientS3,
+		bucketName: bucketName,
+		prefix: prefix,
+	}
+	s.keyReloader = newKeyReloader(keyring, "s3:" + bucketName + "/" + prefix, ttl, s3UnknownKidInterval, asymmetricAlg, s.keys)
+	return s
+}
+
+func asymmetricAlg(alg string) bool {
+	_, err := AsymmetricMethod(alg)
+	return err == nil
+}
+
+// keys reads every kid folder of the prefix
+func (s *S3KeySource) keys(ctx context.Context) ([]*Key, error) {
+	objectKeys, err := s.clientS3.ListObjectKeys(ctx, s.bucketName, s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// group the files by kid folder
+	folders := map[string]map[string]string{}
+	for _, objectKey := range objectKeys {
+		relative := strings.TrimPrefix(strings.TrimPrefix(objectKey, s.prefix), "/")
+		kid, fileName, found := strings.Cut(relative, "/")
+		if !found || kid == "" {
+			continue
+		}
+		if folders[kid] == nil {
+			folders[kid] = map[string]string{}
+		}
+		folders[kid][fileName] = objectKey
+	}
+
+	keys := []*Key{}
+	for kid, files := range folders {
+		key, err := loadKeyS3(ctx, s.clientS3, s.bucketName, kid, files)
+		if err != nil {
+			return nil, errors.New("keyring kid " + kid + ": " + err.Error())
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+
+	return keys, nil
+}
+
+func loadKeyS3(	ctx context.Context,
+				clientS3 *aws_bucket_s3.AwsClientBucketS3,
+				bucketName string,
+				kid string,
+				files map[string]string) (*Key, error) {
+
+	if files[keyringFileManifest] == "" || files[keyringFilePublicKey] == "" {
+		return nil, errors.New("missing " + keyringFileManifest + " or " + keyringFilePublicKey)
+	}
+
+	manifest_json, err := clientS3.GetObject(ctx, bucketName, "", files[keyringFileManifest])
+	if err != nil {
+		return nil, err
+	}
+	var manifest keyManifest
+	if err := json.Unmarshal([]byte(*manifest_json), &manifest); err != nil {
+		return nil, err
+	}
+
+	key := Key{ Kid: kid, Alg: manifest.Alg, State: manifest.State }
+	switch key.State {
+		case KeyStatePending, KeyStateActive, KeyStateRetiring, KeyStateRetired:
+		default:
+			return nil, fmt.Errorf("%w: state %s", erro.ErrKeyState, key.State)
+	}
+	if _, err := AsymmetricMethod(key.Alg); err != nil || key.Alg == "" {
+		return nil, errors.New("unsupported alg " + key.Alg)
+	}
+
+	key_pub_pem, err := clientS3.GetObject(ctx, bucketName, "", files[keyringFilePublicKey])
+	if err != nil {
+		return nil, err
+	}
+	public_key, err := ParsePemToPub(key_pub_pem)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKeyAlg(key.Alg, public_key); err != nil {
+		return nil, err
+	}
+	key.Public = public_key
+
+	if files[keyringFilePrivateKey] != "" {
+		key_priv_pem, err := clientS3.GetObject(ctx, bucketName, "", files[keyringFilePrivateKey])
+		if err != nil {
+			return nil, err
+		}
+		private_key, err := ParsePemToPriv(key_priv_pem)
+		if err != nil {
+			return nil, err
+		}
+		if !samePublicKey(private_key, public_key) {
+			return nil, errors.New("private key does not match the public key")
+		}
+		key.Private = private_key
+	}
+
+	return &key, nil
+}
+
+// secretStageToState maps the Secrets Manager staging labels to the key stages
+func secretStageToState(versionStages []string) KeyState {
+	state := KeyStateRetired
+	for _, stage := range versionStages {
+		switch stage {
+			case "AWSCURRENT":
+				return KeyStateActive
+			case "AWSPENDING":
+				state = KeyStatePending
+			case "AWSPREVIOUS":
+				if state != KeyStatePending {
+					state = KeyStateRetiring
+				}
+		}
+	}
+	return state
+}
+
+// KeyFromSecret builds a HS256 key from a secret version, the kid is the version id
+func KeyFromSecret(secretVersion *aws_secret_manager.SecretVersion) *Key {
+	return &Key{	Kid: secretVersion.VersionId,
+					Alg: jwt.SigningMethodHS256.Alg(),
+					State: secretStageToState(secretVersion.VersionStages),
+					Secret: []byte(*secretVersion.SecretString) }
+}
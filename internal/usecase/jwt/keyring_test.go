@@ -0,0 +1,342 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+	"errors"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"sync/atomic"
+	"crypto/rand"
+	"crypto/rsa"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/pkg/aws_secret_manager"
+)
+
+func testSecretKey(kid string, state KeyState) *Key {
+	return &Key{ Kid: kid, Alg: "HS256", State: state, Secret: []byte("secret-" + kid) }
+}
+
+func testRSAKey(t testing.TB, kid string, state KeyState) *Key {
+	t.Helper()
+
+	private_key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Key{ Kid: kid, Alg: "RS256", State: state, Private: private_key, Public: &private_key.PublicKey }
+}
+
+func keyStates(keyring *Keyring) map[string]KeyState {
+	states := map[string]KeyState{}
+	for _, key := range keyring.Keys() {
+		states[key.Kid] = key.State
+	}
+	return states
+}
+
+func TestKeyringSetState(t *testing.T) {
+	cases := []struct {
+		name	string
+		keys	[]*Key
+		kid		string
+		state	KeyState
+		wantErr	error
+		want	map[string]KeyState
+	}{
+		{	name: "pending to active retires the current active key",
+			keys: []*Key{ testSecretKey("k1", KeyStateActive), testSecretKey("k2", KeyStatePending) },
+			kid: "k2", state: KeyStateActive,
+			want: map[string]KeyState{ "k1": KeyStateRetiring, "k2": KeyStateActive } },
+		{	name: "pending to retired",
+			keys: []*Key{ testSecretKey("k1", KeyStatePending) },
+			kid: "k1", state: KeyStateRetired,
+			want: map[string]KeyState{ "k1": KeyStateRetired } },
+		{	name: "active to retiring",
+			keys: []*Key{ testSecretKey("k1", KeyStateActive) },
+			kid: "k1", state: KeyStateRetiring,
+			want: map[string]KeyState{ "k1": KeyStateRetiring } },
+		{	name: "retiring to retired",
+			keys: []*Key{ testSecretKey("k1", KeyStateRetiring) },
+			kid: "k1", state: KeyStateRetired,
+			want: map[string]KeyState{ "k1": KeyStateRetired } },
+		{	name: "retired to active is refused",
+			keys: []*Key{ testSecretKey("k1", KeyStateRetired) },
+			kid: "k1", state: KeyStateActive,
+			wantErr: erro.ErrKeyState,
+			want: map[string]KeyState{ "k1": KeyStateRetired } },
+		{	name: "active to pending is refused",
+			keys: []*Key{ testSecretKey("k1", KeyStateActive) },
+			kid: "k1", state: KeyStatePending,
+			wantErr: erro.ErrKeyState,
+			want: map[string]KeyState{ "k1": KeyStateActive } },
+		{	name: "unknown kid",
+			keys: []*Key{ testSecretKey("k1", KeyStateActive) },
+			kid: "k9", state: KeyStateRetiring,
+			wantErr: erro.ErrKeyNotFound,
+			want: map[string]KeyState{ "k1": KeyStateActive } },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			keyring := NewKeyring()
+			for _, key := range c.keys {
+				if err := keyring.Add(key); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := keyring.SetState(c.kid, c.state)
+			if !errors.Is(err, c.wantErr) {
+				t.Fatalf("SetState error = %v, want %v", err, c.wantErr)
+			}
+			got := keyStates(keyring)
+			for kid, state := range c.want {
+				if got[kid] != state {
+					t.Errorf("kid %s state = %s, want %s", kid, got[kid], state)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyringSync(t *testing.T) {
+	cases := []struct {
+		name	string
+		first	[]*Key
+		second	[]*Key
+		wantErr	error
+		want	map[string]KeyState
+	}{
+		{	name: "pending moves to active",
+			first: []*Key{ testSecretKey("k1", KeyStateActive), testSecretKey("k2", KeyStatePending) },
+			second: []*Key{ testSecretKey("k1", KeyStateRetiring), testSecretKey("k2", KeyStateActive) },
+			want: map[string]KeyState{ "k1": KeyStateRetiring, "k2": KeyStateActive } },
+		{	name: "a kid no longer listed is retired",
+			first: []*Key{ testSecretKey("k1", KeyStateRetiring), testSecretKey("k2", KeyStateActive) },
+			second: []*Key{ testSecretKey("k2", KeyStateActive) },
+			want: map[string]KeyState{ "k1": KeyStateRetired, "k2": KeyStateActive } },
+		{	name: "a rollback of the source is applied",
+			first: []*Key{ testSecretKey("k1", KeyStateRetiring), testSecretKey("k2", KeyStateActive) },
+			second: []*Key{ testSecretKey("k1", KeyStateActive), testSecretKey("k2", KeyStateRetiring) },
+			want: map[string]KeyState{ "k1": KeyStateActive, "k2": KeyStateRetiring } },
+		{	name: "a retired key activated again",
+			first: []*Key{ testSecretKey("k1", KeyStateRetired), testSecretKey("k2", KeyStateActive) },
+			second: []*Key{ testSecretKey("k1", KeyStateActive) },
+			want: map[string]KeyState{ "k1": KeyStateActive, "k2": KeyStateRetired } },
+		{	name: "two active keys of an alg are refused",
+			first: []*Key{ testSecretKey("k1", KeyStateActive) },
+			second: []*Key{ testSecretKey("k1", KeyStateActive), testSecretKey("k2", KeyStateActive) },
+			wantErr: erro.ErrKeyState,
+			want: map[string]KeyState{ "k1": KeyStateActive } },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			keyring := NewKeyring()
+			if err := keyring.Sync("test", c.first); err != nil {
+				t.Fatal(err)
+			}
+
+			err := keyring.Sync("test", c.second)
+			if !errors.Is(err, c.wantErr) {
+				t.Fatalf("Sync error = %v, want %v", err, c.wantErr)
+			}
+			got := keyStates(keyring)
+			if len(got) != len(c.want) {
+				t.Errorf("keys = %v, want %v", got, c.want)
+			}
+			for kid, state := range c.want {
+				if got[kid] != state {
+					t.Errorf("kid %s state = %s, want %s", kid, got[kid], state)
+				}
+			}
+		})
+	}
+}
+
+// TestKeyringSyncSecretRollback moves AWSCURRENT back to the previous version, as the Secrets Manager
+// rollback does: the previous version signs again without a redeploy
+func TestKeyringSyncSecretRollback(t *testing.T) {
+	secretKey := func(kid string, stages ...string) *Key {
+		secret := "secret-" + kid
+		return KeyFromSecret(&aws_secret_manager.SecretVersion{ VersionId: kid, VersionStages: stages, SecretString: &secret })
+	}
+
+	keyring := NewKeyring()
+	snapshots := [][]*Key{
+		{ secretKey("v1", "AWSCURRENT") },
+		{ secretKey("v2", "AWSCURRENT"), secretKey("v1", "AWSPREVIOUS") },
+		{ secretKey("v1", "AWSCURRENT"), secretKey("v2", "AWSPREVIOUS") },
+	}
+	for _, snapshot := range snapshots {
+		if err := keyring.Sync("secretsmanager:test", snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key, err := keyring.Signing("HS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Kid != "v1" {
+		t.Errorf("signing kid = %s, want v1", key.Kid)
+	}
+	if states := keyStates(keyring); states["v2"] != KeyStateRetiring {
+		t.Errorf("v2 state = %s, want retiring", states["v2"])
+	}
+}
+
+func TestKeyringSyncSources(t *testing.T) {
+	keyring := NewKeyring()
+	if err := keyring.Add(testSecretKey("start", KeyStateRetiring)); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Sync("a", []*Key{ testSecretKey("k1", KeyStateRetired) }); err != nil {
+		t.Fatal(err)
+	}
+
+	// a kid of an other source is refused, the keys of the other sources are kept
+	if err := keyring.Sync("b", []*Key{ testSecretKey("k1", KeyStateActive) }); !errors.Is(err, erro.ErrKeyInvalid) {
+		t.Errorf("Sync of a kid loaded by an other source error = %v, want %v", err, erro.ErrKeyInvalid)
+	}
+	if err := keyring.Sync("b", []*Key{ testSecretKey("k2", KeyStateActive) }); err != nil {
+		t.Fatal(err)
+	}
+
+	// a retired kid no longer listed is removed
+	if err := keyring.Sync("a", nil); err != nil {
+		t.Fatal(err)
+	}
+	got := keyStates(keyring)
+	want := map[string]KeyState{ "start": KeyStateRetiring, "k2": KeyStateActive }
+	if len(got) != len(want) || got["start"] != want["start"] || got["k2"] != want["k2"] {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+}
+
+func TestKeyringVerification(t *testing.T) {
+	keyring := NewKeyring()
+	for _, key := range []*Key{	testSecretKey("active", KeyStateActive),
+								testSecretKey("retiring", KeyStateRetiring),
+								testSecretKey("pending", KeyStatePending),
+								testSecretKey("retired", KeyStateRetired),
+								testRSAKey(t, "rsa", KeyStateActive) } {
+		if err := keyring.Add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name	string
+		kid		string
+		alg		string
+		wantKid	string
+	}{
+		{ name: "active kid", kid: "active", alg: "HS256", wantKid: "active" },
+		{ name: "retiring kid still verifies", kid: "retiring", alg: "HS256", wantKid: "retiring" },
+		{ name: "without kid the active key of the alg", kid: "", alg: "RS256", wantKid: "rsa" },
+		{ name: "pending kid is rejected", kid: "pending", alg: "HS256" },
+		{ name: "retired kid is rejected", kid: "retired", alg: "HS256" },
+		{ name: "unknown kid is rejected", kid: "unknown", alg: "HS256" },
+		{ name: "kid of an other alg is rejected", kid: "rsa", alg: "HS256" },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			key, err := keyring.Verification(c.kid, c.alg)
+			if c.wantKid == "" {
+				if !errors.Is(err, erro.ErrStatusUnauthorized) {
+					t.Fatalf("Verification error = %v, want %v", err, erro.ErrStatusUnauthorized)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.Kid != c.wantKid {
+				t.Errorf("kid = %s, want %s", key.Kid, c.wantKid)
+			}
+		})
+	}
+}
+
+func TestKeyringOnUnknownKid(t *testing.T) {
+	cases := []struct {
+		name		string
+		kid			string
+		wantCalled	bool
+	}{
+		{ name: "unknown kid", kid: "rotated", wantCalled: true },
+		{ name: "secret version id", kid: "a1b2c3d4-0000-4000-8000-000000000001", wantCalled: true },
+		{ name: "kid with a path", kid: "../rotated", wantCalled: false },
+		{ name: "kid too long", kid: strings.Repeat("k", 200), wantCalled: false },
+		{ name: "kid with spaces", kid: "rotated key", wantCalled: false },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			keyring := NewKeyring()
+			called := make(chan string, 1)
+			keyring.OnUnknownKid(func(kid string, alg string) { called <- kid })
+
+			if _, err := keyring.Verification(c.kid, "RS256"); err == nil {
+				t.Fatal("unknown kid must be rejected")
+			}
+			select {
+				case kid := <-called:
+					if !c.wantCalled || kid != c.kid {
+						t.Errorf("OnUnknownKid kid = %s, want called %v", kid, c.wantCalled)
+					}
+				case <-time.After(100 * time.Millisecond):
+					if c.wantCalled {
+						t.Error("OnUnknownKid not called")
+					}
+			}
+		})
+	}
+}
+
+func TestKeyReloaderThrottle(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	failing := func(ctx context.Context) ([]*Key, error) {
+		calls.Add(1)
+		started <- struct{}{}
+		<-release
+		return nil, errors.New("source unavailable")
+	}
+	reloader := newKeyReloader(NewKeyring(), "test", 0, time.Hour, symmetricAlg, failing)
+
+	// the concurrent unknown kids collapse into the running reload
+	done := make(chan struct{})
+	go func() {
+		reloader.reload("forged-0", "HS256")
+		close(done)
+	}()
+	<-started
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reloader.reload("forged-" + strconv.Itoa(i), "HS256")
+		}()
+	}
+	wg.Wait()
+	close(release)
+	<-done
+
+	// the failed attempt still throttles the next ones
+	reloader.reload("forged-51", "HS256")
+	// an other algorithm is not reloaded by the source
+	reloader.reload("forged-52", "RS256")
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("loads = %d, want 1", got)
+	}
+}
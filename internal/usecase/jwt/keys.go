@@ -0,0 +1,204 @@
+package jwt
+
+import (
+	"fmt"
+	"crypto"
+	"crypto/x509"
+	"crypto/rsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"math/big"
+	"encoding/base64"
+	"encoding/pem"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+// asymmetricMethods are the algorithms accepted by the RSA routes (kept for compatibility, any asymetric alg)
+var asymmetricMethods = []jwt.SigningMethod{
+	jwt.SigningMethodRS256,
+	jwt.SigningMethodES256,
+	jwt.SigningMethodES384,
+	jwt.SigningMethodEdDSA,
+}
+
+// AsymmetricMethod returns the signing method of a client signing_alg, RS256 when not informed
+func AsymmetricMethod(alg string) (jwt.SigningMethod, error) {
+	if alg == "" {
+		return jwt.SigningMethodRS256, nil
+	}
+	for _, method := range asymmetricMethods {
+		if method.Alg() == alg {
+			return method, nil
+		}
+	}
+	return nil, erro.ErrSigningAlg
+}
+
+// checkKeyAlg confirms the public key type (and curve) is the one required by the alg
+func checkKeyAlg(alg string, public_key crypto.PublicKey) error {
+	switch key := public_key.(type) {
+		case *rsa.PublicKey:
+			if alg == jwt.SigningMethodRS256.Alg() {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if (alg == jwt.SigningMethodES256.Alg() && key.Curve == elliptic.P256()) ||
+				(alg == jwt.SigningMethodES384.Alg() && key.Curve == elliptic.P384()) {
+				return nil
+			}
+		case ed25519.PublicKey:
+			if alg == jwt.SigningMethodEdDSA.Alg() {
+				return nil
+			}
+	}
+	return fmt.Errorf("key type %T not valid for alg %s", public_key, alg)
+}
+
+// ParsePemToPriv parses a PKCS8 (RSA, EC or Ed25519) or SEC1 (EC) private key
+func ParsePemToPriv(private_key *string) (crypto.Signer, error){
+	childLogger.Debug().Msg("ParsePemToPriv")
+
+	block, _ := pem.Decode([]byte(*private_key))
+	if block == nil {
+		childLogger.Error().Err(erro.ErrDecodeKey).Msg("erro Decode")
+		return nil, erro.ErrDecodeKey
+	}
+
+	switch block.Type {
+		case "PRIVATE KEY":
+			privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				childLogger.Error().Err(err).Msg("erro ParsePKCS8PrivateKey")
+				return nil, err
+			}
+			signer, ok := privateKey.(crypto.Signer)
+			if !ok {
+				return nil, erro.ErrDecodeKey
+			}
+			return signer, nil
+		case "EC PRIVATE KEY":
+			privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+			if err != nil {
+				childLogger.Error().Err(err).Msg("erro ParseECPrivateKey")
+				return nil, err
+			}
+			return privateKey, nil
+	}
+
+	childLogger.Error().Err(erro.ErrDecodeKey).Msg("erro Decode")
+	return nil, erro.ErrDecodeKey
+}
+
+// ParsePemToPub parses a PKIX public key (RSA, EC or Ed25519)
+func ParsePemToPub(public_key *string) (crypto.PublicKey, error){
+	childLogger.Debug().Msg("ParsePemToPub")
+
+	block, _ := pem.Decode([]byte(*public_key))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		childLogger.Error().Err(erro.ErrDecodeKey).Msg("erro Decode")
+		return nil, erro.ErrDecodeKey
+	}
+
+	pubInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("erro ParsePKIXPublicKey")
+		return nil, err
+	}
+
+	return pubInterface, nil
+}
+
+func ParsePemToRSAPriv(private_key *string) (*rsa.PrivateKey, error){
+	childLogger.Debug().Msg("ParsePemToRSA")
+
+	privateKey, err := ParsePemToPriv(private_key)
+	if err != nil {
+		return nil, err
+	}
+
+	key_rsa, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		childLogger.Error().Err(erro.ErrDecodeKey).Msgf("erro key type %T is not RSA", privateKey)
+		return nil, erro.ErrDecodeKey
+	}
+
+	return key_rsa, nil
+}
+
+func ParsePemToRSAPub(public_key *string) (*rsa.PublicKey, error){
+	childLogger.Debug().Msg("ParsePemToRSA")
+
+	pubInterface, err := ParsePemToPub(public_key)
+	if err != nil {
+		return nil, err
+	}
+
+	key_rsa, ok := pubInterface.(*rsa.PublicKey)
+	if !ok {
+		childLogger.Error().Err(erro.ErrDecodeKey).Msgf("erro key type %T is not RSA", pubInterface)
+		return nil, erro.ErrDecodeKey
+	}
+
+	return key_rsa, nil
+}
+
+// samePublicKey confirms the private key belongs to the public key
+func samePublicKey(private_key crypto.Signer, public_key crypto.PublicKey) bool {
+	comparable, ok := private_key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && comparable.Equal(public_key)
+}
+
+// Thumbprint returns the RFC 7638 JWK thumbprint used as kid
+func Thumbprint(public_key crypto.PublicKey) (string, error) {
+	jwk, err := PublicToJwk(public_key, "", "")
+	if err != nil {
+		return "", err
+	}
+
+	// required members in lexicographic order, without whitespace (RFC 7638 section 3.2)
+	var canonical string
+	switch jwk.Kty {
+		case "RSA":
+			canonical = fmt.Sprintf(`{"e":"%s","kty":"%s","n":"%s"}`, jwk.E, jwk.Kty, jwk.N)
+		case "EC":
+			canonical = fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s","y":"%s"}`, jwk.Crv, jwk.Kty, jwk.X, jwk.Y)
+		case "OKP":
+			canonical = fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s"}`, jwk.Crv, jwk.Kty, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// PublicToJwk converts a public key to a JWK (RFC 7517, RFC 8037 for Ed25519)
+func PublicToJwk(public_key crypto.PublicKey, kid string, alg string) (model.Jwk, error) {
+	jwk := model.Jwk{ Kid: kid, Use: "sig", Alg: alg }
+
+	switch key := public_key.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+		case *ecdsa.PublicKey:
+			// the coordinates are left padded to the curve size (RFC 7518 section 6.2.1.2)
+			size := (key.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = key.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(key)
+		default:
+			return jwk, fmt.Errorf("key type %T not supported", public_key)
+	}
+
+	return jwk, nil
+}
@@ -0,0 +1,290 @@
+package jwt
+
+import (
+	"errors"
+	"testing"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/lambda-go-autentication/internal/erro"
+)
+
+// pemOf encodes the der as a pem block of the type
+func pemOf(blockType string, der []byte) *string {
+	encoded := string(pem.EncodeToMemory(&pem.Block{ Type: blockType, Bytes: der }))
+	return &encoded
+}
+
+func pkcs8Pem(t *testing.T, private_key crypto.Signer) *string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(private_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pemOf("PRIVATE KEY", der)
+}
+
+func pkixPem(t *testing.T, public_key crypto.PublicKey) *string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(public_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pemOf("PUBLIC KEY", der)
+}
+
+// testSigners returns a key of each supported type by alg
+func testSigners(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+
+	rsa_key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384_key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed_key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]crypto.Signer{ "RS256": rsa_key, "ES256": p256_key, "ES384": p384_key, "EdDSA": ed_key }
+}
+
+// TestParsePem checks the private and public pem of each key type parse to a key pair that signs and verifies with its alg
+func TestParsePem(t *testing.T) {
+	for alg, signer := range testSigners(t) {
+		t.Run(alg, func(t *testing.T) {
+			private_key, err := ParsePemToPriv(pkcs8Pem(t, signer))
+			if err != nil {
+				t.Fatal(err)
+			}
+			public_key, err := ParsePemToPub(pkixPem(t, signer.Public()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !samePublicKey(private_key, public_key) {
+				t.Fatal("parsed private key does not match the public key")
+			}
+
+			got, err := keyAlg(public_key)
+			if err != nil || got != alg {
+				t.Fatalf("keyAlg = %s (%v), want %s", got, err, alg)
+			}
+			if err := checkKeyAlg(alg, public_key); err != nil {
+				t.Fatal(err)
+			}
+
+			method, err := AsymmetricMethod(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signature, err := method.Sign("header.payload", private_key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := method.Verify("header.payload", signature, public_key); err != nil {
+				t.Errorf("signature of %s not verified: %v", alg, err)
+			}
+		})
+	}
+}
+
+func TestParsePemToPrivSEC1(t *testing.T) {
+	ec_key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(ec_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private_key, err := ParsePemToPriv(pemOf("EC PRIVATE KEY", der))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePublicKey(private_key, &ec_key.PublicKey) {
+		t.Error("SEC1 private key does not match the public key")
+	}
+}
+
+func TestParsePemInvalid(t *testing.T) {
+	rsa_key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	not_pem := "not a pem"
+
+	private_cases := []struct {
+		name	string
+		pem		*string
+	}{
+		{ name: "not a pem", pem: &not_pem },
+		{ name: "PKCS1 block", pem: pemOf("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsa_key)) },
+		{ name: "public key as private key", pem: pkixPem(t, &ec_key.PublicKey) },
+		{ name: "corrupted PKCS8", pem: pemOf("PRIVATE KEY", []byte("corrupted")) },
+		{ name: "corrupted SEC1", pem: pemOf("EC PRIVATE KEY", []byte("corrupted")) },
+	}
+	for _, c := range private_cases {
+		t.Run("private "+c.name, func(t *testing.T) {
+			if _, err := ParsePemToPriv(c.pem); err == nil {
+				t.Error("ParsePemToPriv must fail")
+			}
+		})
+	}
+
+	public_cases := []struct {
+		name	string
+		pem		*string
+	}{
+		{ name: "not a pem", pem: &not_pem },
+		{ name: "private key as public key", pem: pkcs8Pem(t, ec_key) },
+		{ name: "corrupted PKIX", pem: pemOf("PUBLIC KEY", []byte("corrupted")) },
+	}
+	for _, c := range public_cases {
+		t.Run("public "+c.name, func(t *testing.T) {
+			if _, err := ParsePemToPub(c.pem); err == nil {
+				t.Error("ParsePemToPub must fail")
+			}
+		})
+	}
+
+	// the RSA routes refuse the other key types
+	if _, err := ParsePemToRSAPriv(pkcs8Pem(t, ec_key)); !errors.Is(err, erro.ErrDecodeKey) {
+		t.Errorf("ParsePemToRSAPriv of an EC key err = %v, want ErrDecodeKey", err)
+	}
+	if _, err := ParsePemToRSAPub(pkixPem(t, &ec_key.PublicKey)); !errors.Is(err, erro.ErrDecodeKey) {
+		t.Errorf("ParsePemToRSAPub of an EC key err = %v, want ErrDecodeKey", err)
+	}
+}
+
+func TestCheckKeyAlg(t *testing.T) {
+	signers := testSigners(t)
+
+	cases := []struct {
+		name	string
+		alg		string
+		key		crypto.PublicKey
+		wantErr	bool
+	}{
+		{ name: "RS256 with RSA", alg: "RS256", key: signers["RS256"].Public() },
+		{ name: "ES256 with P-256", alg: "ES256", key: signers["ES256"].Public() },
+		{ name: "ES384 with P-384", alg: "ES384", key: signers["ES384"].Public() },
+		{ name: "EdDSA with Ed25519", alg: "EdDSA", key: signers["EdDSA"].Public() },
+		{ name: "ES256 with P-384", alg: "ES256", key: signers["ES384"].Public(), wantErr: true },
+		{ name: "ES384 with P-256", alg: "ES384", key: signers["ES256"].Public(), wantErr: true },
+		{ name: "RS256 with EC", alg: "RS256", key: signers["ES256"].Public(), wantErr: true },
+		{ name: "EdDSA with RSA", alg: "EdDSA", key: signers["RS256"].Public(), wantErr: true },
+		{ name: "HS256 with RSA", alg: "HS256", key: signers["RS256"].Public(), wantErr: true },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := checkKeyAlg(c.alg, c.key); (err != nil) != c.wantErr {
+				t.Errorf("checkKeyAlg err = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestAsymmetricMethod(t *testing.T) {
+	cases := []struct {
+		alg		string
+		want	jwt.SigningMethod
+		wantErr	bool
+	}{
+		{ alg: "", want: jwt.SigningMethodRS256 },
+		{ alg: "RS256", want: jwt.SigningMethodRS256 },
+		{ alg: "ES256", want: jwt.SigningMethodES256 },
+		{ alg: "ES384", want: jwt.SigningMethodES384 },
+		{ alg: "EdDSA", want: jwt.SigningMethodEdDSA },
+		{ alg: "HS256", wantErr: true },
+		{ alg: "none", wantErr: true },
+		{ alg: "ES512", wantErr: true },
+	}
+
+	for _, c := range cases {
+		t.Run(c.alg, func(t *testing.T) {
+			method, err := AsymmetricMethod(c.alg)
+			if c.wantErr {
+				if !errors.Is(err, erro.ErrSigningAlg) {
+					t.Errorf("AsymmetricMethod(%s) err = %v, want ErrSigningAlg", c.alg, err)
+				}
+				return
+			}
+			if err != nil || method != c.want {
+				t.Errorf("AsymmetricMethod(%s) = %v (%v), want %s", c.alg, method, err, c.want.Alg())
+			}
+		})
+	}
+}
+
+// TestPublicToJwk checks the members of the EC and OKP jwks and the RFC 8037 thumbprint example
+func TestPublicToJwk(t *testing.T) {
+	signers := testSigners(t)
+
+	cases := []struct {
+		alg		string
+		kty		string
+		crv		string
+		size	int
+	}{
+		{ alg: "ES256", kty: "EC", crv: "P-256", size: 32 },
+		{ alg: "ES384", kty: "EC", crv: "P-384", size: 48 },
+		{ alg: "EdDSA", kty: "OKP", crv: "Ed25519", size: ed25519.PublicKeySize },
+	}
+
+	for _, c := range cases {
+		t.Run(c.alg, func(t *testing.T) {
+			jwk, err := PublicToJwk(signers[c.alg].Public(), "kid", c.alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if jwk.Kty != c.kty || jwk.Crv != c.crv || jwk.Use != "sig" || jwk.N != "" || jwk.E != "" {
+				t.Errorf("jwk = %+v, want kty %s crv %s", jwk, c.kty, c.crv)
+			}
+			x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+			if len(x) != c.size {
+				t.Errorf("x = %d bytes, want %d", len(x), c.size)
+			}
+			if c.kty == "OKP" && jwk.Y != "" {
+				t.Errorf("OKP jwk has y %s", jwk.Y)
+			}
+		})
+	}
+
+	// RFC 8037 appendix A.3
+	x, _ := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	thumbprint, err := Thumbprint(ed25519.PublicKey(x))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumbprint != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Errorf("Ed25519 thumbprint = %s, want the RFC 8037 example", thumbprint)
+	}
+
+	if _, err := PublicToJwk([]byte("not a key"), "kid", "HS256"); err == nil {
+		t.Error("PublicToJwk of a secret must fail")
+	}
+}
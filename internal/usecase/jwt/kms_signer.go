@@ -0,0 +1,160 @@
+package jwt
+
+import (
+	"io"
+	"fmt"
+	"time"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"math/big"
+	"encoding/asn1"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/lambda-go-autentication/pkg/aws_kms"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// time limit of a KMS Sign call, within the deadline of the request
+const kmsSignTimeout = 5 * time.Second
+
+// kmsSigningAlgorithms are the KMS algorithms of the token algs signed by KMS
+var kmsSigningAlgorithms = map[string]types.SigningAlgorithmSpec{
+	jwt.SigningMethodRS256.Alg(): types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+	jwt.SigningMethodES256.Alg(): types.SigningAlgorithmSpecEcdsaSha256,
+}
+
+// KMSSigner is a crypto.Signer whose private key never leaves KMS
+type KMSSigner struct {
+	clientKMS	*aws_kms.AwsClientKMS
+	keyId		string
+	algorithm	types.SigningAlgorithmSpec
+	public		crypto.PublicKey
+}
+
+func (s *KMSSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// signerOpts carries the request ctx to KMSSigner.Sign, crypto.Signer has no context
+type signerOpts struct {
+	crypto.Hash
+	ctx		context.Context
+}
+
+// Sign sends the SHA-256 digest to KMS, the signature of an EC key is ASN.1 DER (as crypto/ecdsa).
+// The call is canceled with the request (signerOpts), the other opts only get the timeout
+func (s *KMSSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("kms key %s: hash %v not supported", s.keyId, opts.HashFunc())
+	}
+
+	ctx := context.Background()
+	if requestOpts, ok := opts.(signerOpts); ok && requestOpts.ctx != nil {
+		ctx = requestOpts.ctx
+	}
+	ctx, cancel := context.WithTimeout(ctx, kmsSignTimeout)
+	defer cancel()
+
+	return s.clientKMS.Sign(ctx, s.keyId, digest, s.algorithm)
+}
+
+// NewKMSKey builds the active key of a KMS asymmetric key (RSA_* for RS256, ECC_NIST_P256 for ES256).
+// The public key (verification and JWKS) is read once with GetPublicKey, every signature is a KMS Sign
+func NewKMSKey(ctx context.Context, clientKMS *aws_kms.AwsClientKMS, keyId string) (*Key, error) {
+	childLogger.Debug().Msg("NewKMSKey")
+
+	public_der, signingAlgorithms, err := clientKMS.GetPublicKey(ctx, keyId)
+	if err != nil {
+		return nil, fmt.Errorf("kms key %s: get public key: %w", keyId, err)
+	}
+	public_key, err := x509.ParsePKIXPublicKey(public_der)
+	if err != nil {
+		return nil, fmt.Errorf("kms key %s: parse public key: %w", keyId, err)
+	}
+
+	alg, err := keyAlg(public_key)
+	if err != nil {
+		return nil, fmt.Errorf("kms key %s: %w", keyId, err)
+	}
+	algorithm, ok := kmsSigningAlgorithms[alg]
+	if !ok {
+		return nil, fmt.Errorf("kms key %s: alg %s not supported, RS256 (RSA key) or ES256 (ECC_NIST_P256 key) expected", keyId, alg)
+	}
+	accepted := false
+	for _, signingAlgorithm := range signingAlgorithms {
+		accepted = accepted || signingAlgorithm == algorithm
+	}
+	if !accepted {
+		return nil, fmt.Errorf("kms key %s: signing algorithm %s not allowed for the key (key usage SIGN_VERIFY expected)", keyId, algorithm)
+	}
+
+	kid, err := Thumbprint(public_key)
+	if err != nil {
+		return nil, fmt.Errorf("kms key %s: %w", keyId, err)
+	}
+
+	childLogger.Info().Str("key_id", keyId).Str("kid", kid).Str("alg", alg).Msg("kms key loaded")
+
+	return &Key{	Kid: kid,
+					Alg: alg,
+					State: KeyStateActive,
+					Private: &KMSSigner{ clientKMS: clientKMS, keyId: keyId, algorithm: algorithm, public: public_key },
+					Public: public_key }, nil
+}
+
+// externalSigner is a private key held outside the process (KMS), golang-jwt only signs with the crypto/* key types
+func externalSigner(private_key crypto.PrivateKey) bool {
+	switch private_key.(type) {
+		case nil, *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+			return false
+	}
+	_, ok := private_key.(crypto.Signer)
+	return ok
+}
+
+// signerMethod signs the RS256 and ES256 tokens with a crypto.Signer, the alg (header) and the verification are the standard ones
+type signerMethod struct {
+	jwt.SigningMethod
+	ctx		context.Context
+}
+
+func (m signerMethod) Sign(signingString string, key interface{}) (string, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	digest := sha256.Sum256([]byte(signingString))
+	signature, err := signer.Sign(rand.Reader, digest[:], signerOpts{ Hash: crypto.SHA256, ctx: m.ctx })
+	if err != nil {
+		return "", err
+	}
+
+	switch m.Alg() {
+		case jwt.SigningMethodRS256.Alg():
+		case jwt.SigningMethodES256.Alg():
+			// JWS uses the fixed size r || s instead of the DER sequence (RFC 7518 section 3.4)
+			var ecdsa_signature struct{ R, S *big.Int }
+			if _, err := asn1.Unmarshal(signature, &ecdsa_signature); err != nil {
+				return "", err
+			}
+			if ecdsa_signature.R.BitLen() > 256 || ecdsa_signature.S.BitLen() > 256 {
+				return "", fmt.Errorf("invalid ecdsa signature size")
+			}
+			signature = make([]byte, 64)
+			ecdsa_signature.R.FillBytes(signature[:32])
+			ecdsa_signature.S.FillBytes(signature[32:])
+		default:
+			return "", fmt.Errorf("alg %s not supported by the external signer", m.Alg())
+	}
+
+	return jwt.EncodeSegment(signature), nil
+}
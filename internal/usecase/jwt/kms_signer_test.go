@@ -0,0 +1,191 @@
+package jwt
+
+import (
+	"io"
+	"time"
+	"context"
+	"testing"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"math/big"
+	"encoding/asn1"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/lambda-go-autentication/pkg/aws_kms"
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+type testCtxKey struct{}
+
+func newFakeKMSKey(t *testing.T, private_key crypto.Signer) (*Key, *aws_kms.FakeKMS) {
+	t.Helper()
+
+	fakeKMS := aws_kms.NewFakeKMS()
+	fakeKMS.AddKey("alias/auth-signing", private_key)
+
+	key, err := NewKMSKey(context.Background(), &aws_kms.AwsClientKMS{ Client: fakeKMS }, "alias/auth-signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, fakeKMS
+}
+
+func TestKMSSigner(t *testing.T) {
+	rsa_key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsa_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name		string
+		private_key	crypto.Signer
+		method		jwt.SigningMethod
+	}{
+		{ name: "RS256", private_key: rsa_key, method: jwt.SigningMethodRS256 },
+		{ name: "ES256", private_key: ecdsa_key, method: jwt.SigningMethodES256 },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			key, fakeKMS := newFakeKMSKey(t, c.private_key)
+			if key.Alg != c.method.Alg() || !externalSigner(key.Private) {
+				t.Fatalf("kms key alg = %s, external signer = %v", key.Alg, externalSigner(key.Private))
+			}
+
+			keyring := NewKeyring()
+			if err := keyring.Add(key); err != nil {
+				t.Fatal(err)
+			}
+			useCaseJwt := NewUseCaseJwt(keyring)
+
+			ctx := context.WithValue(context.Background(), testCtxKey{}, "request")
+			tokenString, err := useCaseJwt.signToken(ctx, c.method, testClaims(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the token verifies with the public key of GetPublicKey, with the standard method
+			claims := &model.JwtData{}
+			tkn, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+				return key.Public, nil
+			}, jwt.WithValidMethods([]string{c.method.Alg()}))
+			if err != nil || !tkn.Valid {
+				t.Fatalf("verify error = %v", err)
+			}
+			if tkn.Header["kid"] != key.Kid {
+				t.Errorf("kid = %v, want %s", tkn.Header["kid"], key.Kid)
+			}
+
+			// the request ctx reaches the KMS call
+			signContexts := fakeKMS.SignContexts()
+			if len(signContexts) != 1 || signContexts[0].Value(testCtxKey{}) != "request" {
+				t.Errorf("the KMS Sign did not get the request ctx")
+			}
+		})
+	}
+}
+
+func TestKMSSignerCanceledRequest(t *testing.T) {
+	ecdsa_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := newFakeKMSKey(t, ecdsa_key)
+	keyring := NewKeyring()
+	if err := keyring.Add(key); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewUseCaseJwt(keyring).signToken(ctx, jwt.SigningMethodES256, testClaims(time.Hour)); err == nil {
+		t.Error("signToken with a canceled request must fail")
+	}
+}
+
+// fixedSigner returns the same DER signature, it checks the ASN.1 to R || S conversion of signerMethod
+type fixedSigner struct {
+	public		crypto.PublicKey
+	signature	[]byte
+}
+
+func (s fixedSigner) Public() crypto.PublicKey { return s.public }
+
+func (s fixedSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signature, nil
+}
+
+func TestSignerMethodES256Signature(t *testing.T) {
+	ecdsa_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("header.payload"))
+	r, s, err := ecdsa.Sign(rand.Reader, ecdsa_key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(struct{ R, S *big.Int }{ r, s })
+	if err != nil {
+		t.Fatal(err)
+	}
+	short_der, _ := asn1.Marshal(struct{ R, S *big.Int }{ big.NewInt(1), big.NewInt(2) })
+	long_der, _ := asn1.Marshal(struct{ R, S *big.Int }{ new(big.Int).Lsh(big.NewInt(1), 300), big.NewInt(2) })
+
+	short_want := make([]byte, 64)
+	short_want[31], short_want[63] = 1, 2
+	want := make([]byte, 64)
+	r.FillBytes(want[:32])
+	s.FillBytes(want[32:])
+
+	cases := []struct {
+		name		string
+		signature	[]byte
+		want		[]byte
+		wantErr		bool
+	}{
+		{ name: "der signature to r || s", signature: der, want: want },
+		{ name: "short r and s are left padded", signature: short_der, want: short_want },
+		{ name: "r over 256 bits", signature: long_der, wantErr: true },
+		{ name: "not a der sequence", signature: []byte{0x01, 0x02}, wantErr: true },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			method := signerMethod{ SigningMethod: jwt.SigningMethodES256, ctx: context.Background() }
+			segment, err := method.Sign("header.payload", fixedSigner{ public: &ecdsa_key.PublicKey, signature: c.signature })
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("Sign must fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := jwt.DecodeSegment(segment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(c.want) {
+				t.Errorf("signature = %x, want %x", got, c.want)
+			}
+		})
+	}
+
+	// the converted signature verifies with the standard ES256
+	method := signerMethod{ SigningMethod: jwt.SigningMethodES256, ctx: context.Background() }
+	segment, _ := method.Sign("header.payload", fixedSigner{ public: &ecdsa_key.PublicKey, signature: der })
+	if err := jwt.SigningMethodES256.Verify("header.payload", segment, &ecdsa_key.PublicKey); err != nil {
+		t.Errorf("ES256 Verify error = %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package jwt
+
+import (
+	"time"
+	"context"
+	"crypto"
+	"encoding/base64"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/lambda-go-autentication/pkg/observability"
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+// ScopeOpenID requested on login issues an OpenID Connect id token alongside the access token
+const ScopeOpenID = "openid"
+
+func requestsOpenID(scopes []string) bool {
+	for _, scope := range scopes {
+		if scope == ScopeOpenID {
+			return true
+		}
+	}
+	return false
+}
+
+// accessScopes adds the openid scope to the granted scopes, it allows the access token on /userinfo
+func accessScopes(granted []string, requested []string) []string {
+	if !requestsOpenID(requested) || requestsOpenID(granted) {
+		return granted
+	}
+	return append(append([]string{}, granted...), ScopeOpenID)
+}
+
+// atHash is the left half of the access token hash, the hash is the one of the signing alg (OIDC core 3.1.3.6)
+func atHash(method jwt.SigningMethod, accessToken string) string {
+	hash := crypto.SHA256
+	switch method.Alg() {
+		case jwt.SigningMethodES384.Alg():
+			hash = crypto.SHA384
+		case jwt.SigningMethodEdDSA.Alg():
+			hash = crypto.SHA512
+	}
+
+	hasher := hash.New()
+	hasher.Write([]byte(accessToken))
+	sum := hasher.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// idToken signs an id token with the same asymmetric algorithm (and key) of the access token, the aud is the audience
+// of the request (the client), the sub is the user. The clients verify it with the JWKS, never with the HMAC secret
+func (u *UseCaseJwt) idToken(ctx context.Context,
+							method jwt.SigningMethod,
+							credential model.Credential,
+							accessToken string,
+							expirationTime time.Time) (string, error){
+	childLogger.Debug().Msg("idToken")
+
+	if _, err := AsymmetricMethod(method.Alg()); err != nil {
+		return "", erro.ErrOpenIDAsymmetric
+	}
+
+	now := time.Now()
+	idTokenData := &model.IDTokenData{
+								Nonce: credential.Nonce,
+								AuthTime: now.Unix(),
+								AtHash: atHash(method, accessToken),
+								PreferredUsername: credential.User,
+								RegisteredClaims: jwt.RegisteredClaims{
+									Issuer: credential.Issuer,
+									Subject: credential.User,
+									Audience: u.tokenAudience(credential),
+									IssuedAt: jwt.NewNumericDate(now),
+									ExpiresAt: jwt.NewNumericDate(expirationTime),
+								},
+	}
+
+	return u.signToken(ctx, method, idTokenData)
+}
+
+// IDTokenSigningAlgs returns the asymmetric algorithms with an active key, the only ones an id token is signed with
+func (u *UseCaseJwt) IDTokenSigningAlgs() []string {
+	algs := []string{}
+	for _, method := range asymmetricMethods {
+		if _, err := u.keyring.Signing(method.Alg()); err == nil {
+			algs = append(algs, method.Alg())
+		}
+	}
+	return algs
+}
+
+// ParseAccessToken validates an access token signed with any algorithm of the keyring, the token must be
+// issued for the service audience or one of the allowed audiences and not revoked
+func (u *UseCaseJwt) ParseAccessToken(ctx context.Context, bearerToken string) (*model.JwtData, error){
+	childLogger.Debug().Msg("ParseAccessToken")
+
+	ctx, span := observability.Span(ctx, "useCase.ParseAccessToken")
+    defer span.End()
+
+	claims, _, err := u.parseToken(ctx, bearerToken, append([]jwt.SigningMethod{jwt.SigningMethodHS256}, asymmetricMethods...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// id tokens and other tokens signed by the service are not access tokens
+	if claims.TokenUse != "access" && claims.TokenUse != "access-rsa" {
+		return nil, erro.ErrStatusUnauthorized
+	}
+
+	if err := u.checkAccessAudience(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// checkAccessAudience accepts the service audience and the allowed audiences
+func (u *UseCaseJwt) checkAccessAudience(claims *model.JwtData) error {
+	if CheckAudience(claims, u.serviceAudience) == nil {
+		return nil
+	}
+	for _, audience := range u.allowedAudiences {
+		if CheckAudience(claims, audience) == nil {
+			return nil
+		}
+	}
+	return erro.ErrAudienceMismatch
+}
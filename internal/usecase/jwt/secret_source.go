@@ -0,0 +1,96 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/lambda-go-autentication/pkg/aws_secret_manager"
+)
+
+// minimum interval between two reloads caused by unknown kids, a token with a forged kid must not flood Secrets Manager
+const secretUnknownKidInterval = 30 * time.Second
+
+// SecretKeySource keeps the HS256 keys of the SECRET_JWT_KEY versions in the keyring.
+// The versions are reloaded each ttl and when a token is signed by a version not loaded yet,
+// so a rotation is seen without a redeploy: AWSCURRENT signs, AWSPREVIOUS still verifies
+type SecretKeySource struct {
+	*keyReloader
+	clientSecret	*aws_secret_manager.AwsClientSecretManager
+	secretName		string
+	versions		bool	// list every version (AWSPENDING included) instead of reading AWSCURRENT and AWSPREVIOUS
+}
+
+func NewSecretKeySource(keyring *Keyring,
+						clientSecret *aws_secret_manager.AwsClientSecretManager,
+						secretName string,
+						versions bool,
+						ttl time.Duration) *SecretKeySource {
+	childLogger.Debug().Msg("NewSecretKeySource")
+
+	s := &SecretKeySource{
+		clientSecret: clientSecret,
+		secretName: secretName,
+		versions: versions,
+	}
+	s.keyReloader = newKeyReloader(keyring, "secretsmanager:" + secretName, ttl, secretUnknownKidInterval, symmetricAlg, s.keys)
+	return s
+}
+
+func symmetricAlg(alg string) bool {
+	return alg == jwt.SigningMethodHS256.Alg()
+}
+
+// keys reads the versions of the secret
+func (s *SecretKeySource) keys(ctx context.Context) ([]*Key, error) {
+	if s.versions {
+		return s.secretKeys(ctx)
+	}
+	return s.stageKeys(ctx)
+}
+
+// secretKeys reads the versions with a staging label (ListSecretVersionIds permission)
+func (s *SecretKeySource) secretKeys(ctx context.Context) ([]*Key, error) {
+	versions, err := s.clientSecret.ListSecretVersions(ctx, s.secretName)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []*Key{}
+	for _, version := range versions {
+		if secretStageToState(version.VersionStages) == KeyStateRetired {
+			continue
+		}
+		secretVersion, err := s.clientSecret.GetSecretVersion(ctx, s.secretName, version.VersionId, "")
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, KeyFromSecret(secretVersion))
+	}
+	return keys, nil
+}
+
+// stageKeys reads AWSCURRENT and, when it exists, AWSPREVIOUS (only GetSecretValue permission)
+func (s *SecretKeySource) stageKeys(ctx context.Context) ([]*Key, error) {
+	current, err := s.clientSecret.GetSecretVersion(ctx, s.secretName, "", "AWSCURRENT")
+	if err != nil {
+		return nil, err
+	}
+	keys := []*Key{KeyFromSecret(current)}
+
+	previous, err := s.clientSecret.GetSecretVersion(ctx, s.secretName, "", "AWSPREVIOUS")
+	if errors.Is(err, aws_secret_manager.ErrVersionNotFound) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if previous.VersionId != current.VersionId {
+		key := KeyFromSecret(previous)
+		key.State = KeyStateRetiring
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
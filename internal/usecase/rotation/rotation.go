@@ -0,0 +1,223 @@
+package rotation
+
+import(
+	"context"
+	"errors"
+	"crypto/rand"
+	"encoding/base64"
+
+	"github.com/rs/zerolog/log"
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/lambda-go-autentication/pkg/observability"
+	"github.com/lambda-go-autentication/pkg/aws_secret_manager"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/usecase/jwt"
+	"github.com/lambda-go-autentication/internal/usecase/audit"
+)
+
+var childLogger = log.With().Str("usecase", "rotation").Logger()
+
+// size in bytes of the generated HS256 keys (512 bits, above the 256 bits of the hash)
+const secretKeySize = 64
+
+// the HS256 keys shorter than this are refused by testSecret
+const secretKeyMinSize = 32
+
+// rotation steps of the Secrets Manager protocol
+const (
+	StepCreateSecret	= "createSecret"
+	StepSetSecret		= "setSecret"
+	StepTestSecret		= "testSecret"
+	StepFinishSecret	= "finishSecret"
+)
+
+// UseCaseRotation rotates the HS256 key (SECRET_JWT_KEY): createSecret stores a random key as AWSPENDING,
+// testSecret signs and verifies a token with it and finishSecret moves AWSCURRENT to it.
+// The service reloads the versions (SECRET_JWT_KEY_TTL), the tokens of the old key stay valid as AWSPREVIOUS
+type UseCaseRotation struct{
+	clientSecret	*aws_secret_manager.AwsClientSecretManager
+	secretName		string
+	audit			*audit.UseCaseAudit
+}
+
+// the actor of the key rotation events
+const rotationActor = "secretsmanager.rotation"
+
+func NewUseCaseRotation(	clientSecret *aws_secret_manager.AwsClientSecretManager,
+							secretName string,
+							useCaseAudit *audit.UseCaseAudit) *UseCaseRotation{
+	childLogger.Debug().Msg("NewUseCaseRotation")
+
+	return &UseCaseRotation{
+		clientSecret: clientSecret,
+		secretName: secretName,
+		audit: useCaseAudit,
+	}
+}
+
+// Rotate runs a step of the rotation, a step may be retried by Secrets Manager so each one is idempotent
+func (u *UseCaseRotation) Rotate(ctx context.Context, event events.SecretsManagerSecretRotationEvent) (err error){
+	childLogger.Debug().Msg("Rotate")
+
+	ctx, span := observability.Span(ctx, "usecase.Rotate")
+	defer span.End()
+	defer func() { observability.SpanError(span, err) }()
+
+	// a failed step is audited, the success only by finishSecret (the key in use changed)
+	defer func() {
+		if err != nil {
+			u.audit.Record(ctx, model.AuditEvent{	EventType: audit.EventKeyRotation,
+													Actor: rotationActor,
+													Subject: u.secretName,
+													Detail: map[string]string{"step": event.Step, "version": event.ClientRequestToken} }, err)
+		}
+	}()
+
+	childLogger.Info().Str("step", event.Step).Str("version", event.ClientRequestToken).Msg("rotation")
+
+	description, err := u.clientSecret.DescribeSecret(ctx, event.SecretID)
+	if err != nil {
+		return err
+	}
+	if description.Name != u.secretName && description.ARN != u.secretName {
+		return errors.New("secret " + event.SecretID + " is not the SECRET_JWT_KEY " + u.secretName)
+	}
+	if !description.RotationEnabled {
+		return errors.New("secret " + description.Name + " is not enabled for rotation")
+	}
+
+	stages, ok := description.VersionStages[event.ClientRequestToken]
+	if !ok {
+		return errors.New("version " + event.ClientRequestToken + " has no stage for rotation of secret " + description.Name)
+	}
+	if hasStage(stages, "AWSCURRENT") {
+		childLogger.Info().Str("version", event.ClientRequestToken).Msg("version already AWSCURRENT")
+		return nil
+	}
+	if !hasStage(stages, "AWSPENDING") {
+		return errors.New("version " + event.ClientRequestToken + " not AWSPENDING for rotation of secret " + description.Name)
+	}
+
+	switch event.Step {
+		case StepCreateSecret:
+			return u.createSecret(ctx, event.ClientRequestToken)
+		case StepSetSecret:
+			// the key is only used by this service, there is no downstream system to update
+			return nil
+		case StepTestSecret:
+			return u.testSecret(ctx, event.ClientRequestToken)
+		case StepFinishSecret:
+			return u.finishSecret(ctx, description, event.ClientRequestToken)
+		default:
+			return errors.New("invalid rotation step " + event.Step)
+	}
+}
+
+// createSecret stores a new random key as the AWSPENDING version, unless the version already has a value
+func (u *UseCaseRotation) createSecret(ctx context.Context, versionId string) error{
+	childLogger.Debug().Msg("createSecret")
+
+	// the current version must exist, the rotation does not create the secret
+	if _, err := u.clientSecret.GetSecretVersion(ctx, u.secretName, "", "AWSCURRENT"); err != nil {
+		return err
+	}
+
+	_, err := u.clientSecret.GetSecretVersion(ctx, u.secretName, versionId, "")
+	if err == nil {
+		childLogger.Info().Str("version", versionId).Msg("pending version already created")
+		return nil
+	}
+	if !errors.Is(err, aws_secret_manager.ErrVersionNotFound) {
+		return err
+	}
+
+	secret_key, err := newSecretKey()
+	if err != nil {
+		return err
+	}
+	if err := u.clientSecret.PutSecretVersion(ctx, u.secretName, versionId, secret_key, "AWSPENDING"); err != nil {
+		return err
+	}
+
+	childLogger.Info().Str("version", versionId).Msg("pending version created")
+	return nil
+}
+
+// testSecret signs a token with the pending key and verifies it, as the service does after finishSecret
+func (u *UseCaseRotation) testSecret(ctx context.Context, versionId string) error{
+	childLogger.Debug().Msg("testSecret")
+
+	secretVersion, err := u.clientSecret.GetSecretVersion(ctx, u.secretName, versionId, "")
+	if err != nil {
+		return err
+	}
+	if len(*secretVersion.SecretString) < secretKeyMinSize {
+		return errors.New("pending version " + versionId + " is shorter than the minimum key size")
+	}
+
+	// the pending key is activated as the service does after finishSecret (AWSPENDING to AWSCURRENT)
+	key := jwt.KeyFromSecret(secretVersion)
+	keyring := jwt.NewKeyring()
+	if err := keyring.Add(key); err != nil {
+		return err
+	}
+	if err := keyring.SetState(key.Kid, jwt.KeyStateActive); err != nil {
+		return err
+	}
+	useCaseJwt := jwt.NewUseCaseJwt(keyring)
+
+	auth, err := useCaseJwt.OAUTHToken(ctx, model.Credential{User: "rotation-test"}, model.CredentialScope{})
+	if err != nil {
+		return err
+	}
+	if _, err := useCaseJwt.TokenValidation(ctx, auth.Token, ""); err != nil {
+		return errors.New("token signed with pending version " + versionId + " not verified: " + err.Error())
+	}
+
+	childLogger.Info().Str("version", versionId).Msg("pending version tested")
+	return nil
+}
+
+// finishSecret moves AWSCURRENT to the pending version, Secrets Manager moves AWSPREVIOUS to the old one
+func (u *UseCaseRotation) finishSecret(ctx context.Context, description *aws_secret_manager.SecretDescription, versionId string) error{
+	childLogger.Debug().Msg("finishSecret")
+
+	current := ""
+	for version, stages := range description.VersionStages {
+		if hasStage(stages, "AWSCURRENT") {
+			current = version
+			break
+		}
+	}
+
+	if err := u.clientSecret.UpdateSecretVersionStage(ctx, u.secretName, "AWSCURRENT", versionId, current); err != nil {
+		return err
+	}
+
+	u.audit.Record(ctx, model.AuditEvent{	EventType: audit.EventKeyRotation,
+											Actor: rotationActor,
+											Subject: u.secretName,
+											Detail: map[string]string{"step": StepFinishSecret, "version": versionId, "previous": current} }, nil)
+
+	childLogger.Info().Str("version", versionId).Str("previous", current).Msg("version moved to AWSCURRENT")
+	return nil
+}
+
+func hasStage(stages []string, stage string) bool {
+	for _, s := range stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// newSecretKey returns a random key from crypto/rand, base64 url encoded
+func newSecretKey() (string, error) {
+	key := make([]byte, secretKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key), nil
+}
@@ -0,0 +1,301 @@
+package rotation_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/smithy-go/middleware"
+
+	"github.com/lambda-go-autentication/pkg/aws_secret_manager"
+	"github.com/lambda-go-autentication/internal/usecase/audit"
+	"github.com/lambda-go-autentication/internal/usecase/audit/sink"
+	"github.com/lambda-go-autentication/internal/usecase/rotation"
+)
+
+const testSecretName = "key-jwt-auth"
+
+// fakeSecret is the state of a secret in the fake Secrets Manager, the staging labels and values by version id
+type fakeSecret struct {
+	rotationEnabled	bool
+	stages			map[string][]string
+	values			map[string]string
+}
+
+// newFakeClient returns a Secrets Manager client whose calls are answered from the secret by a middleware
+func newFakeClient(secret *fakeSecret) *aws_secret_manager.AwsClientSecretManager {
+	answer := func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("answer",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				result, err := secret.answer(in.Parameters)
+				return middleware.InitializeOutput{ Result: result }, middleware.Metadata{}, err
+			}), middleware.After)
+	}
+	client := secretsmanager.New(secretsmanager.Options{ Region: "us-east-1",
+														 Credentials: aws.AnonymousCredentials{},
+														 APIOptions: []func(*middleware.Stack) error{answer} })
+	return &aws_secret_manager.AwsClientSecretManager{ Client: client }
+}
+
+func (s *fakeSecret) answer(parameters interface{}) (interface{}, error) {
+	switch input := parameters.(type) {
+		case *secretsmanager.DescribeSecretInput:
+			return &secretsmanager.DescribeSecretOutput{ ARN: aws.String("arn:aws:secretsmanager:us-east-1:000000000000:secret:" + testSecretName),
+														 Name: aws.String(testSecretName),
+														 RotationEnabled: aws.Bool(s.rotationEnabled),
+														 VersionIdsToStages: s.stages }, nil
+		case *secretsmanager.GetSecretValueInput:
+			versionId := aws.ToString(input.VersionId)
+			if versionId == "" {
+				versionId = s.versionOf(aws.ToString(input.VersionStage))
+			}
+			value, ok := s.values[versionId]
+			if !ok {
+				return nil, &types.ResourceNotFoundException{ Message: aws.String("version not found") }
+			}
+			return &secretsmanager.GetSecretValueOutput{ Name: aws.String(testSecretName),
+														 VersionId: aws.String(versionId),
+														 VersionStages: s.stages[versionId],
+														 SecretString: aws.String(value) }, nil
+		case *secretsmanager.PutSecretValueInput:
+			versionId := aws.ToString(input.ClientRequestToken)
+			s.values[versionId] = aws.ToString(input.SecretString)
+			s.stages[versionId] = input.VersionStages
+			return &secretsmanager.PutSecretValueOutput{ VersionId: aws.String(versionId) }, nil
+		case *secretsmanager.UpdateSecretVersionStageInput:
+			stage := aws.ToString(input.VersionStage)
+			if from := aws.ToString(input.RemoveFromVersionId); from != "" {
+				s.stages[from] = removeStage(s.stages[from], stage)
+				// as Secrets Manager, the version that loses AWSCURRENT becomes AWSPREVIOUS
+				if stage == "AWSCURRENT" {
+					s.stages[from] = append(s.stages[from], "AWSPREVIOUS")
+				}
+			}
+			to := aws.ToString(input.MoveToVersionId)
+			s.stages[to] = append(s.stages[to], stage)
+			return &secretsmanager.UpdateSecretVersionStageOutput{}, nil
+	}
+	return nil, nil
+}
+
+func (s *fakeSecret) versionOf(stage string) string {
+	for versionId, stages := range s.stages {
+		for _, st := range stages {
+			if st == stage {
+				return versionId
+			}
+		}
+	}
+	return ""
+}
+
+func removeStage(stages []string, stage string) []string {
+	kept := []string{}
+	for _, s := range stages {
+		if s != stage {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+func hasStage(stages []string, stage string) bool {
+	for _, s := range stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	currentValue	= "current-key-0123456789-0123456789-0123456789"
+	pendingValue	= "pending-key-0123456789-0123456789-0123456789"
+)
+
+// newSecret returns a secret with the AWSCURRENT version v1 and the version v2 of the rotation as AWSPENDING
+func newSecret() *fakeSecret {
+	return &fakeSecret{	rotationEnabled: true,
+						stages: map[string][]string{ "v1": {"AWSCURRENT"}, "v2": {"AWSPENDING"} },
+						values: map[string]string{ "v1": currentValue } }
+}
+
+func TestRotate(t *testing.T) {
+	cases := []struct {
+		name	string
+		secret	func() *fakeSecret
+		event	events.SecretsManagerSecretRotationEvent
+		wantErr	bool
+		check	func(t *testing.T, secret *fakeSecret)
+	}{
+		{	name: "createSecret stores a random pending key",
+			secret: newSecret,
+			event: events.SecretsManagerSecretRotationEvent{ Step: rotation.StepCreateSecret, SecretID: testSecretName, ClientRequestToken: "v2" },
+			check: func(t *testing.T, secret *fakeSecret) {
+				if len(secret.values["v2"]) < 32 || secret.values["v2"] == currentValue {
+					t.Errorf("pending value = %q, want a new key of at least 32 chars", secret.values["v2"])
+				}
+				if !hasStage(secret.stages["v2"], "AWSPENDING") {
+					t.Errorf("v2 stages = %v, want AWSPENDING", secret.stages["v2"])
+				}
+			} },
+		{	name: "createSecret keeps the pending key of a retried step",
+			secret: func() *fakeSecret {
+				secret := newSecret()
+				secret.values["v2"] = pendingValue
+				return secret
+			},
+			event: events.SecretsManagerSecretRotationEvent{ Step: rotation.StepCreateSecret, SecretID: testSecretName, ClientRequestToken: "v2" },
+			check: func(t *testing.T, secret *fakeSecret) {
+				if secret.values["v2"] != pendingValue {
+					t.Errorf("pending value = %q, want it unchanged", secret.values["v2"])
+				}
+			} },
+		{	name: "createSecret without current version",
+			secret: func() *fakeSecret {
+				secret := newSecret()
+				delete(secret.values, "v1")
+				return secret
+			},
+			event: events.SecretsManagerSecretRotationEvent{ Step: rotation.StepCreateSecret, SecretID: testSecretName, ClientRequestToken: "v2" },
+			wantErr: true },
+		{	name: "setSecret is a no-op",
+			secret: newSecret,
+			event: events.SecretsManagerSecretRotationEvent{ Step: rotation.StepSetSecret, SecretID: testSecretName, ClientRequestToken: "v2" } },
+		{	name: "testSecret signs and verifies with the pending key",
+			secret: func() *fakeSecret {
+				secret := newSecret()
+				secret.values["v2"] = pendingValue
+				return secret
+			},
+			event: events.SecretsManagerSecretRotationEvent{ Step: rotation.StepTestSecret, SecretID: testSecretName, ClientRequestToken: "v2" } },
+		{	name: "testSecret refuses a short key",
+			secret: func() *fakeSecret {
+				secret := newSecret()
+				secret.values["v2"] = "short"
+				return secret
+			},
+			event: events.SecretsManagerSecretRotationEvent{ Step: rotation.StepTestSecret, SecretID: testSecretName, ClientRequestToken: "v2" },
+			wantErr: true },
+		{	name: "finishSecret moves AWSCURRENT to the pending version",
+			secret: func() *fakeSecret {
+				secret := newSecret()
+				secret.values["v2"] = pendingValue
+				return secret
+			},
+			event: events.SecretsManagerSecretRotationEvent{ Step: rotation.StepFinishSecret, SecretID: testSecretName, ClientRequestToken: "v2" },
+			check: func(t *testing.T, secret *fakeSecret) {
+				if !hasStage(secret.stages["v2"], "AWSCURRENT") {
+					t.Errorf("v2 stages = %v, want AWSCURRENT", secret.stages["v2"])
+				}
+				if hasStage(secret.stages["v1"], "AWSCURRENT") || !hasStage(secret.stages["v1"], "AWSPREVIOUS") {
+					t.Errorf("v1 stages = %v, want AWSPREVIOUS", secret.stages["v1"])
+				}
+			} },
+		{	name: "version already AWSCURRENT is a no-op",
+			secret: newSecret,
+			event: events.SecretsManagerSecretRotationEvent{ Step: rotation.StepFinishSecret, SecretID: testSecretName, ClientRequestToken: "v1" },
+			check: func(t *testing.T, secret *fakeSecret) {
+				if !hasStage(secret.stages["v1"], "AWSCURRENT") || hasStage(secret.stages["v2"], "AWSCURRENT") {
+					t.Errorf("stages = %v, want them unchanged", secret.stages)
+				}
+			} },
+		{	name: "version without stage",
+			secret: newSecret,
+			event: events.SecretsManagerSecretRotationEvent{ Step: rotation.StepCreateSecret, SecretID: testSecretName, ClientRequestToken: "v3" },
+			wantErr: true },
+		{	name: "version not AWSPENDING",
+			secret: func() *fakeSecret {
+				secret := newSecret()
+				secret.stages["v2"] = []string{"AWSPREVIOUS"}
+				return secret
+			},
+			event: events.SecretsManagerSecretRotationEvent{ Step: rotation.StepCreateSecret, SecretID: testSecretName, ClientRequestToken: "v2" },
+			wantErr: true },
+		{	name: "rotation not enabled",
+			secret: func() *fakeSecret {
+				secret := newSecret()
+				secret.rotationEnabled = false
+				return secret
+			},
+			event: events.SecretsManagerSecretRotationEvent{ Step: rotation.StepCreateSecret, SecretID: testSecretName, ClientRequestToken: "v2" },
+			wantErr: true },
+		{	name: "invalid step",
+			secret: newSecret,
+			event: events.SecretsManagerSecretRotationEvent{ Step: "deleteSecret", SecretID: testSecretName, ClientRequestToken: "v2" },
+			wantErr: true },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			secret := c.secret()
+			useCaseRotation := rotation.NewUseCaseRotation(newFakeClient(secret), testSecretName, audit.NewUseCaseAudit())
+
+			err := useCaseRotation.Rotate(context.Background(), c.event)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("Rotate(%s) err = %v, wantErr %v", c.event.Step, err, c.wantErr)
+			}
+			if c.check != nil {
+				c.check(t, secret)
+			}
+		})
+	}
+}
+
+// TestRotateOtherSecret checks a rotation event of another secret is refused, SECRET_JWT_KEY is matched by name or ARN
+func TestRotateOtherSecret(t *testing.T) {
+	cases := []struct {
+		name		string
+		secretName	string
+		wantErr		bool
+	}{
+		{ name: "name", secretName: testSecretName },
+		{ name: "arn", secretName: "arn:aws:secretsmanager:us-east-1:000000000000:secret:" + testSecretName },
+		{ name: "other secret", secretName: "other-secret", wantErr: true },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			useCaseRotation := rotation.NewUseCaseRotation(newFakeClient(newSecret()), c.secretName, audit.NewUseCaseAudit())
+
+			err := useCaseRotation.Rotate(context.Background(), events.SecretsManagerSecretRotationEvent{ Step: rotation.StepSetSecret, SecretID: c.secretName, ClientRequestToken: "v2" })
+			if (err != nil) != c.wantErr {
+				t.Errorf("Rotate err = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+// TestRotateAudit checks finishSecret and a failed step are audited for the secret
+func TestRotateAudit(t *testing.T) {
+	secret := newSecret()
+	secret.values["v2"] = pendingValue
+	memorySink := sink.NewMemorySink(10, 10)
+	useCaseRotation := rotation.NewUseCaseRotation(newFakeClient(secret), testSecretName, audit.NewUseCaseAudit(memorySink))
+
+	ctx := context.Background()
+	if err := useCaseRotation.Rotate(ctx, events.SecretsManagerSecretRotationEvent{ Step: rotation.StepFinishSecret, SecretID: testSecretName, ClientRequestToken: "v2" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := useCaseRotation.Rotate(ctx, events.SecretsManagerSecretRotationEvent{ Step: rotation.StepCreateSecret, SecretID: testSecretName, ClientRequestToken: "v3" }); err == nil {
+		t.Fatal("Rotate of a version without stage succeeded")
+	}
+
+	auditEvents, err := memorySink.QueryEvents(ctx, testSecretName, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(auditEvents) != 2 {
+		t.Fatalf("audit events = %d, want 2", len(auditEvents))
+	}
+	// the newest first
+	wantOutcomes := []string{audit.OutcomeFailure, audit.OutcomeSuccess}
+	for i, event := range auditEvents {
+		if event.EventType != audit.EventKeyRotation || event.Outcome != wantOutcomes[i] {
+			t.Errorf("audit event %d = %s %s, want %s %s", i, event.EventType, event.Outcome, audit.EventKeyRotation, wantOutcomes[i])
+		}
+	}
+}
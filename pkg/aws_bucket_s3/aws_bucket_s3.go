@@ -49,4 +49,28 @@ func (p *AwsClientBucketS3) GetObject(	ctx context.Context,
 
 	res := string(bodyBytes)
 	return &res, nil
-}
\ No newline at end of file
+}
+func (p *AwsClientBucketS3) ListObjectKeys(	ctx context.Context, 	
+											bucketNameKey 	string,
+											prefix 			string) ([]string, error) {
+	childLogger.Debug().Msg("ListObjectKeys")
+
+	listObjectsInput := &s3.ListObjectsV2Input{
+						Bucket: aws.String(bucketNameKey),
+						Prefix: aws.String(prefix),
+	}
+
+	keys := []string{}
+	paginator := s3.NewListObjectsV2Paginator(p.Client, listObjectsInput)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, aws.ToString(object.Key))
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,77 @@
+package aws_kms
+
+import (
+	"context"
+	
+	"github.com/rs/zerolog/log"
+	"github.com/lambda-go-autentication/pkg/observability"
+	
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+var childLogger = log.With().Str("pkg", "aws_kms").Logger()
+
+// KMSAPI is the part of the KMS client used, implemented by *kms.Client and by FakeKMS (in memory) in the tests
+type KMSAPI interface {
+	Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+	GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+}
+
+type AwsClientKMS struct {
+	Client KMSAPI
+}
+
+// NewClientKMS creates the client, the endpoint (optional) points to a local KMS (local-kms, localstack)
+func NewClientKMS(configAWS *aws.Config, endpoint string) (*AwsClientKMS) {
+	childLogger.Debug().Msg("NewClientKMS")
+
+	client := kms.NewFromConfig(*configAWS, func(o *kms.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	return &AwsClientKMS{
+		Client: client,
+	}
+}
+
+// GetPublicKey returns the DER (PKIX) public key and the signing algorithms accepted by the key
+func (p *AwsClientKMS) GetPublicKey(ctx context.Context, keyId string) ([]byte, []types.SigningAlgorithmSpec, error) {
+	childLogger.Debug().Msg("GetPublicKey")
+
+	ctx, span := observability.Span(ctx, "aws_kms.GetPublicKey")	
+    defer span.End()
+
+	result, err := p.Client.GetPublicKey(ctx, 
+		&kms.GetPublicKeyInput{
+			KeyId:	aws.String(keyId),
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result.PublicKey, result.SigningAlgorithms, nil
+}
+
+// Sign signs the digest (already hashed) inside KMS
+func (p *AwsClientKMS) Sign(ctx context.Context, keyId string, digest []byte, algorithm types.SigningAlgorithmSpec) ([]byte, error) {
+	childLogger.Debug().Msg("Sign")
+
+	ctx, span := observability.Span(ctx, "aws_kms.Sign")	
+    defer span.End()
+
+	result, err := p.Client.Sign(ctx, 
+		&kms.SignInput{
+			KeyId:				aws.String(keyId),
+			Message:			digest,
+			MessageType:		types.MessageTypeDigest,
+			SigningAlgorithm:	algorithm,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Signature, nil
+}
@@ -0,0 +1,126 @@
+package aws_kms
+
+import (
+	"fmt"
+	"sync"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/ecdsa"
+	"crypto/x509"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// FakeKMS is an in memory KMSAPI for the tests, each key id is backed by a local rsa or ecdsa (P-256) key.
+// Only the digest signatures used by the service are supported (RSASSA_PKCS1_V1_5_SHA_256 and ECDSA_SHA_256)
+type FakeKMS struct {
+	mu		sync.Mutex
+	keys	map[string]crypto.Signer
+	ctxs	[]context.Context	// the ctx of each Sign call, the tests check the request ctx reaches KMS
+}
+
+func NewFakeKMS() *FakeKMS {
+	return &FakeKMS{
+		keys: map[string]crypto.Signer{},
+	}
+}
+
+// AddKey registers the private key of the key id
+func (f *FakeKMS) AddKey(keyId string, private_key crypto.Signer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.keys[keyId] = private_key
+}
+
+// SignContexts returns the ctx of the Sign calls
+func (f *FakeKMS) SignContexts() []context.Context {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]context.Context{}, f.ctxs...)
+}
+
+func (f *FakeKMS) key(keyId *string) (crypto.Signer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	private_key, ok := f.keys[aws.ToString(keyId)]
+	if !ok {
+		return nil, &types.NotFoundException{ Message: aws.String("key " + aws.ToString(keyId) + " not found") }
+	}
+	return private_key, nil
+}
+
+func signingAlgorithm(private_key crypto.Signer) (types.SigningAlgorithmSpec, error) {
+	switch private_key.(type) {
+		case *rsa.PrivateKey:
+			return types.SigningAlgorithmSpecRsassaPkcs1V15Sha256, nil
+		case *ecdsa.PrivateKey:
+			return types.SigningAlgorithmSpecEcdsaSha256, nil
+	}
+	return "", fmt.Errorf("fake kms: key type %T not supported", private_key)
+}
+
+func (f *FakeKMS) Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error) {
+	private_key, err := f.key(params.KeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.ctxs = append(f.ctxs, ctx)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	algorithm, err := signingAlgorithm(private_key)
+	if err != nil {
+		return nil, err
+	}
+	if params.MessageType != types.MessageTypeDigest || params.SigningAlgorithm != algorithm {
+		return nil, &types.InvalidKeyUsageException{ Message: aws.String("fake kms: only " + string(algorithm) + " digests are signed") }
+	}
+
+	// as KMS, the ECDSA signature is ASN.1 DER
+	var signature []byte
+	switch key := private_key.(type) {
+		case *rsa.PrivateKey:
+			signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, params.Message)
+		case *ecdsa.PrivateKey:
+			signature, err = ecdsa.SignASN1(rand.Reader, key, params.Message)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.SignOutput{	KeyId: params.KeyId,
+							Signature: signature,
+							SigningAlgorithm: algorithm }, nil
+}
+
+func (f *FakeKMS) GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+	private_key, err := f.key(params.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := signingAlgorithm(private_key)
+	if err != nil {
+		return nil, err
+	}
+
+	public_der, err := x509.MarshalPKIXPublicKey(private_key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.GetPublicKeyOutput{	KeyId: params.KeyId,
+									PublicKey: public_der,
+									KeyUsage: types.KeyUsageTypeSignVerify,
+									SigningAlgorithms: []types.SigningAlgorithmSpec{algorithm} }, nil
+}
@@ -2,20 +2,31 @@ package aws_secret_manager
 
 import (
 	"context"
+	"errors"
 	
 	"github.com/rs/zerolog/log"
 	"github.com/lambda-go-autentication/pkg/observability"
 	
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
 )
 
 var childLogger = log.With().Str("pkg", "aws_secret_manager").Logger()
 
+// ErrVersionNotFound is returned when the secret has no version with the id or staging label (ex: AWSPREVIOUS before the first rotation)
+var ErrVersionNotFound = errors.New("secret version not found")
+
 type AwsClientSecretManager struct {
 	Client *secretsmanager.Client
 }
 
+type SecretVersion struct {
+	VersionId		string
+	VersionStages	[]string
+	SecretString	*string
+}
+
 func NewClientSecretManager(configAWS *aws.Config) (*AwsClientSecretManager) {
 	childLogger.Debug().Msg("NewClientSecretManager")
 
@@ -28,7 +39,7 @@ func NewClientSecretManager(configAWS *aws.Config) (*AwsClientSecretManager) {
 func (p *AwsClientSecretManager) GetSecret(ctx context.Context, secretName string) (*string, error) {
 	childLogger.Debug().Msg("GetSecret")
 
-	span := observability.Span(ctx, "aws_secret_manager.GetSecret")	
+	ctx, span := observability.Span(ctx, "aws_secret_manager.GetSecret")	
     defer span.End()
 
 	result, err := p.Client.GetSecretValue(ctx, 
@@ -42,4 +53,139 @@ func (p *AwsClientSecretManager) GetSecret(ctx context.Context, secretName strin
 	}
 
 	return result.SecretString, nil
-}
\ No newline at end of file
+}
+
+// ListSecretVersions returns the versions with at least one staging label, without the values
+func (p *AwsClientSecretManager) ListSecretVersions(ctx context.Context, secretName string) ([]SecretVersion, error) {
+	childLogger.Debug().Msg("ListSecretVersions")
+
+	ctx, span := observability.Span(ctx, "aws_secret_manager.ListSecretVersions")	
+    defer span.End()
+
+	versions := []SecretVersion{}
+	paginator := secretsmanager.NewListSecretVersionIdsPaginator(p.Client, 
+		&secretsmanager.ListSecretVersionIdsInput{
+			SecretId:	aws.String(secretName),
+		})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range page.Versions {
+			versions = append(versions, SecretVersion{	VersionId: aws.ToString(version.VersionId),
+														VersionStages: version.VersionStages})
+		}
+	}
+
+	return versions, nil
+}
+
+// GetSecretVersion reads a secret by version id or, when versionId is empty, by staging label
+func (p *AwsClientSecretManager) GetSecretVersion(	ctx context.Context, 
+													secretName string,
+													versionId string,
+													versionStage string) (*SecretVersion, error) {
+	childLogger.Debug().Msg("GetSecretVersion")
+
+	ctx, span := observability.Span(ctx, "aws_secret_manager.GetSecretVersion")	
+    defer span.End()
+
+	input := &secretsmanager.GetSecretValueInput{
+		SecretId:	aws.String(secretName),
+	}
+	if versionId != "" {
+		input.VersionId = aws.String(versionId)
+	} else {
+		input.VersionStage = aws.String(versionStage)
+	}
+
+	result, err := p.Client.GetSecretValue(ctx, input)
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.SecretString == nil {
+		return nil, errors.New("secret " + secretName + " has no string value")
+	}
+
+	return &SecretVersion{	VersionId: aws.ToString(result.VersionId),
+							VersionStages: result.VersionStages,
+							SecretString: result.SecretString}, nil
+}
+
+// SecretDescription is the rotation state of a secret, the staging labels by version id
+type SecretDescription struct {
+	ARN				string
+	Name			string
+	RotationEnabled	bool
+	VersionStages	map[string][]string
+}
+
+func (p *AwsClientSecretManager) DescribeSecret(ctx context.Context, secretName string) (*SecretDescription, error) {
+	childLogger.Debug().Msg("DescribeSecret")
+
+	ctx, span := observability.Span(ctx, "aws_secret_manager.DescribeSecret")	
+    defer span.End()
+
+	result, err := p.Client.DescribeSecret(ctx, 
+		&secretsmanager.DescribeSecretInput{
+			SecretId:	aws.String(secretName),
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretDescription{	ARN: aws.ToString(result.ARN),
+								Name: aws.ToString(result.Name),
+								RotationEnabled: aws.ToBool(result.RotationEnabled),
+								VersionStages: result.VersionIdsToStages}, nil
+}
+
+// PutSecretVersion stores the value as the version id (the ClientRequestToken of the rotation) with the staging label
+func (p *AwsClientSecretManager) PutSecretVersion(	ctx context.Context, 
+													secretName string,
+													versionId string,
+													secretString string,
+													versionStage string) error {
+	childLogger.Debug().Msg("PutSecretVersion")
+
+	ctx, span := observability.Span(ctx, "aws_secret_manager.PutSecretVersion")	
+    defer span.End()
+
+	_, err := p.Client.PutSecretValue(ctx, 
+		&secretsmanager.PutSecretValueInput{
+			SecretId:			aws.String(secretName),
+			ClientRequestToken:	aws.String(versionId),
+			SecretString:		aws.String(secretString),
+			VersionStages:		[]string{versionStage},
+		})
+	return err
+}
+
+// UpdateSecretVersionStage moves the staging label to a version, removing it from the version that holds it
+func (p *AwsClientSecretManager) UpdateSecretVersionStage(	ctx context.Context, 
+															secretName string,
+															versionStage string,
+															moveToVersionId string,
+															removeFromVersionId string) error {
+	childLogger.Debug().Msg("UpdateSecretVersionStage")
+
+	ctx, span := observability.Span(ctx, "aws_secret_manager.UpdateSecretVersionStage")	
+    defer span.End()
+
+	input := &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:			aws.String(secretName),
+		VersionStage:		aws.String(versionStage),
+		MoveToVersionId:	aws.String(moveToVersionId),
+	}
+	if removeFromVersionId != "" {
+		input.RemoveFromVersionId = aws.String(removeFromVersionId)
+	}
+
+	_, err := p.Client.UpdateSecretVersionStage(ctx, input)
+	return err
+}
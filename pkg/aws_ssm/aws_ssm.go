@@ -0,0 +1,45 @@
+package aws_ssm
+
+import (
+	"context"
+	
+	"github.com/rs/zerolog/log"
+	"github.com/lambda-go-autentication/pkg/observability"
+	
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+var childLogger = log.With().Str("pkg", "aws_ssm").Logger()
+
+type AwsClientSSM struct {
+	Client *ssm.Client
+}
+
+func NewClientSSM(configAWS *aws.Config) (*AwsClientSSM) {
+	childLogger.Debug().Msg("NewClientSSM")
+
+	client := ssm.NewFromConfig(*configAWS)
+	return &AwsClientSSM{
+		Client: client,
+	}
+}
+
+// GetParameter reads a parameter, the SecureString parameters are decrypted
+func (p *AwsClientSSM) GetParameter(ctx context.Context, parameterName string) (*string, error) {
+	childLogger.Debug().Msg("GetParameter")
+
+	ctx, span := observability.Span(ctx, "aws_ssm.GetParameter")	
+    defer span.End()
+
+	result, err := p.Client.GetParameter(ctx, 
+		&ssm.GetParameterInput{
+			Name:			aws.String(parameterName),
+			WithDecryption:	aws.Bool(true),
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Parameter.Value, nil
+}
@@ -19,10 +19,12 @@ type Database struct {
 func NewDatabase(ctx context.Context, configAWS *aws.Config) (*Database, error){
 	childLogger.Debug().Msg("NewDatabase")
 
-	span := observability.Span(ctx, "repository.NewDatabase")	
+	ctx, span := observability.Span(ctx, "repository.NewDatabase")	
     defer span.End()
 
-	client := dynamodb.NewFromConfig(*configAWS)
+	client := dynamodb.NewFromConfig(*configAWS, func(o *dynamodb.Options) {
+		o.APIOptions = append(o.APIOptions, observability.DynamoDBMetrics)
+	})
 
 	return &Database {
 		Client: client,
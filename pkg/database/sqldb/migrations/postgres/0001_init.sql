@@ -0,0 +1,29 @@
+CREATE TABLE credentials (
+	user_name	VARCHAR(256)	PRIMARY KEY,
+	password	TEXT			NOT NULL DEFAULT '',
+	usage_plan	VARCHAR(256)	NOT NULL DEFAULT '',
+	api_key		VARCHAR(256)	NOT NULL DEFAULT '',
+	signing_alg	VARCHAR(16)		NOT NULL DEFAULT '',
+	updated_at	TIMESTAMPTZ		NOT NULL
+);
+
+-- scope is the json array of the scopes, replaced as a whole (as the SCOPE-001 item)
+CREATE TABLE credential_scopes (
+	user_name	VARCHAR(256)	PRIMARY KEY,
+	scope		TEXT			NOT NULL,
+	updated_at	TIMESTAMPTZ		NOT NULL
+);
+
+CREATE TABLE resource_servers (
+	audience	VARCHAR(256)	PRIMARY KEY,
+	scope		TEXT			NOT NULL,
+	updated_at	TIMESTAMPTZ		NOT NULL
+);
+
+CREATE TABLE revoked_tokens (
+	jwt_id		VARCHAR(64)		PRIMARY KEY,
+	expires_at	BIGINT			NOT NULL,
+	updated_at	TIMESTAMPTZ		NOT NULL
+);
+
+CREATE INDEX revoked_tokens_expires_at ON revoked_tokens (expires_at);
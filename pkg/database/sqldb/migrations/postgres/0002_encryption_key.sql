@@ -0,0 +1,2 @@
+-- recipient public key (pem) of the encrypted tokens
+ALTER TABLE credentials ADD COLUMN encryption_key TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- the failed logins of a credential (as the LOCKOUT item), counted until expires_at
+CREATE TABLE login_failures (
+	user_name		VARCHAR(256)	PRIMARY KEY,
+	failures		INTEGER			NOT NULL,
+	locked_until	BIGINT			NOT NULL DEFAULT 0,
+	expires_at		BIGINT			NOT NULL,
+	updated_at		TIMESTAMPTZ		NOT NULL
+);
@@ -0,0 +1,29 @@
+CREATE TABLE credentials (
+	user_name	TEXT		PRIMARY KEY,
+	password	TEXT		NOT NULL DEFAULT '',
+	usage_plan	TEXT		NOT NULL DEFAULT '',
+	api_key		TEXT		NOT NULL DEFAULT '',
+	signing_alg	TEXT		NOT NULL DEFAULT '',
+	updated_at	TIMESTAMP	NOT NULL
+);
+
+-- scope is the json array of the scopes, replaced as a whole (as the SCOPE-001 item)
+CREATE TABLE credential_scopes (
+	user_name	TEXT		PRIMARY KEY,
+	scope		TEXT		NOT NULL,
+	updated_at	TIMESTAMP	NOT NULL
+);
+
+CREATE TABLE resource_servers (
+	audience	TEXT		PRIMARY KEY,
+	scope		TEXT		NOT NULL,
+	updated_at	TIMESTAMP	NOT NULL
+);
+
+CREATE TABLE revoked_tokens (
+	jwt_id		TEXT		PRIMARY KEY,
+	expires_at	INTEGER		NOT NULL,
+	updated_at	TIMESTAMP	NOT NULL
+);
+
+CREATE INDEX revoked_tokens_expires_at ON revoked_tokens (expires_at);
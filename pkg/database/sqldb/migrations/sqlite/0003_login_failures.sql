@@ -0,0 +1,8 @@
+-- the failed logins of a credential (as the LOCKOUT item), counted until expires_at
+CREATE TABLE login_failures (
+	user_name		TEXT		PRIMARY KEY,
+	failures		INTEGER		NOT NULL,
+	locked_until	INTEGER		NOT NULL DEFAULT 0,
+	expires_at		INTEGER		NOT NULL,
+	updated_at		TIMESTAMP	NOT NULL
+);
@@ -0,0 +1,167 @@
+package sqldb
+
+import(
+	"fmt"
+	"sort"
+	"embed"
+	"time"
+	"context"
+	"strconv"
+	"strings"
+	"database/sql"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lambda-go-autentication/pkg/observability"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+var childLogger = log.With().Str("pkg", "sqldb").Logger()
+
+const (
+	DriverPostgres	= "postgres"
+	DriverSQLite	= "sqlite"
+	// key of the advisory lock taken while the migrations run (several instances may start together)
+	migrationLockKey = 7310384218
+)
+
+//go:embed migrations/*/*.sql
+var migrations embed.FS
+
+type Database struct {
+	Client 		*sql.DB
+	Driver		string
+}
+
+// NewDatabase opens the database (postgres or sqlite) and checks the connection, the schema is created by Migrate
+func NewDatabase(ctx context.Context, driver string, dsn string) (*Database, error){
+	childLogger.Debug().Msg("NewDatabase")
+
+	ctx, span := observability.Span(ctx, "repository.NewDatabase")	
+    defer span.End()
+
+	if driver != DriverPostgres && driver != DriverSQLite {
+		return nil, fmt.Errorf("sql driver %q not supported", driver)
+	}
+
+	client, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if driver == DriverSQLite {
+		// sqlite serializes the writes, one connection avoids the "database is locked" errors (and keeps a :memory: database)
+		client.SetMaxOpenConns(1)
+	} else {
+		client.SetMaxOpenConns(10)
+		client.SetConnMaxIdleTime(5 * time.Minute)
+	}
+
+	if err := client.PingContext(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &Database {
+		Client: client,
+		Driver: driver,
+	}, nil
+}
+
+// Rebind converts the ? placeholders to the $n placeholders of postgres
+func (d *Database) Rebind(query string) string {
+	if d.Driver != DriverPostgres {
+		return query
+	}
+
+	var builder strings.Builder
+	n := 0
+	for _, char := range query {
+		if char == '?' {
+			n++
+			builder.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		builder.WriteRune(char)
+	}
+	return builder.String()
+}
+
+// Migrate applies the migrations (migrations/<driver>/NNNN_name.sql) not yet recorded in schema_migrations, in a single transaction
+func (d *Database) Migrate(ctx context.Context) error{
+	childLogger.Debug().Msg("Migrate")
+
+	ctx, span := observability.Span(ctx, "repository.Migrate")	
+    defer span.End()
+
+	files, err := migrations.ReadDir("migrations/" + d.Driver)
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+
+	tx, err := d.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if d.Driver == DriverPostgres {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockKey); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+											version		INTEGER		PRIMARY KEY,
+											name		TEXT		NOT NULL,
+											applied_at	TIMESTAMP	NOT NULL)`); err != nil {
+		return err
+	}
+
+	applied := map[int]bool{}
+	rows, err := tx.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		version, err := strconv.Atoi(strings.SplitN(file.Name(), "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("migration %s without version prefix", file.Name())
+		}
+		if applied[version] {
+			continue
+		}
+
+		statements, err := migrations.ReadFile("migrations/" + d.Driver + "/" + file.Name())
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(statements)); err != nil {
+			return fmt.Errorf("migration %s: %w", file.Name(), err)
+		}
+		if _, err := tx.ExecContext(ctx, 
+									d.Rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+									version, file.Name(), time.Now().UTC()); err != nil {
+			return err
+		}
+		childLogger.Info().Str("migration", file.Name()).Msg("migration applied")
+	}
+
+	return tx.Commit()
+}
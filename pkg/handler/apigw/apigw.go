@@ -6,68 +6,38 @@ import(
 
 	"github.com/aws/aws-lambda-go/events"
 
-	adapter_credential "github.com/lambda-go-autentication/internal/usecase/credential/adapter"
+	"github.com/lambda-go-autentication/pkg/handler/router"
+
 	adapter_jwt "github.com/lambda-go-autentication/internal/usecase/jwt/adapter"
 )
 
 var childLogger = log.With().Str("handler", "apigw").Logger()
-var response		*events.APIGatewayProxyResponse
 
 type LambdaHandler struct {
-    AdapterCredential 	*adapter_credential.AdapterCredential
+	Router				*router.Router
 	AdapterJwt 			*adapter_jwt.AdapterJwt
 }
 
-func InitializeLambdaHandler( 	adapterCredential 	*adapter_credential.AdapterCredential,
+func InitializeLambdaHandler( 	router 				*router.Router,
 								adapterJwt 			*adapter_jwt.AdapterJwt ) *LambdaHandler {
 	childLogger.Debug().Msg("InitializeLambdaHandler")
 
     return &LambdaHandler{
-        AdapterCredential: adapterCredential,
+        Router: router,
 		AdapterJwt: adapterJwt,
 	}
 }
 
+// LambdaHandlerRequest handles the APIGW REST API (proxy integration v1) events
 func (h *LambdaHandler) LambdaHandlerRequest(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
 	childLogger.Debug().Msg("lambdaHandlerRequest")
-	
-	// Check the http method and path
-	switch request.HTTPMethod {
-		case "GET":
-			if (request.Resource == "/credentialScope/{id}"){  
-				response, _ = h.AdapterCredential.QueryCredentialScope(ctx, request) // Query the scopes associated with credential
-			}else if (request.Resource == "/info"){
-				response, _ = h.AdapterCredential.GetInfo(ctx)
-			}else {
-				response, _ = h.AdapterCredential.UnhandledMethod()
-			}
-		case "POST":
-			if (request.Resource == "/login"){  
-				response, _ = h.AdapterCredential.Login(ctx, request) // Login
-			}else if (request.Resource == "/loginRSA"){  
-				response, _ = h.AdapterCredential.LoginRSA(ctx, request) // Login
-			}else if (request.Resource == "/refreshToken") {
-				response, _ = h.AdapterJwt.RefreshToken(ctx, request) // Refresh Token
-			}else if (request.Resource == "/refreshTokenRSA") {
-					response, _ = h.AdapterJwt.RefreshTokenRSA(ctx, request) // Refresh Token
-			}else if (request.Resource == "/tokenValidation") {
-				response, _ = h.AdapterJwt.TokenValidation(ctx, request) // Do a JWT validation (signature and expiration date)
-			}else if (request.Resource == "/tokenValidationRSA") {
-					response, _ = h.AdapterJwt.TokenValidationRSA(ctx, request) // Do a JWT validation (signature and expiration date)
-			}else if (request.Resource == "/signIn") {
-				response, _ = h.AdapterCredential.SignIn(ctx, request) // Create a new credentials
-			}else if (request.Resource == "/addScope") {
-				response, _ =  h.AdapterCredential.AddScope(ctx, request) // Add scopes to the credential
-			}else {
-				response, _ = h.AdapterCredential.UnhandledMethod()
-			}
-		case "DELETE":
-			response, _ = h.AdapterCredential.UnhandledMethod()
-		case "PUT":
-			response, _ = h.AdapterCredential.UnhandledMethod()
-		default:
-			response, _ = h.AdapterCredential.UnhandledMethod()
-	}
 
-	return response, nil
-}
\ No newline at end of file
+	httpRequest, bodyErr := fromProxyRequest(request)
+	httpResponse := h.route(ctx, httpRequest, bodyErr)
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: httpResponse.StatusCode,
+		Headers: httpResponse.Headers,
+		Body: httpResponse.Body,
+	}, nil
+}
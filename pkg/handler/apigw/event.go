@@ -0,0 +1,265 @@
+package apigw
+
+import(
+	"context"
+	"strings"
+	"net/http"
+	"strconv"
+	"encoding/json"
+	"encoding/base64"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/erro"
+)
+
+// eventProbe has the fields used to detect the type of the event
+type eventProbe struct {
+	Type			string `json:"type"`
+	MethodArn		string `json:"methodArn"`
+	Version			string `json:"version"`
+	HTTPMethod		string `json:"httpMethod"`
+	RequestContext	struct {
+		DomainName	string `json:"domainName"`
+		Elb			*struct {
+			TargetGroupArn	string `json:"targetGroupArn"`
+		} `json:"elb"`
+	} `json:"requestContext"`
+}
+
+// LambdaHandlerEvent detects the event type, the same binary works as the API (APIGW REST and HTTP APIs,
+// ALB target group, Function URL) and as the APIGW Lambda authorizer (TOKEN and REQUEST)
+func (h *LambdaHandler) LambdaHandlerEvent(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	childLogger.Debug().Msg("LambdaHandlerEvent")
+
+	var probe eventProbe
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return nil, err
+	}
+
+	switch {
+		case probe.MethodArn != "" && probe.Type == "TOKEN":
+			var request events.APIGatewayCustomAuthorizerRequest
+			if err := json.Unmarshal(payload, &request); err != nil {
+				return nil, err
+			}
+			return h.AdapterJwt.AuthorizerToken(ctx, request)
+		case probe.MethodArn != "" && probe.Type == "REQUEST":
+			var request events.APIGatewayCustomAuthorizerRequestTypeRequest
+			if err := json.Unmarshal(payload, &request); err != nil {
+				return nil, err
+			}
+			return h.AdapterJwt.AuthorizerRequest(ctx, request)
+		case probe.RequestContext.Elb != nil:
+			var request events.ALBTargetGroupRequest
+			if err := json.Unmarshal(payload, &request); err != nil {
+				return nil, err
+			}
+			return h.LambdaHandlerALBRequest(ctx, request)
+		case probe.Version == "2.0" && strings.Contains(probe.RequestContext.DomainName, ".lambda-url."):
+			var request events.LambdaFunctionURLRequest
+			if err := json.Unmarshal(payload, &request); err != nil {
+				return nil, err
+			}
+			return h.LambdaHandlerFunctionURLRequest(ctx, request)
+		case probe.Version == "2.0":
+			var request events.APIGatewayV2HTTPRequest
+			if err := json.Unmarshal(payload, &request); err != nil {
+				return nil, err
+			}
+			return h.LambdaHandlerV2Request(ctx, request)
+		default:
+			var request events.APIGatewayProxyRequest
+			if err := json.Unmarshal(payload, &request); err != nil {
+				return nil, err
+			}
+			return h.LambdaHandlerRequest(ctx, request)
+	}
+}
+
+// LambdaHandlerV2Request handles the APIGW HTTP API (payload format 2.0) events
+func (h *LambdaHandler) LambdaHandlerV2Request(ctx context.Context, request events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
+	childLogger.Debug().Msg("LambdaHandlerV2Request")
+
+	body, bodyErr := decodeBody(request.Body, request.IsBase64Encoded)
+
+	stage := request.RequestContext.Stage
+	if stage == "$default" {
+		stage = ""
+	}
+
+	httpRequest := model.HttpRequest{
+		Method: request.RequestContext.HTTP.Method,
+		Path: trimStage(request.RawPath, stage),
+		PathParameters: request.PathParameters,
+		QueryParameters: request.QueryStringParameters,
+		Headers: lowerHeaders(request.Headers),
+		Body: body,
+		DomainName: request.RequestContext.DomainName,
+		Stage: stage,
+		SourceIP: request.RequestContext.HTTP.SourceIP,
+		UserAgent: request.RequestContext.HTTP.UserAgent,
+		RequestID: request.RequestContext.RequestID,
+	}
+
+	// the route key (METHOD /resource) is the resource, except on the $default route
+	if _, resource, found := strings.Cut(request.RouteKey, " "); found {
+		httpRequest.Resource = resource
+	} else {
+		httpRequest.Resource, httpRequest.PathParameters = h.Router.MatchResource(httpRequest.Path)
+	}
+
+	httpResponse := h.route(ctx, httpRequest, bodyErr)
+
+	return &events.APIGatewayV2HTTPResponse{
+		StatusCode: httpResponse.StatusCode,
+		Headers: httpResponse.Headers,
+		Body: httpResponse.Body,
+	}, nil
+}
+
+// trimStage removes the named stage from the raw path of the HTTP API (/prod/login is /login), the $default stage
+// is not in the path
+func trimStage(rawPath string, stage string) string {
+	if stage == "" {
+		return rawPath
+	}
+	if rawPath == "/" + stage {
+		return "/"
+	}
+	if strings.HasPrefix(rawPath, "/" + stage + "/") {
+		return strings.TrimPrefix(rawPath, "/" + stage)
+	}
+	return rawPath
+}
+
+// LambdaHandlerFunctionURLRequest handles the Lambda Function URL events
+func (h *LambdaHandler) LambdaHandlerFunctionURLRequest(ctx context.Context, request events.LambdaFunctionURLRequest) (*events.LambdaFunctionURLResponse, error) {
+	childLogger.Debug().Msg("LambdaHandlerFunctionURLRequest")
+
+	body, bodyErr := decodeBody(request.Body, request.IsBase64Encoded)
+
+	httpRequest := model.HttpRequest{
+		Method: request.RequestContext.HTTP.Method,
+		Path: request.RawPath,
+		QueryParameters: request.QueryStringParameters,
+		Headers: lowerHeaders(request.Headers),
+		Body: body,
+		DomainName: request.RequestContext.DomainName,
+		SourceIP: request.RequestContext.HTTP.SourceIP,
+		UserAgent: request.RequestContext.HTTP.UserAgent,
+		RequestID: request.RequestContext.RequestID,
+	}
+	httpResponse := h.route(ctx, httpRequest, bodyErr)
+
+	return &events.LambdaFunctionURLResponse{
+		StatusCode: httpResponse.StatusCode,
+		Headers: httpResponse.Headers,
+		Body: httpResponse.Body,
+	}, nil
+}
+
+// LambdaHandlerALBRequest handles the ALB target group events
+func (h *LambdaHandler) LambdaHandlerALBRequest(ctx context.Context, request events.ALBTargetGroupRequest) (*events.ALBTargetGroupResponse, error) {
+	childLogger.Debug().Msg("LambdaHandlerALBRequest")
+
+	body, bodyErr := decodeBody(request.Body, request.IsBase64Encoded)
+
+	// with multi value headers enabled in the target group only the multi value fields are filled
+	headers := lowerHeaders(request.Headers)
+	for name, values := range request.MultiValueHeaders {
+		if len(values) > 0 {
+			headers[strings.ToLower(name)] = values[len(values)-1]
+		}
+	}
+	queryParameters := request.QueryStringParameters
+	for name, values := range request.MultiValueQueryStringParameters {
+		if queryParameters == nil {
+			queryParameters = map[string]string{}
+		}
+		if len(values) > 0 {
+			queryParameters[name] = values[len(values)-1]
+		}
+	}
+
+	httpRequest := model.HttpRequest{
+		Method: request.HTTPMethod,
+		Path: request.Path,
+		QueryParameters: queryParameters,
+		Headers: headers,
+		Body: body,
+		DomainName: headers["host"],
+		SourceIP: strings.TrimSpace(strings.Split(headers["x-forwarded-for"], ",")[0]),
+		UserAgent: headers["user-agent"],
+		RequestID: headers["x-amzn-trace-id"],
+	}
+	httpResponse := h.route(ctx, httpRequest, bodyErr)
+
+	response := events.ALBTargetGroupResponse{
+		StatusCode: httpResponse.StatusCode,
+		StatusDescription: strconv.Itoa(httpResponse.StatusCode) + " " + http.StatusText(httpResponse.StatusCode),
+		Body: httpResponse.Body,
+	}
+	if request.MultiValueHeaders != nil {
+		response.MultiValueHeaders = map[string][]string{}
+		for name, value := range httpResponse.Headers {
+			response.MultiValueHeaders[name] = []string{value}
+		}
+	} else {
+		response.Headers = httpResponse.Headers
+	}
+
+	return &response, nil
+}
+
+// fromProxyRequest returns the request even when the body is not valid base64, the error is answered by route
+func fromProxyRequest(request events.APIGatewayProxyRequest) (model.HttpRequest, error) {
+	body, bodyErr := decodeBody(request.Body, request.IsBase64Encoded)
+
+	httpRequest := model.HttpRequest{
+		Method: request.HTTPMethod,
+		Path: request.Path,
+		Resource: request.Resource,
+		PathParameters: request.PathParameters,
+		QueryParameters: request.QueryStringParameters,
+		Headers: lowerHeaders(request.Headers),
+		Body: body,
+		DomainName: request.RequestContext.DomainName,
+		Stage: request.RequestContext.Stage,
+		SourceIP: request.RequestContext.Identity.SourceIP,
+		UserAgent: request.RequestContext.Identity.UserAgent,
+		RequestID: request.RequestContext.RequestID,
+	}
+
+	return httpRequest, bodyErr
+}
+
+func lowerHeaders(headers map[string]string) map[string]string {
+	lower := make(map[string]string, len(headers))
+	for name, value := range headers {
+		lower[strings.ToLower(name)] = value
+	}
+	return lower
+}
+
+// route answers 400 (problem) when the body could not be decoded, the request is not routed
+func (h *LambdaHandler) route(ctx context.Context, httpRequest model.HttpRequest, bodyErr error) *model.HttpResponse {
+	if bodyErr != nil {
+		childLogger.Info().Err(bodyErr).Str("method", httpRequest.Method).Str("path", httpRequest.Path).Msg("invalid request body")
+		return erro.ProblemResponse(ctx, bodyErr)
+	}
+	return h.Router.Route(ctx, httpRequest)
+}
+
+// decodeBody decodes a base64 body, an invalid one is a bad request (invalid_request)
+func decodeBody(body string, isBase64Encoded bool) (string, error) {
+	if !isBase64Encoded {
+		return body, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return "", erro.ErrBadRequest.WithMessage("request body is not valid base64").Wrap(err)
+	}
+	return string(decoded), nil
+}
@@ -0,0 +1,200 @@
+package apigw
+
+import (
+	"errors"
+	"context"
+	"testing"
+	"net/http"
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/lambda-go-autentication/pkg/handler/router"
+	"github.com/lambda-go-autentication/pkg/util"
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+func TestDecodeBody(t *testing.T) {
+	cases := []struct {
+		name			string
+		body			string
+		isBase64Encoded	bool
+		want			string
+		wantErr			bool
+	}{
+		{ name: "plain body", body: `{"user":"007"}`, want: `{"user":"007"}` },
+		{ name: "base64 body", body: "eyJ1c2VyIjoiMDA3In0=", isBase64Encoded: true, want: `{"user":"007"}` },
+		{ name: "empty base64 body", body: "", isBase64Encoded: true, want: "" },
+		{ name: "invalid base64 body", body: "not base64!", isBase64Encoded: true, wantErr: true },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := decodeBody(c.body, c.isBase64Encoded)
+			if c.wantErr {
+				if !errors.Is(err, erro.ErrBadRequest) {
+					t.Fatalf("decodeBody error = %v, want %v", err, erro.ErrBadRequest)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Errorf("decodeBody = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestInvalidBodyIsBadRequest(t *testing.T) {
+	appRouter := router.NewRouter()
+	appRouter.Handle(http.MethodPost, "/login", func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+		t.Error("the request must not be routed")
+		return &model.HttpResponse{ StatusCode: http.StatusOK }, nil
+	})
+	handler := InitializeLambdaHandler(appRouter, nil)
+
+	payloads := map[string]string{
+		"rest api": `{"httpMethod":"POST","path":"/login","resource":"/login","body":"%%%","isBase64Encoded":true}`,
+		"http api": `{"version":"2.0","routeKey":"POST /login","rawPath":"/login","body":"%%%","isBase64Encoded":true,"requestContext":{"domainName":"abc.execute-api.us-east-2.amazonaws.com","http":{"method":"POST"}}}`,
+		"function url": `{"version":"2.0","rawPath":"/login","body":"%%%","isBase64Encoded":true,"requestContext":{"domainName":"abc.lambda-url.us-east-2.on.aws","http":{"method":"POST"}}}`,
+		"alb": `{"httpMethod":"POST","path":"/login","body":"%%%","isBase64Encoded":true,"requestContext":{"elb":{"targetGroupArn":"arn"}}}`,
+	}
+
+	for name, payload := range payloads {
+		t.Run(name, func(t *testing.T) {
+			response, err := handler.LambdaHandlerEvent(context.Background(), json.RawMessage(payload))
+			if err != nil {
+				t.Fatalf("LambdaHandlerEvent error = %v, want a 400 response", err)
+			}
+
+			data, _ := json.Marshal(response)
+			var got struct {
+				StatusCode	int					`json:"statusCode"`
+				Headers		map[string]string	`json:"headers"`
+				Body		string				`json:"body"`
+			}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.StatusCode != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", got.StatusCode)
+			}
+			if got.Headers["Content-Type"] != erro.ContentTypeProblem {
+				t.Errorf("content type = %s, want %s", got.Headers["Content-Type"], erro.ContentTypeProblem)
+			}
+
+			var problem model.Problem
+			if err := json.Unmarshal([]byte(got.Body), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Code != erro.ErrBadRequest.Code {
+				t.Errorf("code = %s, want %s", problem.Code, erro.ErrBadRequest.Code)
+			}
+		})
+	}
+}
+
+func TestV2RequestStagePath(t *testing.T) {
+	appRouter := router.NewRouter()
+	appRouter.Handle(http.MethodGet, "/credential/{id}", func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+		return &model.HttpResponse{ StatusCode: http.StatusOK, Body: request.Path + " " + request.PathParameters["id"] }, nil
+	})
+	handler := InitializeLambdaHandler(appRouter, nil)
+
+	cases := []struct {
+		name		string
+		routeKey	string
+		rawPath		string
+		stage		string
+		wantStatus	int
+		wantBody	string
+	}{
+		{ name: "default stage", routeKey: "$default", rawPath: "/credential/007", stage: "$default", wantStatus: http.StatusOK, wantBody: "/credential/007 007" },
+		{ name: "named stage on the default route", routeKey: "$default", rawPath: "/prod/credential/007", stage: "prod", wantStatus: http.StatusOK, wantBody: "/credential/007 007" },
+		{ name: "named stage on a proxy route", routeKey: "ANY /{proxy+}", rawPath: "/prod/credential/007", stage: "prod", wantStatus: http.StatusOK, wantBody: "/credential/007 007" },
+		{ name: "stage is only a prefix of the segment", routeKey: "$default", rawPath: "/production/credential/007", stage: "prod", wantStatus: http.StatusNotFound },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			payload, _ := json.Marshal(map[string]interface{}{
+				"version": "2.0",
+				"routeKey": c.routeKey,
+				"rawPath": c.rawPath,
+				"requestContext": map[string]interface{}{
+					"domainName": "abc.execute-api.us-east-2.amazonaws.com",
+					"stage": c.stage,
+					"http": map[string]string{ "method": http.MethodGet },
+				},
+			})
+
+			response, err := handler.LambdaHandlerEvent(context.Background(), payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := response.(*events.APIGatewayV2HTTPResponse)
+			if !ok {
+				t.Fatalf("response = %T, want an HTTP API response", response)
+			}
+			if got.StatusCode != c.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", got.StatusCode, c.wantStatus, got.Body)
+			}
+			if c.wantBody != "" && got.Body != c.wantBody {
+				t.Errorf("body = %s, want %s", got.Body, c.wantBody)
+			}
+		})
+	}
+}
+
+func TestBase64BodyDecodeRequest(t *testing.T) {
+	appRouter := router.NewRouter()
+	appRouter.Handle(http.MethodPost, "/login", func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+		var login struct {
+			User	string	`json:"user" validate:"required,username"`
+		}
+		if err := util.DecodeRequest(request.Body, &login); err != nil {
+			return erro.ProblemResponse(ctx, err), nil
+		}
+		return &model.HttpResponse{ StatusCode: http.StatusOK, Body: login.User }, nil
+	})
+	handler := InitializeLambdaHandler(appRouter, nil)
+
+	cases := []struct {
+		name		string
+		payload		string
+		wantStatus	int
+		wantBody	string
+	}{
+		{ name: "rest api", payload: `{"httpMethod":"POST","path":"/login","resource":"/login","body":"eyJ1c2VyIjoiMDA3In0=","isBase64Encoded":true}`, wantStatus: http.StatusOK, wantBody: "007" },
+		{ name: "http api", payload: `{"version":"2.0","routeKey":"POST /login","rawPath":"/login","body":"eyJ1c2VyIjoiMDA3In0=","isBase64Encoded":true,"requestContext":{"domainName":"abc.execute-api.us-east-2.amazonaws.com","http":{"method":"POST"}}}`, wantStatus: http.StatusOK, wantBody: "007" },
+		// {"user":"007","ID":"x"} the unknown field is refused after the base64 decoding
+		{ name: "unknown field in the encoded body", payload: `{"httpMethod":"POST","path":"/login","resource":"/login","body":"eyJ1c2VyIjoiMDA3IiwiSUQiOiJ4In0=","isBase64Encoded":true}`, wantStatus: http.StatusBadRequest },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			response, err := handler.LambdaHandlerEvent(context.Background(), json.RawMessage(c.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, _ := json.Marshal(response)
+			var got struct {
+				StatusCode	int		`json:"statusCode"`
+				Body		string	`json:"body"`
+			}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.StatusCode != c.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", got.StatusCode, c.wantStatus, got.Body)
+			}
+			if c.wantBody != "" && got.Body != c.wantBody {
+				t.Errorf("body = %s, want %s", got.Body, c.wantBody)
+			}
+		})
+	}
+}
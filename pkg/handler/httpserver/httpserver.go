@@ -0,0 +1,167 @@
+package httpserver
+
+import(
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"crypto/tls"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/pkg/handler/router"
+)
+
+var childLogger = log.With().Str("handler", "httpserver").Logger()
+
+// HttpServer serves the routes over net/http, used outside the Lambda runtime (ECS, local)
+type HttpServer struct {
+	Router				*router.Router
+	ConfigHttpServer	*model.ConfigHttpServer
+}
+
+func NewHttpServer(	router 				*router.Router,
+					configHttpServer 	*model.ConfigHttpServer ) *HttpServer {
+	childLogger.Debug().Msg("NewHttpServer")
+
+	return &HttpServer{
+		Router: router,
+		ConfigHttpServer: configHttpServer,
+	}
+}
+
+// StartHttpServer listens until the ctx is done, then waits the in flight requests up to the shutdown timeout
+func (h *HttpServer) StartHttpServer(ctx context.Context) error {
+	childLogger.Debug().Msg("StartHttpServer")
+
+	requestTimeout := time.Duration(h.ConfigHttpServer.RequestTimeout) * time.Second
+	timeoutBody := erro.ProblemResponse(ctx, erro.ErrTimeout).Body
+
+	srv := &http.Server{
+		Addr: ":" + strconv.Itoa(h.ConfigHttpServer.Port),
+		Handler: http.TimeoutHandler(http.HandlerFunc(h.ServeHTTP), requestTimeout, timeoutBody),
+		ReadHeaderTimeout: time.Duration(h.ConfigHttpServer.ReadHeaderTimeout) * time.Second,
+		ReadTimeout: time.Duration(h.ConfigHttpServer.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(h.ConfigHttpServer.WriteTimeout) * time.Second,
+		IdleTimeout: time.Duration(h.ConfigHttpServer.IdleTimeout) * time.Second,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	tlsEnabled := h.ConfigHttpServer.TLSCertFile != "" && h.ConfigHttpServer.TLSKeyFile != ""
+	if tlsEnabled {
+		srv.TLSConfig = &tls.Config{ MinVersion: tls.VersionTLS12 }
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		childLogger.Info().Str("addr", srv.Addr).Bool("tls", tlsEnabled).Msg("http server listening")
+		if tlsEnabled {
+			serveErr <- srv.ListenAndServeTLS(h.ConfigHttpServer.TLSCertFile, h.ConfigHttpServer.TLSKeyFile)
+		} else {
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+		case err := <-serveErr:
+			return err
+		case <-ctx.Done():
+	}
+
+	childLogger.Info().Msg("http server shutting down")
+
+	// the ctx is already done, the shutdown has its own deadline
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(h.ConfigHttpServer.ShutdownTimeout) * time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		childLogger.Error().Err(err).Msg("erro Shutdown")
+		return err
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// ServeHTTP converts the request to the shared model.HttpRequest and writes the router response
+func (h *HttpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	childLogger.Debug().Msg("ServeHTTP")
+
+	var httpResponse *model.HttpResponse
+
+	httpRequest, err := h.fromHttpRequest(w, r)
+	if err != nil {
+		childLogger.Error().Err(err).Msg("erro read body")
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			httpResponse = erro.ProblemResponse(r.Context(), erro.ErrPayloadTooLarge)
+		} else {
+			httpResponse = erro.ProblemResponse(r.Context(), erro.ErrBadRequest.Wrap(err))
+		}
+	} else {
+		// continues the trace of the caller (X-Amzn-Trace-Id with the xray propagator)
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		httpResponse = h.Router.Route(ctx, httpRequest)
+	}
+
+	for name, value := range httpResponse.Headers {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set("X-Request-Id", httpRequest.RequestID)
+	w.WriteHeader(httpResponse.StatusCode)
+	io.WriteString(w, httpResponse.Body)
+}
+
+func (h *HttpServer) fromHttpRequest(w http.ResponseWriter, r *http.Request) (model.HttpRequest, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.ConfigHttpServer.MaxBodyBytes))
+	if err != nil {
+		return model.HttpRequest{}, err
+	}
+
+	headers := make(map[string]string, len(r.Header))
+	for name, values := range r.Header {
+		if len(values) > 0 {
+			headers[strings.ToLower(name)] = values[0]
+		}
+	}
+	queryParameters := map[string]string{}
+	for name, values := range r.URL.Query() {
+		if len(values) > 0 {
+			queryParameters[name] = values[0]
+		}
+	}
+
+	sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		sourceIP = r.RemoteAddr
+	}
+
+	requestID := headers["x-request-id"]
+	if requestID == "" {
+		requestID = uuid.New().String()
+	}
+
+	httpRequest := model.HttpRequest{
+		Method: r.Method,
+		Path: r.URL.Path,
+		QueryParameters: queryParameters,
+		Headers: headers,
+		Body: string(body),
+		DomainName: r.Host,
+		SourceIP: sourceIP,
+		UserAgent: r.UserAgent(),
+		RequestID: requestID,
+	}
+	return httpRequest, nil
+}
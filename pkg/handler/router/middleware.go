@@ -0,0 +1,190 @@
+package router
+
+import(
+	"context"
+	"time"
+	"strings"
+	"net/http"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/lambda-go-autentication/pkg/observability"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/usecase/audit"
+	"github.com/lambda-go-autentication/internal/usecase/credential"
+)
+
+// ClaimsFromContext returns the claims of the bearer token validated by the Auth middleware
+func ClaimsFromContext(ctx context.Context) (*model.JwtData, bool) {
+	return credential.ClaimsFromContext(ctx)
+}
+
+// Recovery turns a panic of the handler into a 500, the invocation (and the container) keeps running
+func Recovery() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request model.HttpRequest) (response *model.HttpResponse, err error) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					childLogger.Error().Interface("panic", rec).Str("stack", string(debug.Stack())).Str("request_id", request.RequestID).Msg("erro panic recovered")
+					response, err = erro.ProblemResponse(ctx, erro.ErrInternal), nil
+				}
+			}()
+			return next(ctx, request)
+		}
+	}
+}
+
+// Logging logs one line per request with the status and duration
+func Logging() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+			start := time.Now()
+			response, err := next(ctx, request)
+
+			event := childLogger.Info()
+			if err != nil {
+				event = childLogger.Error().Err(err)
+			}
+			statusCode := http.StatusInternalServerError
+			if response != nil {
+				statusCode = response.StatusCode
+			}
+			event.Str("method", request.Method).
+				Str("resource", request.Resource).
+				Str("path", request.Path).
+				Int("status", statusCode).
+				Dur("duration", time.Since(start)).
+				Str("source_ip", request.SourceIP).
+				Str("request_id", request.RequestID).
+				Msg("request")
+
+			return response, err
+		}
+	}
+}
+
+// Tracing opens a span per request named by the method and the route pattern
+func Tracing() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+			ctx = observability.WithRequestID(ctx, request.RequestID)
+			ctx = observability.WithRoute(ctx, request.Resource)
+			ctx, span := observability.Span(ctx, "router." + request.Method + " " + request.Resource)
+			defer span.End()
+
+			response, err := next(ctx, request)
+
+			span.SetAttributes(	attribute.String("http.method", request.Method),
+								attribute.String("http.route", request.Resource),
+								attribute.String("request_id", request.RequestID))
+			if response != nil {
+				span.SetAttributes(attribute.Int("http.status_code", response.StatusCode))
+				if response.StatusCode >= http.StatusInternalServerError {
+					span.SetStatus(codes.Error, http.StatusText(response.StatusCode))
+				}
+			}
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+
+			return response, err
+		}
+	}
+}
+
+// AuditContext keeps the source ip, the user agent and the request id of the request for the audit events
+func AuditContext() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+			return next(audit.WithRequest(ctx, request), request)
+		}
+	}
+}
+
+// CORS adds the CORS headers when the Origin is allowed ("*" allows any origin), the preflight is answered by the router
+func CORS(allowedOrigins []string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+			response, err := next(ctx, request)
+
+			origin := request.Headers["origin"]
+			if origin == "" || response == nil || !originAllowed(allowedOrigins, origin) {
+				return response, err
+			}
+			if response.Headers == nil {
+				response.Headers = map[string]string{}
+			}
+
+			response.Headers["Access-Control-Allow-Origin"] = origin
+			response.Headers["Vary"] = "Origin"
+			if request.Method == http.MethodOptions && request.Headers["access-control-request-method"] != "" {
+				response.Headers["Access-Control-Allow-Methods"] = response.Headers["Allow"]
+				response.Headers["Access-Control-Allow-Headers"] = "Authorization, Content-Type"
+				response.Headers["Access-Control-Max-Age"] = "600"
+			}
+
+			return response, err
+		}
+	}
+}
+
+func originAllowed(allowedOrigins []string, origin string) bool {
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Auth requires a valid bearer access token with at least one of the scopes informed (any scope when none is informed),
+// the claims are available by ClaimsFromContext
+func Auth(parseAccessToken func(context.Context, string) (*model.JwtData, error), scopes ...string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+			token, found := strings.CutPrefix(request.Headers["authorization"], "Bearer ")
+			if !found || token == "" {
+				return unauthorized(ctx, erro.ErrBearTokenFormad), nil
+			}
+
+			claims, err := parseAccessToken(ctx, token)
+			if err != nil {
+				return unauthorized(ctx, err), nil
+			}
+
+			allowed := len(scopes) == 0
+			for _, scope := range scopes {
+				allowed = allowed || hasScope(claims.Scope, scope)
+			}
+			if !allowed {
+				childLogger.Info().Str("username", claims.Username).Str("resource", request.Resource).Msg("scope required")
+				return erro.ProblemResponse(ctx, erro.ErrScopeRequired), nil
+			}
+
+			ctx = observability.WithSubject(ctx, claims.Username)
+			ctx = audit.WithActor(ctx, claims.Username)
+			return next(credential.WithClaims(ctx, claims), request)
+		}
+	}
+}
+
+func unauthorized(ctx context.Context, err error) *model.HttpResponse {
+	response := erro.ProblemResponse(ctx, err)
+	if response.StatusCode == http.StatusUnauthorized {
+		response.Headers["WWW-Authenticate"] = "Bearer"
+	}
+	return response
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, granted := range scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package router
+
+import (
+	"context"
+	"testing"
+	"net/http"
+	"encoding/json"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+// fakeParseAccessToken accepts the tokens of the map, any other token is invalid
+func fakeParseAccessToken(tokens map[string]*model.JwtData) func(context.Context, string) (*model.JwtData, error) {
+	return func(ctx context.Context, token string) (*model.JwtData, error) {
+		if token == "revoked" {
+			return nil, erro.ErrTokenRevoked
+		}
+		claims, ok := tokens[token]
+		if !ok {
+			return nil, erro.ErrStatusUnauthorized
+		}
+		return claims, nil
+	}
+}
+
+func TestAuth(t *testing.T) {
+	parseAccessToken := fakeParseAccessToken(map[string]*model.JwtData{
+		"admin": { Username: "admin-01", Scope: []string{"auth.admin"} },
+		"user": { Username: "user-01", Scope: []string{"payment.read"} },
+	})
+
+	cases := []struct {
+		name			string
+		authorization	string
+		scopes			[]string
+		wantStatus		int
+		wantCode		string
+		wantUser		string
+	}{
+		{ name: "without authorization", authorization: "", scopes: []string{"auth.admin"}, wantStatus: http.StatusUnauthorized, wantCode: erro.ErrBearTokenFormad.Code },
+		{ name: "not a bearer token", authorization: "Basic YWRtaW4=", scopes: []string{"auth.admin"}, wantStatus: http.StatusUnauthorized, wantCode: erro.ErrBearTokenFormad.Code },
+		{ name: "invalid token", authorization: "Bearer invalid", scopes: []string{"auth.admin"}, wantStatus: http.StatusUnauthorized, wantCode: erro.ErrStatusUnauthorized.Code },
+		{ name: "revoked token", authorization: "Bearer revoked", scopes: []string{"auth.admin"}, wantStatus: http.StatusUnauthorized, wantCode: erro.ErrTokenRevoked.Code },
+		{ name: "without the scope", authorization: "Bearer user", scopes: []string{"auth.admin"}, wantStatus: http.StatusForbidden, wantCode: erro.ErrScopeRequired.Code },
+		{ name: "with the scope", authorization: "Bearer admin", scopes: []string{"auth.admin"}, wantStatus: http.StatusOK, wantUser: "admin-01" },
+		{ name: "with one of the scopes", authorization: "Bearer user", scopes: []string{"auth.admin", "payment.read"}, wantStatus: http.StatusOK, wantUser: "user-01" },
+		{ name: "any scope", authorization: "Bearer user", wantStatus: http.StatusOK, wantUser: "user-01" },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			next := func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+				claims, ok := ClaimsFromContext(ctx)
+				if !ok {
+					t.Fatal("claims not in the context")
+				}
+				return &model.HttpResponse{ StatusCode: http.StatusOK, Body: claims.Username }, nil
+			}
+
+			request := model.HttpRequest{ Headers: map[string]string{} }
+			if c.authorization != "" {
+				request.Headers["authorization"] = c.authorization
+			}
+			response, err := Auth(parseAccessToken, c.scopes...)(next)(context.Background(), request)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if response.StatusCode != c.wantStatus {
+				t.Fatalf("status = %d, want %d", response.StatusCode, c.wantStatus)
+			}
+			if c.wantStatus == http.StatusOK {
+				if response.Body != c.wantUser {
+					t.Errorf("user = %s, want %s", response.Body, c.wantUser)
+				}
+				return
+			}
+
+			var problem model.Problem
+			if err := json.Unmarshal([]byte(response.Body), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Code != c.wantCode {
+				t.Errorf("code = %s, want %s", problem.Code, c.wantCode)
+			}
+			if wantChallenge := c.wantStatus == http.StatusUnauthorized; (response.Headers["WWW-Authenticate"] == "Bearer") != wantChallenge {
+				t.Errorf("WWW-Authenticate = %q", response.Headers["WWW-Authenticate"])
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package router
+
+import(
+	"context"
+	"sort"
+	"strings"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/erro"
+)
+
+var childLogger = log.With().Str("handler", "router").Logger()
+
+// HandlerFunc is the signature of the adapters methods
+type HandlerFunc func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error)
+
+// Middleware wraps a handler, the first one registered is the outermost
+type Middleware func(next HandlerFunc) HandlerFunc
+
+type route struct {
+	method		string
+	pattern		string
+	segments	[]string
+	handler		HandlerFunc
+}
+
+// Router is the routing layer shared by the Lambda events and the standalone http server
+type Router struct {
+	routes		[]route
+	middlewares	[]Middleware
+}
+
+func NewRouter() *Router {
+	childLogger.Debug().Msg("NewRouter")
+
+	return &Router{}
+}
+
+// Use adds middlewares executed on every request, including the 404 and 405 responses
+func (h *Router) Use(middlewares ...Middleware) {
+	h.middlewares = append(h.middlewares, middlewares...)
+}
+
+// Handle registers the handler of a method and pattern (ex: /credentialScope/{id}), the middlewares run only on this route
+func (h *Router) Handle(method string, pattern string, handler HandlerFunc, middlewares ...Middleware) {
+	h.routes = append(h.routes, route{
+		method: method,
+		pattern: pattern,
+		segments: strings.Split(strings.Trim(pattern, "/"), "/"),
+		handler: chain(handler, middlewares),
+	})
+}
+
+func chain(handler HandlerFunc, middlewares []Middleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// MatchResource finds the route pattern of a path and extracts the path parameters
+func (h *Router) MatchResource(path string) (string, map[string]string) {
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for _, route := range h.routes {
+		if len(route.segments) != len(pathSegments) {
+			continue
+		}
+
+		pathParameters := map[string]string{}
+		matched := true
+		for i, segment := range route.segments {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				pathParameters[strings.Trim(segment, "{}")] = pathSegments[i]
+			} else if segment != pathSegments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return route.pattern, pathParameters
+		}
+	}
+
+	return path, nil
+}
+
+// Route resolves the resource (when the event does not inform it) and calls the handler through the middlewares
+func (h *Router) Route(ctx context.Context, request model.HttpRequest) *model.HttpResponse {
+	childLogger.Debug().Msg("Route")
+
+	if request.Resource == "" || !h.hasPattern(request.Resource) {
+		request.Resource, request.PathParameters = h.MatchResource(request.Path)
+	}
+
+	response, err := chain(h.dispatch, h.middlewares)(ctx, request)
+	if err != nil {
+		childLogger.Error().Err(err).Str("method", request.Method).Str("resource", request.Resource).Msg("erro handler")
+	}
+	if response == nil {
+		response = erro.ProblemResponse(ctx, erro.ErrInternal.Wrap(err))
+	}
+
+	return response
+}
+
+func (h *Router) hasPattern(pattern string) bool {
+	for _, route := range h.routes {
+		if route.pattern == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch calls the handler of the method, 404 when the resource is unknown and 405 (with the Allow header) when the method is not registered
+func (h *Router) dispatch(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+	allowed := []string{}
+	for _, route := range h.routes {
+		if route.pattern != request.Resource {
+			continue
+		}
+		if route.method == request.Method {
+			return route.handler(ctx, request)
+		}
+		allowed = append(allowed, route.method)
+	}
+
+	if len(allowed) == 0 {
+		return erro.ProblemResponse(ctx, erro.ErrRouteNotFound), nil
+	}
+
+	allowed = append(allowed, http.MethodOptions)
+	sort.Strings(allowed)
+
+	// the preflight is answered with the allowed methods (the CORS middleware adds its headers)
+	if request.Method == http.MethodOptions {
+		return &model.HttpResponse{
+			StatusCode: http.StatusNoContent,
+			Headers: map[string]string{ "Allow": strings.Join(allowed, ", ") },
+		}, nil
+	}
+
+	response := erro.ProblemResponse(ctx, erro.ErrMethodNotAllowed)
+	response.Headers["Allow"] = strings.Join(allowed, ", ")
+
+	return response, nil
+}
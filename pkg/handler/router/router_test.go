@@ -0,0 +1,127 @@
+package router
+
+import (
+	"context"
+	"testing"
+	"net/http"
+	"encoding/json"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+// echo answers the method, the resource and the id parameter of the route
+func echo(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+	return &model.HttpResponse{ StatusCode: http.StatusOK, Body: request.Method + " " + request.Resource + " " + request.PathParameters["id"] }, nil
+}
+
+func TestRouteDispatch(t *testing.T) {
+	appRouter := NewRouter()
+	appRouter.Handle(http.MethodGet, "/credential/{id}", echo)
+	appRouter.Handle(http.MethodDelete, "/credential/{id}", echo)
+	appRouter.Handle(http.MethodPost, "/login", echo)
+	appRouter.Handle(http.MethodGet, "/info", echo)
+
+	cases := []struct {
+		name		string
+		request		model.HttpRequest
+		wantStatus	int
+		wantBody	string
+		wantAllow	string
+		wantCode	string
+	}{
+		{ name: "static route", request: model.HttpRequest{ Method: http.MethodPost, Path: "/login" }, wantStatus: http.StatusOK, wantBody: "POST /login " },
+		{ name: "path parameter", request: model.HttpRequest{ Method: http.MethodGet, Path: "/credential/007" }, wantStatus: http.StatusOK, wantBody: "GET /credential/{id} 007" },
+		{ name: "second method of the route", request: model.HttpRequest{ Method: http.MethodDelete, Path: "/credential/007/" }, wantStatus: http.StatusOK, wantBody: "DELETE /credential/{id} 007" },
+		{	name: "resource informed by the event", request: model.HttpRequest{ Method: http.MethodGet, Path: "/prod/credential/007", Resource: "/credential/{id}", PathParameters: map[string]string{"id": "007"} },
+			wantStatus: http.StatusOK, wantBody: "GET /credential/{id} 007" },
+		{ name: "unknown path", request: model.HttpRequest{ Method: http.MethodGet, Path: "/credential/007/scope" }, wantStatus: http.StatusNotFound, wantCode: erro.ErrRouteNotFound.Code },
+		{ name: "unknown proxy resource matched by path", request: model.HttpRequest{ Method: http.MethodGet, Path: "/info", Resource: "/{proxy+}" }, wantStatus: http.StatusOK, wantBody: "GET /info " },
+		{ name: "method not allowed", request: model.HttpRequest{ Method: http.MethodPut, Path: "/credential/007" }, wantStatus: http.StatusMethodNotAllowed, wantAllow: "DELETE, GET, OPTIONS", wantCode: erro.ErrMethodNotAllowed.Code },
+		{ name: "method not allowed on a static route", request: model.HttpRequest{ Method: http.MethodGet, Path: "/login" }, wantStatus: http.StatusMethodNotAllowed, wantAllow: "OPTIONS, POST", wantCode: erro.ErrMethodNotAllowed.Code },
+		{ name: "preflight", request: model.HttpRequest{ Method: http.MethodOptions, Path: "/credential/007" }, wantStatus: http.StatusNoContent, wantAllow: "DELETE, GET, OPTIONS" },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			response := appRouter.Route(context.Background(), c.request)
+
+			if response.StatusCode != c.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", response.StatusCode, c.wantStatus, response.Body)
+			}
+			if c.wantBody != "" && response.Body != c.wantBody {
+				t.Errorf("body = %q, want %q", response.Body, c.wantBody)
+			}
+			if response.Headers["Allow"] != c.wantAllow {
+				t.Errorf("Allow = %q, want %q", response.Headers["Allow"], c.wantAllow)
+			}
+			if c.wantCode == "" {
+				return
+			}
+			if response.Headers["Content-Type"] != erro.ContentTypeProblem {
+				t.Errorf("content type = %s, want %s", response.Headers["Content-Type"], erro.ContentTypeProblem)
+			}
+			var problem model.Problem
+			if err := json.Unmarshal([]byte(response.Body), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Code != c.wantCode || problem.Status != c.wantStatus {
+				t.Errorf("problem = %s %d, want %s %d", problem.Code, problem.Status, c.wantCode, c.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRouteMiddlewares(t *testing.T) {
+	order := []string{}
+	tag := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+				order = append(order, name)
+				return next(ctx, request)
+			}
+		}
+	}
+
+	appRouter := NewRouter()
+	appRouter.Use(tag("first"), tag("second"))
+	appRouter.Handle(http.MethodGet, "/info", echo, tag("route"))
+
+	cases := []struct {
+		name		string
+		path		string
+		want		[]string
+	}{
+		{ name: "route middlewares after the shared ones", path: "/info", want: []string{"first", "second", "route"} },
+		// the shared middlewares (ex: cors, request id) also run on the 404
+		{ name: "unknown route", path: "/unknown", want: []string{"first", "second"} },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			order = []string{}
+			appRouter.Route(context.Background(), model.HttpRequest{ Method: http.MethodGet, Path: c.path })
+			if len(order) != len(c.want) {
+				t.Fatalf("middlewares = %v, want %v", order, c.want)
+			}
+			for i := range order {
+				if order[i] != c.want[i] {
+					t.Errorf("middlewares = %v, want %v", order, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteHandlerError(t *testing.T) {
+	appRouter := NewRouter()
+	appRouter.Handle(http.MethodGet, "/info", func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+		return nil, erro.ErrQuery
+	})
+
+	// a handler without response answers 500, the cause is only logged
+	response := appRouter.Route(context.Background(), model.HttpRequest{ Method: http.MethodGet, Path: "/info" })
+	if response.StatusCode != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", response.StatusCode)
+	}
+}
@@ -0,0 +1,49 @@
+package router
+
+import(
+	"context"
+	"net/http"
+
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/usecase/credential"
+
+	adapter_credential "github.com/lambda-go-autentication/internal/usecase/credential/adapter"
+	adapter_jwt "github.com/lambda-go-autentication/internal/usecase/jwt/adapter"
+	adapter_audit "github.com/lambda-go-autentication/internal/usecase/audit/adapter"
+)
+
+// RegisterRoutes registers the routes of the adapters, the same for every event source.
+// The administrative routes require a token (issued by this service) with auth.admin or the scope of the route
+func (h *Router) RegisterRoutes(	adapterCredential 	*adapter_credential.AdapterCredential,
+									adapterJwt 			*adapter_jwt.AdapterJwt,
+									adapterAudit		*adapter_audit.AdapterAudit,
+									parseAccessToken	func(context.Context, string) (*model.JwtData, error)) {
+	childLogger.Debug().Msg("RegisterRoutes")
+
+	admin := func(scope string) Middleware {
+		return Auth(parseAccessToken, credential.ScopeAdmin, scope)
+	}
+
+	h.Handle(http.MethodPost, "/login", adapterCredential.Login)
+	h.Handle(http.MethodPost, "/loginRSA", adapterCredential.LoginRSA)
+	h.Handle(http.MethodPost, "/signIn", adapterCredential.SignIn, admin(credential.ScopeUserWrite)) // Create a new credentials
+	h.Handle(http.MethodPost, "/addScope", adapterCredential.AddScope, admin(credential.ScopeScopeWrite)) // Add scopes to the credential
+	h.Handle(http.MethodGet, "/credentialScope/{id}", adapterCredential.QueryCredentialScope, admin(credential.ScopeScopeRead)) // Query the scopes associated with credential
+	h.Handle(http.MethodPost, "/resourceServer", adapterCredential.AddResourceServer, admin(credential.ScopeResourceWrite)) // Register a resource server (audience) and its accepted scopes
+	h.Handle(http.MethodGet, "/resourceServer/{id}", adapterCredential.QueryResourceServer, admin(credential.ScopeResourceRead)) // Query a registered resource server
+	h.Handle(http.MethodGet, "/userinfo", adapterCredential.UserInfo) // OIDC profile claims of the bearer access token
+	h.Handle(http.MethodPost, "/revokeToken", adapterCredential.RevokeToken) // Revoke the bearer access token
+	h.Handle(http.MethodGet, "/info", func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+		return adapterCredential.GetInfo(ctx)
+	}, admin(credential.ScopeInfoRead))
+	h.Handle(http.MethodGet, "/audit/{id}", adapterAudit.QueryEvents, admin(credential.ScopeAuditRead)) // Recent audit events of the user, ?limit=20
+
+	h.Handle(http.MethodPost, "/refreshToken", adapterJwt.RefreshToken)
+	h.Handle(http.MethodPost, "/refreshTokenRSA", adapterJwt.RefreshTokenRSA)
+	h.Handle(http.MethodPost, "/tokenValidation", adapterJwt.TokenValidation) // Do a JWT validation (signature and expiration date)
+	h.Handle(http.MethodPost, "/tokenValidationRSA", adapterJwt.TokenValidationRSA)
+	h.Handle(http.MethodGet, "/.well-known/openid-configuration", adapterJwt.OpenIDConfiguration) // OIDC discovery document
+	h.Handle(http.MethodGet, "/.well-known/jwks.json", func(ctx context.Context, request model.HttpRequest) (*model.HttpResponse, error) {
+		return adapterJwt.JWKS(ctx) // Public keys used to verify the asymetric tokens
+	})
+}
@@ -0,0 +1,178 @@
+package observability
+
+import(
+	"io"
+	"sync"
+	"context"
+	"strings"
+	"encoding/json"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// EMFExporter writes the metrics as CloudWatch Embedded Metric Format lines (one json per metric and attribute set),
+// CloudWatch Logs extracts them from the Lambda log group, no collector is needed.
+// The dimensions are the env of the resource and the attributes of the data point (ex: route, alg, usage_plan)
+type EMFExporter struct {
+	mu			sync.Mutex
+	writer		io.Writer
+	namespace	string
+}
+
+type emfMetadata struct {
+	Timestamp			int64				`json:"Timestamp"`
+	CloudWatchMetrics	[]emfDirective		`json:"CloudWatchMetrics"`
+}
+
+type emfDirective struct {
+	Namespace	string			`json:"Namespace"`
+	Dimensions	[][]string		`json:"Dimensions"`
+	Metrics		[]emfMetric		`json:"Metrics"`
+}
+
+type emfMetric struct {
+	Name	string	`json:"Name"`
+	Unit	string	`json:"Unit"`
+}
+
+// emfDistribution is the value of a histogram, CloudWatch computes the statistics from the values and their counts
+type emfDistribution struct {
+	Values	[]float64	`json:"Values"`
+	Counts	[]uint64	`json:"Counts"`
+}
+
+func NewEMFExporter(writer io.Writer, namespace string) *EMFExporter {
+	return &EMFExporter{
+		writer: writer,
+		namespace: namespace,
+	}
+}
+
+// Temporality is delta, each line has the values since the previous export (the end of the previous invocation)
+func (e *EMFExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return metricdata.DeltaTemporality
+}
+
+func (e *EMFExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+func (e *EMFExporter) Export(ctx context.Context, resourceMetrics *metricdata.ResourceMetrics) error {
+	env, _ := resourceMetrics.Resource.Set().Value("env")
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, scopeMetrics := range resourceMetrics.ScopeMetrics {
+		for _, m := range scopeMetrics.Metrics {
+			unit := emfUnit(m.Unit)
+			switch data := m.Data.(type) {
+				case metricdata.Sum[int64]:
+					for _, point := range data.DataPoints {
+						if err := e.write(m.Name, unit, env.AsString(), point.Attributes, point.Time.UnixMilli(), point.Value); err != nil {
+							return err
+						}
+					}
+				case metricdata.Sum[float64]:
+					for _, point := range data.DataPoints {
+						if err := e.write(m.Name, unit, env.AsString(), point.Attributes, point.Time.UnixMilli(), point.Value); err != nil {
+							return err
+						}
+					}
+				case metricdata.Gauge[float64]:
+					for _, point := range data.DataPoints {
+						if err := e.write(m.Name, unit, env.AsString(), point.Attributes, point.Time.UnixMilli(), point.Value); err != nil {
+							return err
+						}
+					}
+				case metricdata.Histogram[float64]:
+					for _, point := range data.DataPoints {
+						if point.Count == 0 {
+							continue
+						}
+						if err := e.write(m.Name, unit, env.AsString(), point.Attributes, point.Time.UnixMilli(), distribution(point)); err != nil {
+							return err
+						}
+					}
+			}
+		}
+	}
+	return nil
+}
+
+func (e *EMFExporter) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+func (e *EMFExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// write marshals one EMF line, the dimensions and the metric are root members of the json
+func (e *EMFExporter) write(name string, unit string, env string, attributes attribute.Set, timestamp int64, value interface{}) error {
+	line := map[string]interface{}{}
+	dimensions := []string{}
+	if env != "" {
+		line["env"] = env
+		dimensions = append(dimensions, "env")
+	}
+	for iter := attributes.Iter(); iter.Next(); {
+		kv := iter.Attribute()
+		line[string(kv.Key)] = kv.Value.Emit()
+		dimensions = append(dimensions, string(kv.Key))
+	}
+
+	line[name] = value
+	line["_aws"] = emfMetadata{
+		Timestamp: timestamp,
+		CloudWatchMetrics: []emfDirective{{
+			Namespace: e.namespace,
+			Dimensions: [][]string{dimensions},
+			Metrics: []emfMetric{{Name: name, Unit: unit}},
+		}},
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = e.writer.Write(append(data, '\n'))
+	return err
+}
+
+// distribution represents each bucket by its upper bound (the max for the last one), the empty buckets are skipped
+func distribution(point metricdata.HistogramDataPoint[float64]) emfDistribution {
+	max, hasMax := point.Max.Value()
+
+	values := emfDistribution{}
+	for i, count := range point.BucketCounts {
+		if count == 0 {
+			continue
+		}
+		value := max
+		if i < len(point.Bounds) && (!hasMax || point.Bounds[i] < max) {
+			value = point.Bounds[i]
+		}
+		values.Values = append(values.Values, value)
+		values.Counts = append(values.Counts, count)
+	}
+	return values
+}
+
+// emfUnit maps the UCUM units of the instruments to the CloudWatch units, the annotations ({login}) are counts
+func emfUnit(unit string) string {
+	switch {
+		case unit == "s":
+			return "Seconds"
+		case unit == "ms":
+			return "Milliseconds"
+		case unit == "By":
+			return "Bytes"
+		case unit == "1" || strings.HasPrefix(unit, "{"):
+			return "Count"
+		default:
+			return "None"
+	}
+}
@@ -0,0 +1,167 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"reflect"
+	"strings"
+	"encoding/json"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// emfLine is an EMF line, the dimensions and the value are root members read from the raw json
+type emfLine struct {
+	AWS		emfMetadata	`json:"_aws"`
+	raw		map[string]interface{}
+}
+
+func parseEMF(t *testing.T, output string) map[string]emfLine {
+	t.Helper()
+
+	lines := map[string]emfLine{}
+	for _, text := range strings.Split(strings.TrimSpace(output), "\n") {
+		line := emfLine{}
+		if err := json.Unmarshal([]byte(text), &line); err != nil {
+			t.Fatalf("invalid EMF line %s: %v", text, err)
+		}
+		if err := json.Unmarshal([]byte(text), &line.raw); err != nil {
+			t.Fatal(err)
+		}
+		if len(line.AWS.CloudWatchMetrics) != 1 || len(line.AWS.CloudWatchMetrics[0].Metrics) != 1 {
+			t.Fatalf("EMF line without one directive and one metric: %s", text)
+		}
+		lines[line.AWS.CloudWatchMetrics[0].Metrics[0].Name] = line
+	}
+	return lines
+}
+
+func TestEMFExporterMetrics(t *testing.T) {
+	var output bytes.Buffer
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(NewEMFExporter(&output, "auth-test"))),
+		sdkmetric.WithResource(resource.NewSchemaless(attribute.String("env", "dev"))),
+	)
+	otel.SetMeterProvider(provider)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	ctx := WithUsagePlan(WithRoute(context.Background(), "/login"), "gold")
+	RecordLogin(ctx, LoginSuccess)
+	RecordLogin(ctx, LoginSuccess)
+	RecordLoginLockout(ctx)
+	RecordTokenIssued(ctx, "RS256", GrantPassword, "access-rsa")
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		metric			string
+		unit			string
+		value			float64
+		dimensions		[]string
+		attributes		map[string]string
+	}{
+		{	metric: "auth.login", unit: "Count", value: 2,
+			dimensions: []string{"env", "outcome", "route", "usage_plan"},
+			attributes: map[string]string{ "env": "dev", "outcome": "success", "route": "/login", "usage_plan": "gold" } },
+		{	metric: "auth.login.lockout", unit: "Count", value: 1,
+			dimensions: []string{"env", "route", "usage_plan"},
+			attributes: map[string]string{ "env": "dev", "route": "/login", "usage_plan": "gold" } },
+		{	metric: "auth.token.issued", unit: "Count", value: 1,
+			dimensions: []string{"env", "alg", "grant", "route", "token_use", "usage_plan"},
+			attributes: map[string]string{ "env": "dev", "alg": "RS256", "grant": "password", "route": "/login", "token_use": "access-rsa", "usage_plan": "gold" } },
+	}
+
+	lines := parseEMF(t, output.String())
+	for _, c := range cases {
+		t.Run(c.metric, func(t *testing.T) {
+			line, ok := lines[c.metric]
+			if !ok {
+				t.Fatalf("no EMF line of %s in %s", c.metric, output.String())
+			}
+			directive := line.AWS.CloudWatchMetrics[0]
+			if directive.Namespace != "auth-test" {
+				t.Errorf("namespace = %s, want auth-test", directive.Namespace)
+			}
+			if directive.Metrics[0].Unit != c.unit {
+				t.Errorf("unit = %s, want %s", directive.Metrics[0].Unit, c.unit)
+			}
+			if line.AWS.Timestamp == 0 {
+				t.Error("the timestamp is missing")
+			}
+			if len(directive.Dimensions) != 1 || !reflect.DeepEqual(directive.Dimensions[0], c.dimensions) {
+				t.Errorf("dimensions = %v, want [%v]", directive.Dimensions, c.dimensions)
+			}
+			// each dimension is a root member of the line
+			for name, want := range c.attributes {
+				if got := line.raw[name]; got != want {
+					t.Errorf("%s = %v, want %s", name, got, want)
+				}
+			}
+			if got := line.raw[c.metric]; got != c.value {
+				t.Errorf("value = %v, want %v", got, c.value)
+			}
+		})
+	}
+}
+
+func TestEMFExporterHistogram(t *testing.T) {
+	var output bytes.Buffer
+	exporter := NewEMFExporter(&output, "auth-test")
+
+	resourceMetrics := &metricdata.ResourceMetrics{
+		Resource: resource.NewSchemaless(),
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Metrics: []metricdata.Metrics{{
+				Name: "db.client.operation.duration",
+				Unit: "s",
+				Data: metricdata.Histogram[float64]{
+					Temporality: metricdata.DeltaTemporality,
+					DataPoints: []metricdata.HistogramDataPoint[float64]{
+						{	Attributes: attribute.NewSet(attribute.String("db.operation.name", "Query")),
+							Count: 3,
+							Bounds: []float64{0.01, 0.1, 1},
+							BucketCounts: []uint64{2, 0, 1, 0},
+							Max: metricdata.NewExtrema(0.4) },
+						// a point without values in the interval is not written
+						{	Attributes: attribute.NewSet(attribute.String("db.operation.name", "PutItem")),
+							Bounds: []float64{0.01, 0.1, 1},
+							BucketCounts: []uint64{0, 0, 0, 0} },
+					},
+				},
+			}},
+		}},
+	}
+	if err := exporter.Export(context.Background(), resourceMetrics); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(output.String(), "\n"); lines != 1 {
+		t.Fatalf("lines = %d, want 1: %s", lines, output.String())
+	}
+	line := parseEMF(t, output.String())["db.client.operation.duration"]
+	directive := line.AWS.CloudWatchMetrics[0]
+	if directive.Metrics[0].Unit != "Seconds" {
+		t.Errorf("unit = %s, want Seconds", directive.Metrics[0].Unit)
+	}
+	// without the env of the resource the only dimension is the attribute
+	if !reflect.DeepEqual(directive.Dimensions, [][]string{{"db.operation.name"}}) {
+		t.Errorf("dimensions = %v", directive.Dimensions)
+	}
+
+	data, _ := json.Marshal(line.raw["db.client.operation.duration"])
+	var got emfDistribution
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	// the last filled bucket is represented by the max, under its upper bound
+	want := emfDistribution{ Values: []float64{0.01, 0.4}, Counts: []uint64{2, 1} }
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("distribution = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,204 @@
+package observability
+
+import(
+	"os"
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/lambda-go-autentication/internal/model"
+	"github.com/lambda-go-autentication/internal/erro"
+
+	"github.com/aws/smithy-go/middleware"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+)
+
+// login outcomes, an unknown user, a bad password and a locked credential are the same error for the client but not for the metric
+const (
+	LoginSuccess		= "success"
+	LoginBadPassword	= "bad_password"
+	LoginLocked			= "locked"
+	LoginNotFound		= "not_found"
+)
+
+// grants of the issued tokens
+const (
+	GrantPassword		= "password"
+	GrantRefreshToken	= "refresh_token"
+)
+
+// the instruments are created on the global provider, they are bound to the MeterProvider once otel.SetMeterProvider is called
+var (
+	meter = otel.Meter("github.com/lambda-go-autentication")
+
+	loginCounter, _ = meter.Int64Counter("auth.login",
+		metric.WithDescription("logins by outcome"),
+		metric.WithUnit("{login}"))
+	lockoutCounter, _ = meter.Int64Counter("auth.login.lockout",
+		metric.WithDescription("credentials locked after repeated failed logins"),
+		metric.WithUnit("{lockout}"))
+	tokenCounter, _ = meter.Int64Counter("auth.token.issued",
+		metric.WithDescription("tokens issued by algorithm, grant and token use"),
+		metric.WithUnit("{token}"))
+	validationCounter, _ = meter.Int64Counter("auth.token.validation",
+		metric.WithDescription("token validations by result"),
+		metric.WithUnit("{validation}"))
+	refreshCounter, _ = meter.Int64Counter("auth.token.refresh",
+		metric.WithDescription("token refreshes by result"),
+		metric.WithUnit("{refresh}"))
+	rehashCounter, _ = meter.Int64Counter("auth.password.rehash",
+		metric.WithDescription("plain text passwords hashed on login by result"),
+		metric.WithUnit("{password}"))
+	dbDuration, _ = meter.Float64Histogram("db.client.operation.duration",
+		metric.WithDescription("duration of the DynamoDB calls"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5))
+	coldStartGauge, _ = meter.Float64Gauge("faas.cold_start.duration",
+		metric.WithDescription("time from the process start to the first request ready"),
+		metric.WithUnit("s"))
+)
+
+type routeKey struct{}
+type usagePlanKey struct{}
+
+// WithRoute keeps the route pattern (ex: /oauth_credential) as an attribute of the metrics recorded below
+func WithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// WithUsagePlan keeps the usage plan of the client as an attribute of the metrics recorded below
+func WithUsagePlan(ctx context.Context, usagePlan string) context.Context {
+	return context.WithValue(ctx, usagePlanKey{}, usagePlan)
+}
+
+// NewMeterProvider exports the metrics with the resource attributes of the traces, by METRICS_EXPORTER:
+// otel to the same collector (OTEL_EXPORTER_OTLP_ENDPOINT) or emf as CloudWatch EMF lines on stdout
+func NewMeterProvider(ctx context.Context, configOTEL *model.ConfigOTEL, infoApp *model.InfoApp) *sdkmetric.MeterProvider {
+	log.Debug().Msg("NewMeterProvider")
+
+	var exporter sdkmetric.Exporter
+	var err error
+	if configOTEL.MetricsExporter == "emf" {
+		namespace := configOTEL.MetricsNamespace
+		if namespace == "" {
+			namespace = infoApp.AppName
+		}
+		exporter = NewEMFExporter(os.Stdout, namespace)
+	} else {
+		exporter, err = otlpmetricgrpc.New(
+			ctx,
+			otlpmetricgrpc.WithInsecure(),
+			otlpmetricgrpc.WithEndpoint(configOTEL.OtelExportEndpoint),
+		)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to create OTEL metric exporter")
+		}
+	}
+
+	resources, err := buildResources(ctx, infoApp)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load OTEL resource")
+	}
+
+	// the Lambda may be frozen before an interval ends, the handler calls ForceFlush at the end of each invocation
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(30 * time.Second))),
+		sdkmetric.WithResource(resources),
+	)
+	return mp
+}
+
+// result is success or the code of the error (ex: token_expired)
+func result(err error) string {
+	if err == nil {
+		return "success"
+	}
+	return erro.As(err).Code
+}
+
+// contextAttributes adds the route and the usage plan kept in ctx, when informed
+func contextAttributes(ctx context.Context, attributes ...attribute.KeyValue) metric.MeasurementOption {
+	if route, ok := ctx.Value(routeKey{}).(string); ok && route != "" {
+		attributes = append(attributes, attribute.String("route", route))
+	}
+	if usagePlan, ok := ctx.Value(usagePlanKey{}).(string); ok && usagePlan != "" {
+		attributes = append(attributes, attribute.String("usage_plan", usagePlan))
+	}
+	return metric.WithAttributes(attributes...)
+}
+
+func RecordLogin(ctx context.Context, outcome string) {
+	loginCounter.Add(ctx, 1, contextAttributes(ctx, attribute.String("outcome", outcome)))
+}
+
+// RecordLoginLockout counts the credentials locked, the logins refused during the lock are auth.login with the outcome locked
+func RecordLoginLockout(ctx context.Context) {
+	lockoutCounter.Add(ctx, 1, contextAttributes(ctx))
+}
+
+func RecordTokenIssued(ctx context.Context, alg string, grant string, tokenUse string) {
+	tokenCounter.Add(ctx, 1, contextAttributes(ctx,	attribute.String("alg", alg),
+													attribute.String("grant", grant),
+													attribute.String("token_use", tokenUse)))
+}
+
+func RecordValidation(ctx context.Context, alg string, err error) {
+	validationCounter.Add(ctx, 1, contextAttributes(ctx,	attribute.String("alg", alg),
+															attribute.String("result", result(err))))
+}
+
+func RecordRefresh(ctx context.Context, alg string, err error) {
+	refreshCounter.Add(ctx, 1, contextAttributes(ctx,	attribute.String("alg", alg),
+														attribute.String("result", result(err))))
+}
+
+// RecordPasswordRehash counts the logins still matched against a plain text password, once the hash is stored they stop
+func RecordPasswordRehash(ctx context.Context, err error) {
+	rehashCounter.Add(ctx, 1, contextAttributes(ctx, attribute.String("result", result(err))))
+}
+
+func RecordColdStart(ctx context.Context, duration time.Duration) {
+	coldStartGauge.Record(ctx, duration.Seconds())
+}
+
+// DynamoDBMetrics is an aws client option (APIOptions) that records the duration of each call by operation
+func DynamoDBMetrics(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("DynamoDBMetrics",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			start := time.Now()
+			out, metadata, err := next.HandleInitialize(ctx, in)
+
+			dbDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+				attribute.String("db.system", "dynamodb"),
+				attribute.String("db.operation.name", awsmiddleware.GetOperationName(ctx)),
+				attribute.Bool("error", err != nil)))
+
+			return out, metadata, err
+		}), middleware.After)
+}
+
+type flusher interface {
+	ForceFlush(ctx context.Context) error
+}
+
+type flushers []flusher
+
+func (f flushers) ForceFlush(ctx context.Context) error {
+	for _, provider := range f {
+		if err := provider.ForceFlush(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flushers flushes the traces and the metrics at the end of each Lambda invocation (otellambda.WithFlusher)
+func Flushers(providers ...flusher) flusher {
+	return flushers(providers)
+}
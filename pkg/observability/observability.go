@@ -5,6 +5,7 @@ import(
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/lambda-go-autentication/internal/model"
     
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
@@ -13,26 +14,57 @@ import(
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/sdk/resource"
 )
 
 var authOption otlptracegrpc.Option
 
-func Span(ctx context.Context, spanName string) trace.Span {
-	cID, rID := "unknown", "unknown"
+type requestIDKey struct{}
+type subjectKey struct{}
+
+// WithRequestID keeps the request id (APIGW, ALB or X-Request-Id) for the spans opened below
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// WithSubject keeps the authenticated user for the spans opened below and adds it to the current span
+func WithSubject(ctx context.Context, subject string) context.Context {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("user_id", subject))
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// Span opens a child span of the span in ctx, the returned ctx must be passed to the calls below
+// (ex: the aws clients) so their spans are nested
+func Span(ctx context.Context, spanName string) (context.Context, trace.Span) {
+	attributes := []attribute.KeyValue{}
+	if requestID, ok := ctx.Value(requestIDKey{}).(string); ok && requestID != "" {
+		attributes = append(attributes, attribute.String("request_id", requestID))
+	}
+	if lambdaContext, ok := lambdacontext.FromContext(ctx); ok {
+		attributes = append(attributes, attribute.String("faas.invocation_id", lambdaContext.AwsRequestID))
+	}
+	if subject, ok := ctx.Value(subjectKey{}).(string); ok && subject != "" {
+		attributes = append(attributes, attribute.String("user_id", subject))
+	}
 
 	tracer := otel.GetTracerProvider().Tracer("go.opentelemetry.io/otel")
-	_, span := tracer.Start(
+	return tracer.Start(
 		ctx,
 		spanName,
-		trace.WithSpanKind(trace.SpanKindConsumer),
-		trace.WithAttributes(
-			attribute.String("user_id", cID),
-			attribute.String("request_id", rID)),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attributes...),
 	)
+}
 
-	return span
+// SpanError records the error and the error status on the span, nil is ignored
+func SpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
 }
 
 func Attributes(ctx context.Context, infoApp *model.InfoApp) []attribute.KeyValue {
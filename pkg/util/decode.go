@@ -0,0 +1,35 @@
+package util
+
+import(
+	"io"
+	"errors"
+	"strings"
+	"encoding/json"
+
+	"github.com/lambda-go-autentication/internal/erro"
+)
+
+// MaxRequestBody is the largest json body accepted by the adapters
+const MaxRequestBody = 16 << 10
+
+// DecodeRequest decodes a json body into the request DTO rejecting unknown fields, trailing data and bodies
+// larger than MaxRequestBody, then validates it. The body is already base64 decoded by the handlers
+func DecodeRequest(body string, request interface{}) error {
+	if len(body) > MaxRequestBody {
+		return erro.ErrPayloadTooLarge
+	}
+	if strings.TrimSpace(body) == "" {
+		return erro.ErrBadRequest.WithMessage("request body is empty")
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		return erro.ErrBadRequest.WithMessage(err.Error())
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return erro.ErrBadRequest.WithMessage("unexpected data after the json body")
+	}
+
+	return Validate(request)
+}
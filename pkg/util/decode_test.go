@@ -0,0 +1,68 @@
+package util
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lambda-go-autentication/internal/erro"
+)
+
+func TestDecodeRequest(t *testing.T) {
+	cases := []struct {
+		name		string
+		body		string
+		want		validateRequest
+		wantErr		error
+		wantMessage	string
+	}{
+		{ name: "valid", body: `{"user":"user-01","scope":["a.read"]}`, want: validateRequest{ User: "user-01", Scope: []string{"a.read"} } },
+		{ name: "surrounding spaces", body: " \n{\"user\":\"user-01\"}\n ", want: validateRequest{ User: "user-01" } },
+		{ name: "empty body", body: "  ", wantErr: erro.ErrBadRequest, wantMessage: "empty" },
+		{ name: "unknown field", body: `{"user":"user-01","ID":"USER-admin"}`, wantErr: erro.ErrBadRequest, wantMessage: "unknown field" },
+		{ name: "trailing data", body: `{"user":"user-01"}{"user":"admin"}`, wantErr: erro.ErrBadRequest, wantMessage: "after the json body" },
+		{ name: "trailing garbage", body: `{"user":"user-01"} x`, wantErr: erro.ErrBadRequest },
+		{ name: "invalid json", body: `{"user":`, wantErr: erro.ErrBadRequest },
+		{ name: "wrong type", body: `{"user":7}`, wantErr: erro.ErrBadRequest },
+		{ name: "size limit", body: `{"user":"` + strings.Repeat("a", MaxRequestBody) + `"}`, wantErr: erro.ErrPayloadTooLarge },
+		{ name: "validated", body: `{"user":"ab"}`, wantErr: erro.ErrValidation },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var request validateRequest
+			err := DecodeRequest(c.body, &request)
+			if c.wantErr != nil {
+				if !errors.Is(err, c.wantErr) {
+					t.Fatalf("DecodeRequest error = %v, want %v", err, c.wantErr)
+				}
+				if c.wantMessage != "" && !strings.Contains(erro.As(err).Message, c.wantMessage) {
+					t.Errorf("message = %s, want it to contain %s", erro.As(err).Message, c.wantMessage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if request.User != c.want.User || len(request.Scope) != len(c.want.Scope) {
+				t.Errorf("request = %+v, want %+v", request, c.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRequestLimit(t *testing.T) {
+	// the limit is on the body, a body of exactly MaxRequestBody bytes is accepted
+	padding := MaxRequestBody - len(`{"user":"user-01"}`)
+	body := `{"user":"user-01"}` + strings.Repeat(" ", padding)
+	if len(body) != MaxRequestBody {
+		t.Fatalf("body = %d bytes", len(body))
+	}
+	var request validateRequest
+	if err := DecodeRequest(body, &request); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecodeRequest(body + " ", &request); !errors.Is(err, erro.ErrPayloadTooLarge) {
+		t.Errorf("DecodeRequest error = %v, want %v", err, erro.ErrPayloadTooLarge)
+	}
+}
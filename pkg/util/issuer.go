@@ -0,0 +1,13 @@
+package util
+
+import(
+	"strings"
+
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+// GetIssuerURL returns the configured issuer (ISSUER_URL, required by configs.Validate). It is never built from
+// the request, the Host header would let the caller choose the iss of the tokens and the jwks_uri of the discovery
+func GetIssuerURL(infoApp *model.InfoApp) string {
+	return strings.TrimSuffix(infoApp.IssuerURL, "/")
+}
@@ -0,0 +1,169 @@
+package util
+
+import(
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+// formats of the validate tag, applied to a string or to each item of a []string
+var validateFormats = map[string]*regexp.Regexp{
+	"username":	regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@+-]*$`),
+	"scope":	regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:/-]{0,63}$`),
+	"audience":	regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:/-]*$`),
+}
+
+// Validate checks the validate tags of a struct (pointer) and returns erro.ErrValidation with one error per field.
+// Rules: required, min=N and max=N (string length or number of items), oneof=A B, and the formats username, scope, audience.
+// The rules other than required are skipped on empty values. An unknown rule (or a min/max that is not a number) is a bug
+// of the tag, it returns erro.ErrInternal and never skips the rule
+func Validate(request interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(request))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := []model.FieldError{}
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		rules := field.Tag.Get("validate")
+		if rules == "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		message, err := validateField(value.Field(i), rules)
+		if err != nil {
+			return erro.ErrInternal.Wrap(fmt.Errorf("validate tag of %s.%s: %w", value.Type().Name(), field.Name, err))
+		}
+		if message != "" {
+			fields = append(fields, model.FieldError{Field: name, Message: message})
+		}
+	}
+
+	if len(fields) > 0 {
+		return erro.ErrValidation.WithFields(fields)
+	}
+	return nil
+}
+
+// ValidateVar checks a single value (ex: a path parameter) with the same rules
+func ValidateVar(name string, value string, rules string) error {
+	message, err := validateField(reflect.ValueOf(value), rules)
+	if err != nil {
+		return erro.ErrInternal.Wrap(fmt.Errorf("validate rules of %s: %w", name, err))
+	}
+	if message != "" {
+		return erro.ErrValidation.WithFields([]model.FieldError{{Field: name, Message: message}})
+	}
+	return nil
+}
+
+// checkRules refuses the unknown rules and the invalid parameters, they are checked before the value
+func checkRules(rules string) error {
+	for _, rule := range strings.Split(rules, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+			case "required":
+			case "min", "max":
+				if _, err := strconv.Atoi(param); err != nil {
+					return fmt.Errorf("rule %s needs a number: %q", name, rule)
+				}
+			case "oneof":
+				if len(strings.Fields(param)) == 0 {
+					return fmt.Errorf("rule oneof needs the values: %q", rule)
+				}
+			default:
+				if _, ok := validateFormats[name]; !ok {
+					return fmt.Errorf("unknown rule %q", rule)
+				}
+		}
+	}
+	return nil
+}
+
+func validateField(value reflect.Value, rules string) (string, error) {
+	if err := checkRules(rules); err != nil {
+		return "", err
+	}
+
+	var items []string
+	var size int
+	switch value.Kind() {
+		case reflect.String:
+			items = []string{value.String()}
+			size = utf8.RuneCountInString(value.String())
+		case reflect.Slice:
+			for j := 0; j < value.Len(); j++ {
+				items = append(items, value.Index(j).String())
+			}
+			size = value.Len()
+		default:
+			return "", fmt.Errorf("rules on a %s field, only string and []string are validated", value.Kind())
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+
+		if name == "required" {
+			if size == 0 {
+				return "is required", nil
+			}
+			continue
+		}
+		if size == 0 {
+			continue
+		}
+
+		switch name {
+			case "min", "max":
+				limit, _ := strconv.Atoi(param)
+				if name == "min" && size < limit {
+					return "must have at least " + param + " " + unit(value), nil
+				}
+				if name == "max" && size > limit {
+					return "must have at most " + param + " " + unit(value), nil
+				}
+			case "oneof":
+				allowed := strings.Fields(param)
+				for _, item := range items {
+					if !contains(allowed, item) {
+						return "must be one of " + strings.Join(allowed, ", "), nil
+					}
+				}
+			default:
+				format := validateFormats[name]
+				for _, item := range items {
+					if !format.MatchString(item) {
+						return "invalid " + name + " format: " + strconv.Quote(item), nil
+					}
+				}
+		}
+	}
+
+	return "", nil
+}
+
+func unit(value reflect.Value) string {
+	if value.Kind() == reflect.Slice {
+		return "items"
+	}
+	return "characters"
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lambda-go-autentication/internal/erro"
+	"github.com/lambda-go-autentication/internal/model"
+)
+
+type validateRequest struct {
+	User		string		`json:"user" validate:"required,min=3,max=8,username"`
+	Scope		[]string	`json:"scope,omitempty" validate:"max=2,scope"`
+	Alg			string		`json:"alg,omitempty" validate:"oneof=RS256 ES256"`
+	Note		string		`validate:"max=4"`
+	Untagged	string		`json:"untagged"`
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name		string
+		request		validateRequest
+		want		[]model.FieldError
+	}{
+		{ name: "valid", request: validateRequest{ User: "user-01", Scope: []string{"a.read"}, Alg: "ES256" } },
+		{ name: "rules skipped on empty values", request: validateRequest{ User: "user-01" } },
+		{ name: "required", request: validateRequest{}, want: []model.FieldError{{ Field: "user", Message: "is required" }} },
+		{ name: "min characters", request: validateRequest{ User: "ab" }, want: []model.FieldError{{ Field: "user", Message: "must have at least 3 characters" }} },
+		{ name: "max counts runes", request: validateRequest{ User: "éééééééé" }, want: []model.FieldError{{ Field: "user", Message: `invalid username format: "éééééééé"` }} },
+		{ name: "max items", request: validateRequest{ User: "user-01", Scope: []string{"a", "b", "c"} }, want: []model.FieldError{{ Field: "scope", Message: "must have at most 2 items" }} },
+		{ name: "format of each item", request: validateRequest{ User: "user-01", Scope: []string{"a.read", "-bad"} }, want: []model.FieldError{{ Field: "scope", Message: `invalid scope format: "-bad"` }} },
+		{ name: "oneof", request: validateRequest{ User: "user-01", Alg: "HS256" }, want: []model.FieldError{{ Field: "alg", Message: "must be one of RS256, ES256" }} },
+		{ name: "struct field name without json", request: validateRequest{ User: "user-01", Note: "too long" }, want: []model.FieldError{{ Field: "Note", Message: "must have at most 4 characters" }} },
+		{	name: "one error per field", request: validateRequest{ User: "x", Alg: "HS256" },
+			want: []model.FieldError{{ Field: "user", Message: "must have at least 3 characters" }, { Field: "alg", Message: "must be one of RS256, ES256" }} },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := Validate(&c.request)
+			if len(c.want) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, erro.ErrValidation) {
+				t.Fatalf("Validate error = %v, want %v", err, erro.ErrValidation)
+			}
+			if got := erro.As(err).Fields; !reflect.DeepEqual(got, c.want) {
+				t.Errorf("fields = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidRules(t *testing.T) {
+	cases := []struct {
+		name		string
+		request		interface{}
+		want		string
+	}{
+		{ name: "unknown rule", request: &struct{ Name string `validate:"required,email"` }{ Name: "a" }, want: "unknown rule" },
+		{ name: "unknown rule on an empty value", request: &struct{ Name string `validate:"uuid"` }{}, want: "unknown rule" },
+		{ name: "max without a number", request: &struct{ Name string `validate:"max=ten"` }{ Name: "a" }, want: "needs a number" },
+		{ name: "oneof without values", request: &struct{ Name string `validate:"oneof="` }{ Name: "a" }, want: "needs the values" },
+		{ name: "rules on an int", request: &struct{ Size int `validate:"required"` }{}, want: "only string" },
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := Validate(c.request)
+			if !errors.Is(err, erro.ErrInternal) {
+				t.Fatalf("Validate error = %v, want %v", err, erro.ErrInternal)
+			}
+			// the cause names the tag, the client only gets the internal error
+			if cause := errors.Unwrap(err); cause == nil || !strings.Contains(cause.Error(), c.want) {
+				t.Errorf("Validate cause = %v, want it to contain %s", cause, c.want)
+			}
+		})
+	}
+
+	if err := ValidateVar("id", "user-01", "max=64,userid"); !errors.Is(err, erro.ErrInternal) {
+		t.Errorf("ValidateVar error = %v, want %v", err, erro.ErrInternal)
+	}
+}
+
+func TestValidateVar(t *testing.T) {
+	if err := ValidateVar("id", "user-01", "max=64,username"); err != nil {
+		t.Fatal(err)
+	}
+	err := ValidateVar("id", "../etc", "max=64,username")
+	if !errors.Is(err, erro.ErrValidation) {
+		t.Fatalf("ValidateVar error = %v, want %v", err, erro.ErrValidation)
+	}
+	if fields := erro.As(err).Fields; len(fields) != 1 || fields[0].Field != "id" {
+		t.Errorf("fields = %+v, want the id", fields)
+	}
+}